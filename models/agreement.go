@@ -1,9 +1,126 @@
 package models
 
-import "time"
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// DocumentType is a kind of legal document users accept separately.
+type DocumentType string
+
+const (
+	DocumentTerms          DocumentType = "TERMS"           // terms of use (the former EULA)
+	DocumentPrivacy        DocumentType = "PRIVACY"         // privacy policy
+	DocumentRecruiterTerms DocumentType = "RECRUITER_TERMS" // additional terms for recruiters
+)
+
+// DocumentTypes lists every document type.
+var DocumentTypes = []DocumentType{DocumentTerms, DocumentPrivacy, DocumentRecruiterTerms}
+
+// LocalizedURLs maps a locale to the URL of a document in that language.
+type LocalizedURLs map[Locale]string
+
+// Value implements the driver.Valuer interface for inserting as jsonb
+func (u LocalizedURLs) Value() (driver.Value, error) {
+	return json.Marshal(u)
+}
+
+// Scan implements the sql.Scanner interface for reading jsonb
+func (u *LocalizedURLs) Scan(value interface{}) error {
+	if value == nil {
+		return nil
+	}
+	bytes, ok := value.([]byte)
+	if !ok {
+		return errors.New("type assertion to []byte failed")
+	}
+	return json.Unmarshal(bytes, u)
+}
+
+// AgreementDocument is one published version of a document of an app. The
+// version in force is the one with the latest EffectiveAt that has passed.
+type AgreementDocument struct {
+	AppID       string        `json:"-" db:"app_id"`
+	Type        DocumentType  `json:"type" db:"type"`
+	Version     string        `json:"version" db:"version"`
+	EffectiveAt time.Time     `json:"effective_at" db:"effective_at"`
+	URLs        LocalizedURLs `json:"urls" db:"urls"`
+
+	// Hash is the hex SHA-256 of the published text, recorded with every
+	// consent to it.
+	Hash *string `json:"hash,omitempty" db:"hash"`
+}
+
+// URL returns the document's URL in locale, falling back to DefaultLocale.
+func (d *AgreementDocument) URL(locale Locale) string {
+	if u, ok := d.URLs[locale]; ok {
+		return u
+	}
+	return d.URLs[DefaultLocale]
+}
 
 type AgreementRecord struct {
-	VersionAgreed *string    `json:"version_agreed" binding:"required,min=1" db:"version_agreed"`
-	AgreedAt      *time.Time `json:"agreed_at,omitempty" db:"agreed_at"`
-	VersionLatest string     `json:"version_latest" db:"eula"`
+	DocumentType  DocumentType `json:"document_type" db:"document_type"`
+	VersionAgreed *string      `json:"version_agreed" binding:"required,min=1" db:"version_agreed"`
+	AgreedAt      *time.Time   `json:"agreed_at,omitempty" db:"agreed_at"`
+	VersionLatest string       `json:"version_latest" db:"version_latest"`
+
+	// Latest is the document in force. An app that hasn't published terms
+	// yet falls back to the global EULA version in public.version, which has
+	// no URLs or effective date.
+	Latest *AgreementDocument `json:"latest,omitempty" db:"-"`
+}
+
+// IsPending reports whether the user still has to accept the latest version.
+func (r *AgreementRecord) IsPending() bool {
+	return r.VersionAgreed == nil || *r.VersionAgreed != r.VersionLatest
+}
+
+// AgreementRequiredError is returned when a user has to accept a document
+// before the action is allowed. It matches ErrorAgreementRequired with
+// errors.Is.
+type AgreementRequiredError struct {
+	DocumentType DocumentType
+	Version      string // the version the user has to accept
+	URL          string
+}
+
+func (e *AgreementRequiredError) Error() string {
+	return fmt.Sprintf("agreement required: %s version %s", e.DocumentType, e.Version)
+}
+
+func (e *AgreementRequiredError) Is(target error) bool {
+	return target == ErrorAgreementRequired
+}
+
+// ConsentAction is what a consent event did to the user's agreement.
+type ConsentAction string
+
+const (
+	ConsentAgree    ConsentAction = "AGREE"
+	ConsentWithdraw ConsentAction = "WITHDRAW"
+)
+
+// ConsentEvidence is what the client tells about the circumstances of a
+// consent. Every field is optional.
+type ConsentEvidence struct {
+	IP           *string `json:"ip"`
+	UserAgent    *string `json:"user_agent"`
+	Locale       *Locale `json:"locale"`
+	DocumentHash *string `json:"document_hash"` // hash of the text the user was shown
+}
+
+// ConsentEvent is one entry of a user's consent history.
+type ConsentEvent struct {
+	DocumentType DocumentType  `json:"document_type" db:"document_type"`
+	Version      string        `json:"version" db:"version_agreed"`
+	Action       ConsentAction `json:"action" db:"action"`
+	At           time.Time     `json:"at" db:"agreed_at"`
+	IP           *string       `json:"ip" db:"ip"`
+	UserAgent    *string       `json:"user_agent" db:"user_agent"`
+	Locale       *Locale       `json:"locale" db:"locale"`
+	DocumentHash *string       `json:"document_hash" db:"document_hash"`
 }
@@ -1,7 +1,216 @@
 package models
 
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"unicode/utf8"
+)
+
 type App struct {
 	ID       string `json:"app_id" db:"id" example:"c718f5ca-724f-45c2-84fd-8e8a4fc77f10"`
 	Name     string `json:"app_name" db:"name" example:"A-Pen"`
 	BundleID string `json:"bundle_id" db:"bundle_id" example:"com.yoku.apen"`
+
+	// Config is nil when the app has no row in public.app_config. All
+	// AppConfig methods are nil-safe and fall back to the built-in defaults.
+	Config *AppConfig `json:"-" db:"config"`
+}
+
+// AppConfig is the per-app configuration blob. Every field is optional; an
+// unset field keeps the behavior the SDK had before per-app configuration.
+type AppConfig struct {
+	// DefaultAccessStatus applies to new chats when the caller doesn't pass
+	// WithAccessStatus. Defaults to AccessStatusLocked.
+	DefaultAccessStatus *AccessStatus `json:"default_access_status,omitempty"`
+
+	// MaxMessageLength caps a text body, counted in characters.
+	MaxMessageLength *int `json:"max_message_length,omitempty"`
+
+	// MaxMediaPerMessage caps the number of images or files in one message.
+	MaxMediaPerMessage *int `json:"max_media_per_message,omitempty"`
+
+	// AllowedMessageTypes restricts what users may send through SendMessage.
+	// Empty means every type is allowed. System messages (post, resume and
+	// business card) are never restricted.
+	AllowedMessageTypes []MessageType `json:"allowed_message_types,omitempty"`
+
+	// ResumeMasking controls what a recruiter sees of a resume while the chat
+	// is still LOCKED.
+	ResumeMasking ResumeMaskingPolicy `json:"resume_masking,omitempty"`
+
+	// MaxUploadBytes overrides the service's upload size limit per media
+	// type, e.g. {"1": 5242880} for 5 MiB images.
+	MaxUploadBytes map[MediaType]int64 `json:"max_upload_bytes,omitempty"`
+
+	// Retention purges old chat data; see RetentionPolicy. Unset keeps
+	// everything.
+	Retention *RetentionPolicy `json:"retention,omitempty"`
+}
+
+// Value implements the driver.Valuer interface for inserting as jsonb
+func (c AppConfig) Value() (driver.Value, error) {
+	return json.Marshal(c)
+}
+
+// Scan implements the sql.Scanner interface for reading jsonb
+func (c *AppConfig) Scan(value interface{}) error {
+	if value == nil {
+		return nil
+	}
+	bytes, ok := value.([]byte)
+	if !ok {
+		return errors.New("type assertion to []byte failed")
+	}
+	return json.Unmarshal(bytes, c)
+}
+
+// Clone returns a deep copy of c, which the caller may change without
+// affecting c.
+func (c *AppConfig) Clone() *AppConfig {
+	if c == nil {
+		return nil
+	}
+	cp := *c
+	if c.DefaultAccessStatus != nil {
+		status := *c.DefaultAccessStatus
+		cp.DefaultAccessStatus = &status
+	}
+	if c.MaxMessageLength != nil {
+		n := *c.MaxMessageLength
+		cp.MaxMessageLength = &n
+	}
+	if c.MaxMediaPerMessage != nil {
+		n := *c.MaxMediaPerMessage
+		cp.MaxMediaPerMessage = &n
+	}
+	if c.AllowedMessageTypes != nil {
+		cp.AllowedMessageTypes = append([]MessageType{}, c.AllowedMessageTypes...)
+	}
+	if c.MaxUploadBytes != nil {
+		cp.MaxUploadBytes = make(map[MediaType]int64, len(c.MaxUploadBytes))
+		for t, limit := range c.MaxUploadBytes {
+			cp.MaxUploadBytes[t] = limit
+		}
+	}
+	if c.Retention != nil {
+		retention := *c.Retention
+		cp.Retention = &retention
+	}
+	return &cp
+}
+
+// AccessStatusOrDefault returns the access status a new chat starts with.
+func (c *AppConfig) AccessStatusOrDefault() AccessStatus {
+	if c == nil || c.DefaultAccessStatus == nil {
+		return AccessStatusLocked
+	}
+	return *c.DefaultAccessStatus
+}
+
+// AllowsMessageType reports whether users of the app may send t.
+func (c *AppConfig) AllowsMessageType(t MessageType) bool {
+	switch t {
+	case MsgPost, MsgResume, MsgBusinessCard:
+		return true
+	}
+	if c == nil || len(c.AllowedMessageTypes) == 0 {
+		return true
+	}
+	for _, allowed := range c.AllowedMessageTypes {
+		if allowed == t {
+			return true
+		}
+	}
+	return false
+}
+
+// ValidateMessage checks a user-sent message against the app's limits. It
+// returns ErrorNotAllowed for a disallowed type and ErrorWrongParams for a
+// message that exceeds a size limit.
+func (c *AppConfig) ValidateMessage(opt *SendOption) error {
+	if opt == nil {
+		return ErrorWrongParams
+	}
+	if !c.AllowsMessageType(opt.Type) {
+		return ErrorNotAllowed
+	}
+	if c == nil {
+		return nil
+	}
+	if c.MaxMessageLength != nil && opt.Body != nil && utf8.RuneCountInString(*opt.Body) > *c.MaxMessageLength {
+		return ErrorWrongParams
+	}
+	if c.MaxMediaPerMessage != nil && len(opt.MediaIDs) > *c.MaxMediaPerMessage {
+		return ErrorWrongParams
+	}
+	return nil
+}
+
+// UploadLimit returns the largest upload the app accepts for t, or fallback
+// when the app doesn't override it.
+func (c *AppConfig) UploadLimit(t MediaType, fallback int64) int64 {
+	if c == nil {
+		return fallback
+	}
+	if limit, ok := c.MaxUploadBytes[t]; ok {
+		return limit
+	}
+	return fallback
+}
+
+// RetentionPolicy returns the app's retention rules, nil when it keeps
+// everything.
+func (c *AppConfig) RetentionPolicy() *RetentionPolicy {
+	if c == nil {
+		return nil
+	}
+	return c.Retention
+}
+
+// MaskResume applies the app's masking policy to a resume shown under the
+// given status. See ResumeMaskingPolicy.Apply.
+func (c *AppConfig) MaskResume(content *ResumeContent, status ResumeStatus) *ResumeContent {
+	if c == nil {
+		return content
+	}
+	return c.ResumeMasking.Apply(content, status)
+}
+
+// ResumeMaskingPolicy decides which resume fields are hidden from a recruiter
+// until the chat is unlocked.
+type ResumeMaskingPolicy string
+
+const (
+	ResumeMaskingNone     ResumeMaskingPolicy = ""         // show everything
+	ResumeMaskingContact  ResumeMaskingPolicy = "CONTACT"  // hide email and phone number
+	ResumeMaskingIdentity ResumeMaskingPolicy = "IDENTITY" // hide contact plus anything that identifies the person
+)
+
+// Apply returns the resume as it should be shown under status. Unlocked
+// resumes and unknown policies are returned as is; otherwise a masked copy
+// is returned and content itself is left untouched.
+func (p ResumeMaskingPolicy) Apply(content *ResumeContent, status ResumeStatus) *ResumeContent {
+	if content == nil || status == ResumeStatusUnlocked {
+		return content
+	}
+	switch p {
+	case ResumeMaskingContact:
+		masked := *content
+		masked.Email = nil
+		masked.PhoneNumber = nil
+		return &masked
+	case ResumeMaskingIdentity:
+		masked := *content
+		masked.Email = nil
+		masked.PhoneNumber = nil
+		masked.RealName = nil
+		masked.Gender = nil
+		masked.BirthYear = nil
+		masked.AlmaMater = nil
+		masked.YearOfGraduation = nil
+		return &masked
+	default:
+		return content
+	}
 }
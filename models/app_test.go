@@ -0,0 +1,121 @@
+package models
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+)
+
+func TestAppConfigNilKeepsDefaults(t *testing.T) {
+	var c *AppConfig
+	if got := c.AccessStatusOrDefault(); got != AccessStatusLocked {
+		t.Errorf("AccessStatusOrDefault() = %d, want LOCKED", got)
+	}
+	body := "hi"
+	if err := c.ValidateMessage(&SendOption{Type: MsgText, Body: &body}); err != nil {
+		t.Errorf("ValidateMessage() = %v, want nil", err)
+	}
+	resume := &ResumeContent{Email: &body}
+	if got := c.MaskResume(resume, ResumeStatusLocked); got != resume {
+		t.Errorf("MaskResume() should return content untouched without config")
+	}
+}
+
+func TestAppConfigValidateMessage(t *testing.T) {
+	maxLen, maxMedia := 5, 2
+	c := &AppConfig{
+		MaxMessageLength:    &maxLen,
+		MaxMediaPerMessage:  &maxMedia,
+		AllowedMessageTypes: []MessageType{MsgText, MsgImage},
+	}
+	short, long := "你好嗎", "hello!"
+	cases := []struct {
+		name string
+		opt  SendOption
+		want error
+	}{
+		{"text within limit", SendOption{Type: MsgText, Body: &short}, nil},
+		{"text too long", SendOption{Type: MsgText, Body: &long}, ErrorWrongParams},
+		{"images within limit", SendOption{Type: MsgImage, MediaIDs: []string{"a", "b"}}, nil},
+		{"too many images", SendOption{Type: MsgImage, MediaIDs: []string{"a", "b", "c"}}, ErrorWrongParams},
+		{"type not allowed", SendOption{Type: MsgFile, MediaIDs: []string{"a"}}, ErrorNotAllowed},
+		{"system type always allowed", SendOption{Type: MsgResume}, nil},
+	}
+	for _, tc := range cases {
+		if err := c.ValidateMessage(&tc.opt); !errors.Is(err, tc.want) {
+			t.Errorf("%s: ValidateMessage() = %v, want %v", tc.name, err, tc.want)
+		}
+	}
+}
+
+func TestResumeMaskingPolicy(t *testing.T) {
+	name, email, phone := "王小明", "a@b.c", "0912345678"
+	resume := &ResumeContent{RealName: &name, Email: &email, PhoneNumber: &phone}
+
+	if got := ResumeMaskingContact.Apply(resume, ResumeStatusUnlocked); got != resume {
+		t.Errorf("unlocked resume should not be masked")
+	}
+
+	contact := ResumeMaskingContact.Apply(resume, ResumeStatusLocked)
+	if contact.Email != nil || contact.PhoneNumber != nil || contact.RealName == nil {
+		t.Errorf("CONTACT masking = %+v, want only email and phone hidden", contact)
+	}
+	identity := ResumeMaskingIdentity.Apply(resume, ResumeStatusLocked)
+	if identity.Email != nil || identity.PhoneNumber != nil || identity.RealName != nil {
+		t.Errorf("IDENTITY masking = %+v, want name and contact hidden", identity)
+	}
+	if resume.Email == nil || resume.RealName == nil {
+		t.Errorf("masking must not modify the original resume")
+	}
+}
+
+func TestAppConfigScan(t *testing.T) {
+	var c AppConfig
+	raw := []byte(`{"default_access_status":"UNLOCKED","allowed_message_types":[1,2],"resume_masking":"CONTACT"}`)
+	if err := c.Scan(raw); err != nil {
+		t.Fatalf("Scan() = %v", err)
+	}
+	if c.AccessStatusOrDefault() != AccessStatusUnlocked || c.ResumeMasking != ResumeMaskingContact || len(c.AllowedMessageTypes) != 2 {
+		t.Errorf("Scan() = %+v", c)
+	}
+
+	var a AccessStatus
+	if err := json.Unmarshal([]byte(`1`), &a); err != nil || a != AccessStatusUnlocked {
+		t.Errorf("unmarshal ordinal = %d, %v", a, err)
+	}
+	if err := json.Unmarshal([]byte(`"OPEN"`), &a); err == nil {
+		t.Errorf("unmarshal unknown status should fail")
+	}
+}
+
+func TestAppConfigClone(t *testing.T) {
+	status, maxLen, maxMedia := AccessStatusUnlocked, 5, 2
+	c := &AppConfig{
+		DefaultAccessStatus: &status,
+		MaxMessageLength:    &maxLen,
+		MaxMediaPerMessage:  &maxMedia,
+		AllowedMessageTypes: []MessageType{MsgText},
+		ResumeMasking:       ResumeMaskingContact,
+		MaxUploadBytes:      map[MediaType]int64{Image: 100},
+		Retention:           &RetentionPolicy{MessageMonths: 12},
+	}
+	before, _ := json.Marshal(c)
+
+	cp := c.Clone()
+	if got, _ := json.Marshal(cp); string(got) != string(before) {
+		t.Fatalf("Clone() = %s, want %s", got, before)
+	}
+	*cp.DefaultAccessStatus = AccessStatusLocked
+	*cp.MaxMessageLength = 1
+	*cp.MaxMediaPerMessage = 1
+	cp.AllowedMessageTypes[0] = MsgImage
+	cp.MaxUploadBytes[Image] = 1
+	cp.Retention.MessageMonths = 1
+	if after, _ := json.Marshal(c); string(after) != string(before) {
+		t.Errorf("changing the clone changed the original to %s", after)
+	}
+
+	if (*AppConfig)(nil).Clone() != nil {
+		t.Error("nil config should clone to nil")
+	}
+}
@@ -3,7 +3,10 @@ package models
 import (
 	"encoding/json"
 	"errors"
+	"strings"
 	"time"
+	"unicode"
+	"unicode/utf8"
 
 	feedmodel "github.com/A-pen-app/feed-sdk/model"
 )
@@ -46,6 +49,19 @@ func (t MessageType) String() string {
 	}
 }
 
+// AttachmentType returns the media type a message of type t carries, and
+// false for message types without attachments.
+func (t MessageType) AttachmentType() (MediaType, bool) {
+	switch t {
+	case MsgImage:
+		return Image, true
+	case MsgFile:
+		return File, true
+	default:
+		return 0, false
+	}
+}
+
 type MessageStatus int
 
 const (
@@ -116,6 +132,11 @@ type Message struct {
 	CreatedAt time.Time     `json:"created_at" db:"created_at" example:"2023-10-01T04:00:00Z"`
 	Status    MessageStatus `json:"status" db:"status"`
 	IsMine    *bool         `json:"is_mine,omitempty" db:"-"`
+	// Read state, only on the user's own messages. ReadAt is when the
+	// receiver last opened the chat, which is no earlier than when they read
+	// the message.
+	IsReadByReceiver *bool      `json:"is_read_by_receiver,omitempty" db:"-"`
+	ReadAt           *time.Time `json:"read_at,omitempty" db:"-" example:"2023-10-01T04:00:00Z"`
 	// 0: 不使用
 	// 1: 文字訊息
 	// 2: 圖片訊息
@@ -166,6 +187,134 @@ type Message struct {
 
 	// Type=MsgResume
 	Resume *ResumeContent `json:"resume,omitempty" db:"-"`
+
+	Reactions []*Reaction `json:"reactions,omitempty" db:"-"`
+
+	// ContentError tells what of the message's content could not be loaded,
+	// e.g. a snapshot purged by retention; the message is shown without it.
+	ContentError string `json:"content_error,omitempty" db:"-"`
+}
+
+// Reaction is how many users reacted to a message with an emoji, and whether
+// the user is one of them.
+type Reaction struct {
+	Emoji string `json:"emoji" db:"emoji"`
+	Count int    `json:"count" db:"count"`
+	Mine  bool   `json:"mine" db:"mine"`
+}
+
+// maxReactionBytes fits the longest emoji ZWJ sequences.
+const maxReactionBytes = 32
+
+// emojiRunes are the code points that are emoji by themselves, per the
+// Unicode emoji data. Regional indicators are among them but only count in
+// pairs, as flags.
+var emojiRunes = &unicode.RangeTable{
+	R16: []unicode.Range16{
+		{0x00a9, 0x00a9, 1}, {0x00ae, 0x00ae, 1},
+		{0x203c, 0x203c, 1}, {0x2049, 0x2049, 1},
+		{0x2122, 0x2122, 1}, {0x2139, 0x2139, 1},
+		{0x2194, 0x2199, 1}, {0x21a9, 0x21aa, 1},
+		{0x231a, 0x231b, 1}, {0x2328, 0x2328, 1}, {0x23cf, 0x23cf, 1},
+		{0x23e9, 0x23f3, 1}, {0x23f8, 0x23fa, 1},
+		{0x24c2, 0x24c2, 1},
+		{0x25aa, 0x25ab, 1}, {0x25b6, 0x25b6, 1}, {0x25c0, 0x25c0, 1}, {0x25fb, 0x25fe, 1},
+		{0x2600, 0x2604, 1}, {0x260e, 0x260e, 1}, {0x2611, 0x2611, 1}, {0x2614, 0x2615, 1}, {0x2618, 0x2618, 1},
+		{0x261d, 0x261d, 1}, {0x2620, 0x2620, 1}, {0x2622, 0x2623, 1}, {0x2626, 0x2626, 1}, {0x262a, 0x262a, 1},
+		{0x262e, 0x262f, 1}, {0x2638, 0x263a, 1}, {0x2640, 0x2640, 1}, {0x2642, 0x2642, 1}, {0x2648, 0x2653, 1},
+		{0x265f, 0x2660, 1}, {0x2663, 0x2663, 1}, {0x2665, 0x2666, 1}, {0x2668, 0x2668, 1}, {0x267b, 0x267b, 1},
+		{0x267e, 0x267f, 1}, {0x2692, 0x2697, 1}, {0x2699, 0x2699, 1}, {0x269b, 0x269c, 1}, {0x26a0, 0x26a1, 1},
+		{0x26a7, 0x26a7, 1}, {0x26aa, 0x26ab, 1}, {0x26b0, 0x26b1, 1}, {0x26bd, 0x26be, 1}, {0x26c4, 0x26c5, 1},
+		{0x26c8, 0x26c8, 1}, {0x26ce, 0x26cf, 1}, {0x26d1, 0x26d1, 1}, {0x26d3, 0x26d4, 1}, {0x26e9, 0x26ea, 1},
+		{0x26f0, 0x26f5, 1}, {0x26f7, 0x26fa, 1}, {0x26fd, 0x26fd, 1}, {0x2702, 0x2702, 1}, {0x2705, 0x2705, 1},
+		{0x2708, 0x270d, 1}, {0x270f, 0x270f, 1}, {0x2712, 0x2712, 1}, {0x2714, 0x2714, 1}, {0x2716, 0x2716, 1},
+		{0x271d, 0x271d, 1}, {0x2721, 0x2721, 1}, {0x2728, 0x2728, 1}, {0x2733, 0x2734, 1}, {0x2744, 0x2744, 1},
+		{0x2747, 0x2747, 1}, {0x274c, 0x274c, 1}, {0x274e, 0x274e, 1}, {0x2753, 0x2755, 1}, {0x2757, 0x2757, 1},
+		{0x2763, 0x2764, 1}, {0x2795, 0x2797, 1}, {0x27a1, 0x27a1, 1}, {0x27b0, 0x27b0, 1}, {0x27bf, 0x27bf, 1},
+		{0x2934, 0x2935, 1},
+		{0x2b05, 0x2b07, 1}, {0x2b1b, 0x2b1c, 1}, {0x2b50, 0x2b50, 1}, {0x2b55, 0x2b55, 1},
+		{0x3030, 0x3030, 1}, {0x303d, 0x303d, 1}, {0x3297, 0x3297, 1}, {0x3299, 0x3299, 1},
+	},
+	R32: []unicode.Range32{
+		{0x1f004, 0x1f004, 1}, {0x1f0cf, 0x1f0cf, 1},
+		{0x1f170, 0x1f251, 1},
+		{0x1f300, 0x1f6ff, 1},
+		{0x1f7e0, 0x1f7ff, 1},
+		{0x1f900, 0x1f9ff, 1},
+		{0x1fa70, 0x1faff, 1},
+	},
+}
+
+const (
+	variationSelector16 = '\ufe0f'
+	zeroWidthJoiner     = '\u200d'
+	combiningKeycap     = '\u20e3'
+	blackFlag           = '\U0001f3f4'
+	cancelTag           = '\U000e007f'
+)
+
+func isRegionalIndicator(r rune) bool { return r >= 0x1f1e6 && r <= 0x1f1ff }
+func isSkinTone(r rune) bool          { return r >= 0x1f3fb && r <= 0x1f3ff }
+func isTag(r rune) bool               { return r >= 0xe0020 && r <= 0xe007e }
+
+// ValidReaction reports whether emoji can be used as a reaction: exactly
+// one emoji, which may be a flag, a keycap, a tag sequence such as a
+// subdivision flag, or a ZWJ sequence of emoji with optional presentation
+// selectors and skin tones.
+func ValidReaction(emoji string) bool {
+	if emoji == "" || len(emoji) > maxReactionBytes || !utf8.ValidString(emoji) {
+		return false
+	}
+	rs := []rune(emoji)
+	n := len(rs)
+
+	switch {
+	case n == 2 && isRegionalIndicator(rs[0]) && isRegionalIndicator(rs[1]):
+		return true
+	case rs[n-1] == combiningKeycap:
+		// e.g. 1️⃣: a digit, # or *, optionally with a presentation selector
+		body := rs[:n-1]
+		if len(body) == 2 && body[1] == variationSelector16 {
+			body = body[:1]
+		}
+		return len(body) == 1 && strings.ContainsRune("0123456789#*", body[0])
+	case rs[0] == blackFlag && n > 2 && rs[n-1] == cancelTag:
+		for _, r := range rs[1 : n-1] {
+			if !isTag(r) {
+				return false
+			}
+		}
+		return true
+	}
+
+	for i := 0; ; {
+		if !unicode.Is(emojiRunes, rs[i]) || isRegionalIndicator(rs[i]) {
+			return false
+		}
+		i++
+		if i < n && rs[i] == variationSelector16 {
+			i++
+		}
+		if i < n && isSkinTone(rs[i]) {
+			i++
+		}
+		if i == n {
+			return true
+		}
+		if rs[i] != zeroWidthJoiner || i+1 == n {
+			return false
+		}
+		i++
+	}
+}
+
+// ReadReceipt tells the sender of a chat's messages that the reader has
+// read everything sent to them up to ReadAt.
+type ReadReceipt struct {
+	ChatID   string    `json:"chat_id"`
+	ReaderID string    `json:"reader_id"`
+	SenderID string    `json:"sender_id"`
+	ReadAt   time.Time `json:"read_at"`
 }
 
 type ChatAnnotation int
@@ -213,6 +362,29 @@ func (a AccessStatus) MarshalJSON() ([]byte, error) {
 	return json.Marshal(str)
 }
 
+// UnmarshalJSON accepts both the string form written by MarshalJSON and the
+// raw ordinal stored in the DB.
+func (a *AccessStatus) UnmarshalJSON(data []byte) error {
+	var str string
+	if err := json.Unmarshal(data, &str); err != nil {
+		var n int
+		if err := json.Unmarshal(data, &n); err != nil {
+			return err
+		}
+		*a = AccessStatus(n)
+		return nil
+	}
+	switch str {
+	case "LOCKED":
+		*a = AccessStatusLocked
+	case "UNLOCKED":
+		*a = AccessStatusUnlocked
+	default:
+		return errors.New("wrong parameters")
+	}
+	return nil
+}
+
 type ChatRoom struct {
 	//chat_thread
 	ChatID      string          `json:"chat_id" db:"chat_id"`
@@ -284,6 +456,8 @@ type DisplayUser struct {
 	Character   *string `json:"character"`
 	IsAnonymous bool    `json:"is_anonymous"`
 	PushToken   *string `json:"-"`
+	// Presence is set by the chat service when it has a presence store
+	Presence *Presence `json:"presence,omitempty"`
 }
 
 type Money struct {
@@ -395,6 +569,10 @@ type GetChatIDOption struct {
 	RecruiterContact *HireContact
 	JobSeekerContact *HireContact
 	AccessStatus     *AccessStatus
+
+	// DefaultAccessStatus only applies when the chat gets created; unlike
+	// AccessStatus it never overwrites an existing chat.
+	DefaultAccessStatus *AccessStatus
 }
 type GetChatIDOptionFunc func(*GetChatIDOption)
 
@@ -416,6 +594,12 @@ func WithChatAccessStatus(status AccessStatus) GetChatIDOptionFunc {
 	}
 }
 
+func WithChatDefaultAccessStatus(status AccessStatus) GetChatIDOptionFunc {
+	return func(opt *GetChatIDOption) {
+		opt.DefaultAccessStatus = &status
+	}
+}
+
 type NewChatOption struct {
 	Resume           *ResumeContent
 	Card             *BusinessCardContent
@@ -0,0 +1,20 @@
+package models
+
+import "testing"
+
+func TestValidReaction(t *testing.T) {
+	for _, emoji := range []string{
+		"👍", "❤️", "❤", "👍🏽", "1️⃣", "#⃣", "🇹🇼", "❤️‍🔥", "👨‍👩‍👧‍👦", "🏳️‍🌈", "🏴󠁧󠁢󠁳󠁣󠁴󠁿", "©️", "⭐",
+	} {
+		if !ValidReaction(emoji) {
+			t.Errorf("ValidReaction(%q) = false, want true", emoji)
+		}
+	}
+	for _, emoji := range []string{
+		"", "!!!", "$", "ok", "1", "→", "✓", "👍👍", "👍 ", "🇹", "‍", "👍‍", "a⃣", "🏴x\U000e007f", "️",
+	} {
+		if ValidReaction(emoji) {
+			t.Errorf("ValidReaction(%q) = true, want false", emoji)
+		}
+	}
+}
@@ -0,0 +1,108 @@
+package models
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ChatCursor is the position of a chat in the chat list, which is ordered
+// by pinned first, then latest activity, then chat ID.
+type ChatCursor struct {
+	IsPinned  bool
+	UpdatedAt time.Time
+	ID        string
+}
+
+// MessageCursor is the position of a message in a chat, which is ordered by
+// creation time, then message ID.
+type MessageCursor struct {
+	CreatedAt time.Time
+	ID        string
+}
+
+// minUUID sorts before every ID, so a legacy cursor (a Unix-second
+// timestamp) excludes everything at its second like it used to.
+const minUUID = "00000000-0000-0000-0000-000000000000"
+
+type cursorJSON struct {
+	IsPinned bool   `json:"p,omitempty"`
+	Micros   int64  `json:"t"`
+	ID       string `json:"id"`
+}
+
+func encodeCursor(c cursorJSON) string {
+	data, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// decodeCursor parses an opaque cursor, or a legacy Unix-second timestamp
+// handed out before cursors were opaque.
+func decodeCursor(s string) (cursorJSON, error) {
+	if seconds, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return cursorJSON{Micros: seconds * 1e6, ID: minUUID}, nil
+	}
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return cursorJSON{}, ErrorWrongParams
+	}
+	c := cursorJSON{}
+	if err := json.Unmarshal(data, &c); err != nil {
+		return cursorJSON{}, ErrorWrongParams
+	}
+	// chats and messages are keyed by UUID; anything else would only fail
+	// in the database
+	if _, err := uuid.Parse(c.ID); err != nil {
+		return cursorJSON{}, ErrorWrongParams
+	}
+	return c, nil
+}
+
+// String encodes the cursor for clients; they must treat it as opaque.
+func (c ChatCursor) String() string {
+	return encodeCursor(cursorJSON{IsPinned: c.IsPinned, Micros: c.UpdatedAt.UnixMicro(), ID: c.ID})
+}
+
+// ParseChatCursor decodes a cursor from ChatCursor.String. It returns nil for
+// "" (the first page) and ErrorWrongParams for anything it can't decode.
+func ParseChatCursor(s string) (*ChatCursor, error) {
+	if s == "" {
+		return nil, nil
+	}
+	c, err := decodeCursor(s)
+	if err != nil {
+		return nil, err
+	}
+	return &ChatCursor{IsPinned: c.IsPinned, UpdatedAt: time.UnixMicro(c.Micros), ID: c.ID}, nil
+}
+
+// String encodes the cursor for clients; they must treat it as opaque.
+func (c MessageCursor) String() string {
+	return encodeCursor(cursorJSON{Micros: c.CreatedAt.UnixMicro(), ID: c.ID})
+}
+
+// ParseMessageCursor decodes a cursor from MessageCursor.String. It returns
+// nil for "" (the first page) and ErrorWrongParams for anything it can't
+// decode.
+func ParseMessageCursor(s string) (*MessageCursor, error) {
+	if s == "" {
+		return nil, nil
+	}
+	c, err := decodeCursor(s)
+	if err != nil {
+		return nil, err
+	}
+	return &MessageCursor{CreatedAt: time.UnixMicro(c.Micros), ID: c.ID}, nil
+}
+
+// MessageWindow is a page of messages around an anchor message, newest
+// first. Older continues with GetChatMessages and Newer with
+// GetNewerMessages; either is "" when there is nothing more that way.
+type MessageWindow struct {
+	Messages []*Message `json:"messages"`
+	Older    string     `json:"older"`
+	Newer    string     `json:"newer"`
+}
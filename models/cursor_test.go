@@ -0,0 +1,40 @@
+package models
+
+import (
+	"testing"
+	"time"
+)
+
+func TestChatCursorRoundTrip(t *testing.T) {
+	at := time.Date(2026, 5, 1, 12, 0, 0, 123456789, time.UTC)
+	c := ChatCursor{IsPinned: true, UpdatedAt: at, ID: "ce465117-1c0a-4746-8500-e4fb2c960f70"}
+
+	got, err := ParseChatCursor(c.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !got.IsPinned || got.ID != c.ID || !got.UpdatedAt.Equal(at.Truncate(time.Microsecond)) {
+		t.Errorf("ParseChatCursor(%q) = %+v, want %+v at microsecond precision", c.String(), got, c)
+	}
+}
+
+func TestMessageCursorParse(t *testing.T) {
+	if c, err := ParseMessageCursor(""); c != nil || err != nil {
+		t.Errorf("empty cursor = %v, %v; want the first page", c, err)
+	}
+	notUUID := MessageCursor{CreatedAt: time.Now(), ID: "1' OR '1'='1"}.String()
+	for _, bad := range []string{"not a cursor!", "e30", "aGVsbG8", notUUID} {
+		if _, err := ParseMessageCursor(bad); err != ErrorWrongParams {
+			t.Errorf("ParseMessageCursor(%q) err = %v, want ErrorWrongParams", bad, err)
+		}
+	}
+
+	// cursors handed out before they were opaque keep working
+	legacy, err := ParseMessageCursor("1700000000")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !legacy.CreatedAt.Equal(time.Unix(1700000000, 0)) || legacy.ID != minUUID {
+		t.Errorf("legacy cursor = %+v", legacy)
+	}
+}
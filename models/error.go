@@ -10,4 +10,6 @@ var (
 	ErrorNotAllowed        = errors.New("action not allowed")
 	ErrorInsufficientQuota = errors.New("insufficient quota")
 	ErrorUserNotVerified   = errors.New("user not verified")
+	ErrorInvalidReceipt    = errors.New("invalid receipt")
+	ErrorAgreementRequired = errors.New("agreement required")
 )
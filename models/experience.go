@@ -1,7 +1,5 @@
 package models
 
-import "strconv"
-
 // Sentinel values for the apen absolute-tenure encoding used by
 // BusinessCardContent.ExperienceYears (and user.experience_years in apen's
 // main DB). Values in between are literal year counts.
@@ -13,15 +11,10 @@ const (
 // FormatExperienceYears decodes the sentinel encoding into the display
 // string. All render paths (chat card, snapshots) must go through this
 // instead of printing the raw value.
+//
+// It renders zh-TW; use FormatExperienceYearsIn for other locales.
 func FormatExperienceYears(v int) string {
-	switch {
-	case v <= ExperienceYearsLessThanOne:
-		return "1年以下"
-	case v >= ExperienceYearsTwentyPlus:
-		return "20年以上"
-	default:
-		return strconv.Itoa(v) + "年"
-	}
+	return FormatExperienceYearsIn(LocaleZhTW, v)
 }
 
 // ExperienceRange is the nurse / phar range-based tenure stored in
@@ -38,22 +31,9 @@ const (
 	ExperienceRangeFifteenPlus  ExperienceRange = "FIFTEEN_PLUS"   // 15年以上
 )
 
+// Chinese is the zh-TW shortcut for Label.
 func (e ExperienceRange) Chinese() string {
-	switch e {
-	case ExperienceRangeLessThanOne:
-		return "1年以下"
-	case ExperienceRangeOneToThree:
-		return "1-3年"
-	case ExperienceRangeThreeToFive:
-		return "3-5年"
-	case ExperienceRangeFiveToTen:
-		return "5-10年"
-	case ExperienceRangeTenToFifteen:
-		return "10-15年"
-	case ExperienceRangeFifteenPlus:
-		return "15年以上"
-	}
-	return ""
+	return e.Label(LocaleZhTW)
 }
 
 func ValidateExperienceRange(e ExperienceRange) bool {
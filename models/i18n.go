@@ -0,0 +1,217 @@
+package models
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Locale identifies the language of a display label. The values are the
+// BCP 47 tags our app builds send in their Accept-Language header.
+type Locale string
+
+const (
+	LocaleZhTW Locale = "zh-TW"
+	LocaleEn   Locale = "en"
+	LocaleJa   Locale = "ja"
+)
+
+// DefaultLocale is used whenever a caller asks for a locale the catalog
+// doesn't know; it is also what the legacy Chinese() shortcuts return.
+const DefaultLocale = LocaleZhTW
+
+// SupportedLocales lists every locale the catalog must fully cover.
+var SupportedLocales = []Locale{LocaleZhTW, LocaleEn, LocaleJa}
+
+// ParseLocale maps a loose language tag ("en-US", "ja_JP", "zh-Hant-TW")
+// onto a supported locale, falling back to DefaultLocale.
+func ParseLocale(tag string) Locale {
+	tag = strings.ToLower(strings.ReplaceAll(strings.TrimSpace(tag), "_", "-"))
+	switch {
+	case strings.HasPrefix(tag, "en"):
+		return LocaleEn
+	case strings.HasPrefix(tag, "ja"):
+		return LocaleJa
+	default:
+		return DefaultLocale
+	}
+}
+
+// lookupLabel returns catalog[locale][key], falling back to DefaultLocale
+// when the locale is unsupported. Unknown keys yield "".
+func lookupLabel[K comparable](catalog map[Locale]map[K]string, locale Locale, key K) string {
+	labels, ok := catalog[locale]
+	if !ok {
+		labels = catalog[DefaultLocale]
+	}
+	return labels[key]
+}
+
+var collaborationTypeLabels = map[Locale]map[CollaborationType]string{
+	LocaleZhTW: {
+		CollaborationType_FullTime:          "全職",
+		CollaborationType_PartTime:          "兼職",
+		CollaborationType_Attending:         "掛牌",
+		CollaborationType_Lecturer:          "講座講師",
+		CollaborationType_Prescription:      "業配",
+		CollaborationType_Endorsement:       "代言",
+		CollaborationType_Telemedicine:      "遠距醫療",
+		CollaborationType_MarketResearch:    "市調訪談",
+		CollaborationType_AcademicEditing:   "學術編輯",
+		CollaborationType_ProductExperience: "產品體驗",
+	},
+	LocaleEn: {
+		CollaborationType_FullTime:          "Full-time",
+		CollaborationType_PartTime:          "Part-time",
+		CollaborationType_Attending:         "Attending",
+		CollaborationType_Lecturer:          "Lecturer",
+		CollaborationType_Prescription:      "Sponsored content",
+		CollaborationType_Endorsement:       "Endorsement",
+		CollaborationType_Telemedicine:      "Telemedicine",
+		CollaborationType_MarketResearch:    "Market research interview",
+		CollaborationType_AcademicEditing:   "Academic editing",
+		CollaborationType_ProductExperience: "Product experience",
+	},
+	LocaleJa: {
+		CollaborationType_FullTime:          "常勤",
+		CollaborationType_PartTime:          "非常勤",
+		CollaborationType_Attending:         "名義貸し",
+		CollaborationType_Lecturer:          "講演講師",
+		CollaborationType_Prescription:      "タイアップ",
+		CollaborationType_Endorsement:       "広告出演",
+		CollaborationType_Telemedicine:      "オンライン診療",
+		CollaborationType_MarketResearch:    "市場調査インタビュー",
+		CollaborationType_AcademicEditing:   "学術編集",
+		CollaborationType_ProductExperience: "製品体験",
+	},
+}
+
+var yearOfExperienceLabels = map[Locale]map[YearOfExperienceType]string{
+	LocaleZhTW: {
+		YearOfExperienceNone:         "無經驗",
+		YearOfExperienceLessThanOne:  "1年以下",
+		YearOfExperienceOneToTwo:     "1年 ~ 2年",
+		YearOfExperienceTwoToThree:   "2年 ~ 3年",
+		YearOfExperienceThreeToFour:  "3年 ~ 4年",
+		YearOfExperienceFourToFive:   "4年 ~ 5年",
+		YearOfExperienceFiveToSix:    "5年 ~ 6年",
+		YearOfExperienceSixToSeven:   "6年 ~ 7年",
+		YearOfExperienceSevenToEight: "7年 ~ 8年",
+		YearOfExperienceEightToNine:  "8年 ~ 9年",
+		YearOfExperienceNineToTen:    "9年 ~ 10年",
+		YearOfExperienceMoreThanTen:  "10年以上",
+	},
+	LocaleEn: {
+		YearOfExperienceNone:         "No experience",
+		YearOfExperienceLessThanOne:  "Less than 1 year",
+		YearOfExperienceOneToTwo:     "1 ~ 2 years",
+		YearOfExperienceTwoToThree:   "2 ~ 3 years",
+		YearOfExperienceThreeToFour:  "3 ~ 4 years",
+		YearOfExperienceFourToFive:   "4 ~ 5 years",
+		YearOfExperienceFiveToSix:    "5 ~ 6 years",
+		YearOfExperienceSixToSeven:   "6 ~ 7 years",
+		YearOfExperienceSevenToEight: "7 ~ 8 years",
+		YearOfExperienceEightToNine:  "8 ~ 9 years",
+		YearOfExperienceNineToTen:    "9 ~ 10 years",
+		YearOfExperienceMoreThanTen:  "More than 10 years",
+	},
+	LocaleJa: {
+		YearOfExperienceNone:         "経験なし",
+		YearOfExperienceLessThanOne:  "1年未満",
+		YearOfExperienceOneToTwo:     "1年 ~ 2年",
+		YearOfExperienceTwoToThree:   "2年 ~ 3年",
+		YearOfExperienceThreeToFour:  "3年 ~ 4年",
+		YearOfExperienceFourToFive:   "4年 ~ 5年",
+		YearOfExperienceFiveToSix:    "5年 ~ 6年",
+		YearOfExperienceSixToSeven:   "6年 ~ 7年",
+		YearOfExperienceSevenToEight: "7年 ~ 8年",
+		YearOfExperienceEightToNine:  "8年 ~ 9年",
+		YearOfExperienceNineToTen:    "9年 ~ 10年",
+		YearOfExperienceMoreThanTen:  "10年以上",
+	},
+}
+
+var experienceRangeLabels = map[Locale]map[ExperienceRange]string{
+	LocaleZhTW: {
+		ExperienceRangeLessThanOne:  "1年以下",
+		ExperienceRangeOneToThree:   "1-3年",
+		ExperienceRangeThreeToFive:  "3-5年",
+		ExperienceRangeFiveToTen:    "5-10年",
+		ExperienceRangeTenToFifteen: "10-15年",
+		ExperienceRangeFifteenPlus:  "15年以上",
+	},
+	LocaleEn: {
+		ExperienceRangeLessThanOne:  "Less than 1 year",
+		ExperienceRangeOneToThree:   "1-3 years",
+		ExperienceRangeThreeToFive:  "3-5 years",
+		ExperienceRangeFiveToTen:    "5-10 years",
+		ExperienceRangeTenToFifteen: "10-15 years",
+		ExperienceRangeFifteenPlus:  "15+ years",
+	},
+	LocaleJa: {
+		ExperienceRangeLessThanOne:  "1年未満",
+		ExperienceRangeOneToThree:   "1-3年",
+		ExperienceRangeThreeToFive:  "3-5年",
+		ExperienceRangeFiveToTen:    "5-10年",
+		ExperienceRangeTenToFifteen: "10-15年",
+		ExperienceRangeFifteenPlus:  "15年以上",
+	},
+}
+
+// experienceYearsFormat holds the three shapes FormatExperienceYears can
+// render: the low sentinel, a literal year count, and the high sentinel.
+type experienceYearsFormat struct {
+	lessThanOne string
+	years       func(v int) string
+	twentyPlus  string
+}
+
+var experienceYearsFormats = map[Locale]experienceYearsFormat{
+	LocaleZhTW: {
+		lessThanOne: "1年以下",
+		years:       func(v int) string { return fmt.Sprintf("%d年", v) },
+		twentyPlus:  "20年以上",
+	},
+	LocaleEn: {
+		lessThanOne: "Less than 1 year",
+		years: func(v int) string {
+			if v == 1 {
+				return "1 year"
+			}
+			return fmt.Sprintf("%d years", v)
+		},
+		twentyPlus: "20+ years",
+	},
+	LocaleJa: {
+		lessThanOne: "1年未満",
+		years:       func(v int) string { return fmt.Sprintf("%d年", v) },
+		twentyPlus:  "20年以上",
+	},
+}
+
+func (c CollaborationType) Label(locale Locale) string {
+	return lookupLabel(collaborationTypeLabels, locale, c)
+}
+
+func (y YearOfExperienceType) Label(locale Locale) string {
+	return lookupLabel(yearOfExperienceLabels, locale, y)
+}
+
+func (e ExperienceRange) Label(locale Locale) string {
+	return lookupLabel(experienceRangeLabels, locale, e)
+}
+
+// FormatExperienceYearsIn is the localized form of FormatExperienceYears.
+func FormatExperienceYearsIn(locale Locale, v int) string {
+	f, ok := experienceYearsFormats[locale]
+	if !ok {
+		f = experienceYearsFormats[DefaultLocale]
+	}
+	switch {
+	case v <= ExperienceYearsLessThanOne:
+		return f.lessThanOne
+	case v >= ExperienceYearsTwentyPlus:
+		return f.twentyPlus
+	default:
+		return f.years(v)
+	}
+}
@@ -0,0 +1,144 @@
+package models
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"testing"
+)
+
+// declaredConsts counts the constants declared for each named type in this
+// package, following implicit repetition inside iota blocks. It lets the
+// completeness tests notice an enum value that was added to the source but
+// never put into the catalog.
+func declaredConsts(t *testing.T) map[string]int {
+	t.Helper()
+	fset := token.NewFileSet()
+	pkgs, err := parser.ParseDir(fset, ".", nil, 0)
+	if err != nil {
+		t.Fatalf("parse package: %v", err)
+	}
+	counts := map[string]int{}
+	for _, f := range pkgs["models"].Files {
+		for _, decl := range f.Decls {
+			gen, ok := decl.(*ast.GenDecl)
+			if !ok || gen.Tok != token.CONST {
+				continue
+			}
+			typ := ""
+			for _, spec := range gen.Specs {
+				vs := spec.(*ast.ValueSpec)
+				switch {
+				case vs.Type != nil:
+					if ident, ok := vs.Type.(*ast.Ident); ok {
+						typ = ident.Name
+					} else {
+						typ = ""
+					}
+				case len(vs.Values) > 0:
+					typ = ""
+				}
+				if typ != "" {
+					counts[typ] += len(vs.Names)
+				}
+			}
+		}
+	}
+	return counts
+}
+
+func checkCatalog[K comparable](t *testing.T, name string, declared int, catalog map[Locale]map[K]string) {
+	t.Helper()
+	base := catalog[DefaultLocale]
+	if len(base) != declared {
+		t.Errorf("%s: %d values declared but %s catalog has %d labels", name, declared, DefaultLocale, len(base))
+	}
+	for _, locale := range SupportedLocales {
+		labels, ok := catalog[locale]
+		if !ok {
+			t.Errorf("%s: no catalog for %s", name, locale)
+			continue
+		}
+		for key := range base {
+			if labels[key] == "" {
+				t.Errorf("%s: %v has no %s label", name, key, locale)
+			}
+		}
+		for key := range labels {
+			if _, ok := base[key]; !ok {
+				t.Errorf("%s: %s labels %v, which %s doesn't know", name, locale, key, DefaultLocale)
+			}
+		}
+	}
+	if len(catalog) != len(SupportedLocales) {
+		t.Errorf("%s: catalog has %d locales, want %d", name, len(catalog), len(SupportedLocales))
+	}
+}
+
+func TestLabelCatalogsAreComplete(t *testing.T) {
+	declared := declaredConsts(t)
+	checkCatalog(t, "CollaborationType", declared["CollaborationType"], collaborationTypeLabels)
+	checkCatalog(t, "YearOfExperienceType", declared["YearOfExperienceType"], yearOfExperienceLabels)
+	checkCatalog(t, "ExperienceRange", declared["ExperienceRange"], experienceRangeLabels)
+
+	for _, locale := range SupportedLocales {
+		if _, ok := experienceYearsFormats[locale]; !ok {
+			t.Errorf("FormatExperienceYearsIn: no format for %s", locale)
+		}
+	}
+}
+
+func TestChineseIsZhTWLabel(t *testing.T) {
+	for c := CollaborationType_FullTime; c <= CollaborationType_ProductExperience; c++ {
+		if c.Chinese() != c.Label(LocaleZhTW) || c.Chinese() == "" {
+			t.Errorf("CollaborationType(%d).Chinese() = %q, Label(zh-TW) = %q", c, c.Chinese(), c.Label(LocaleZhTW))
+		}
+	}
+	if got := CollaborationType_FullTime.Label(LocaleEn); got != "Full-time" {
+		t.Errorf("Label(en) = %q, want %q", got, "Full-time")
+	}
+	if got := CollaborationType_FullTime.Label("fr"); got != "全職" {
+		t.Errorf("unsupported locale should fall back to zh-TW, got %q", got)
+	}
+	if got := CollaborationType(99).Label(LocaleEn); got != "" {
+		t.Errorf("unknown value should have no label, got %q", got)
+	}
+}
+
+func TestFormatExperienceYearsIn(t *testing.T) {
+	cases := []struct {
+		locale Locale
+		in     int
+		want   string
+	}{
+		{LocaleEn, ExperienceYearsLessThanOne, "Less than 1 year"},
+		{LocaleEn, 1, "1 year"},
+		{LocaleEn, 7, "7 years"},
+		{LocaleEn, ExperienceYearsTwentyPlus, "20+ years"},
+		{LocaleJa, 0, "1年未満"},
+		{LocaleJa, 7, "7年"},
+		{LocaleJa, 30, "20年以上"},
+		{"fr", 7, "7年"},
+	}
+	for _, c := range cases {
+		if got := FormatExperienceYearsIn(c.locale, c.in); got != c.want {
+			t.Errorf("FormatExperienceYearsIn(%s, %d) = %q, want %q", c.locale, c.in, got, c.want)
+		}
+	}
+}
+
+func TestParseLocale(t *testing.T) {
+	cases := map[string]Locale{
+		"en-US":      LocaleEn,
+		"EN":         LocaleEn,
+		"ja_JP":      LocaleJa,
+		"zh-Hant-TW": LocaleZhTW,
+		"":           LocaleZhTW,
+		"fr":         LocaleZhTW,
+	}
+	for in, want := range cases {
+		if got := ParseLocale(in); got != want {
+			t.Errorf("ParseLocale(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"net/url"
 	"path/filepath"
+	"strings"
 	"time"
 )
 
@@ -16,6 +17,24 @@ const (
 	File
 )
 
+// Accepts reports whether a file sniffed as contentType (see
+// http.DetectContentType) may be uploaded as t. Files may be anything.
+func (t MediaType) Accepts(contentType string) bool {
+	contentType, _, _ = strings.Cut(contentType, ";")
+	switch t {
+	case Image:
+		return strings.HasPrefix(contentType, "image/")
+	case Audio:
+		return strings.HasPrefix(contentType, "audio/") || contentType == "application/ogg"
+	case Video:
+		return strings.HasPrefix(contentType, "video/") || contentType == "application/ogg"
+	case File:
+		return true
+	default:
+		return false
+	}
+}
+
 type Media struct {
 	ID         string `json:"-" db:"id"`
 	URL        URL    `json:"url" db:"url"`
@@ -30,6 +49,32 @@ type Media struct {
 
 	Size      *string    `json:"size,omitempty" db:"size"`
 	ExpiredAt *time.Time `json:"expired_at,omitempty" db:"expired_at"`
+	CreatedAt time.Time  `json:"-" db:"created_at"`
+
+	// StorageKey is set for media kept in the blob store. Such media has no
+	// permanent URL; service.Media signs a short-lived one into URL when the
+	// media is shown.
+	StorageKey *string `json:"-" db:"storage_key"`
+
+	// OwnerID is the user who uploaded the media; only they can attach it
+	// to a message.
+	OwnerID *string `json:"-" db:"owner_id"`
+
+	// Set by the upload pipeline; nil for media created before it.
+	ContentType *string `json:"content_type,omitempty" db:"content_type"`
+	SizeBytes   *int64  `json:"size_bytes,omitempty" db:"size_bytes"`
+	Width       *int    `json:"width,omitempty" db:"width"`
+	Height      *int    `json:"height,omitempty" db:"height"`
+}
+
+// IsOwnedBy reports whether userID uploaded the media.
+func (m *Media) IsOwnedBy(userID string) bool {
+	return m.OwnerID != nil && *m.OwnerID == userID
+}
+
+// IsExpiredAt reports whether the media is no longer available at now.
+func (m *Media) IsExpiredAt(now time.Time) bool {
+	return m.ExpiredAt != nil && !now.Before(*m.ExpiredAt)
 }
 
 type MediaUpload struct {
@@ -41,6 +86,21 @@ type MediaUpload struct {
 	Title       *string    `json:"-"`
 	Size        *string    `json:"-"`
 	ExpiredAt   *time.Time `json:"-"`
+	StorageKey  *string    `json:"-"`
+	OwnerID     *string    `json:"-"`
+	ContentType *string    `json:"-"`
+	SizeBytes   *int64     `json:"-"`
+	Width       *int       `json:"-"`
+	Height      *int       `json:"-"`
+}
+
+// UploadIntent tells the client where to upload a file directly to the blob
+// store. The media only exists once the upload is completed with Key.
+type UploadIntent struct {
+	Key       string    `json:"key"`
+	Method    string    `json:"method"`
+	URL       string    `json:"upload_url"`
+	ExpiresAt time.Time `json:"expires_at"`
 }
 
 type URL string
@@ -51,11 +111,17 @@ func (u URL) MarshalJSON() ([]byte, error) {
 		return json.Marshal("")
 	}
 
+	// signed URLs carry their query string; only the filename is escaped
+	query := ""
+	if i := strings.IndexByte(urlStr, '?'); i >= 0 {
+		urlStr, query = urlStr[:i], urlStr[i:]
+	}
+
 	dir, filename := filepath.Split(urlStr)
 
 	escapedFilename := url.PathEscape(filename)
 
-	result := dir + escapedFilename
+	result := dir + escapedFilename + query
 
 	return json.Marshal(result)
 }
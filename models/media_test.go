@@ -0,0 +1,27 @@
+package models
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestURLMarshalJSONKeepsQuery(t *testing.T) {
+	cases := map[URL]string{
+		"https://cdn.example.com/files/my resume.pdf":                        "https://cdn.example.com/files/my%20resume.pdf",
+		"https://bucket.s3.amazonaws.com/a/b.pdf?X-Amz-Credential=k%2Fd&X=1": "https://bucket.s3.amazonaws.com/a/b.pdf?X-Amz-Credential=k%2Fd&X=1",
+		"": "",
+	}
+	for in, want := range cases {
+		raw, err := json.Marshal(in)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := ""
+		if err := json.Unmarshal(raw, &got); err != nil {
+			t.Fatal(err)
+		}
+		if got != want {
+			t.Errorf("Marshal(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
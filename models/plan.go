@@ -0,0 +1,98 @@
+package models
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+// Entitlement names something a subscription plan grants.
+type Entitlement string
+
+const (
+	// EntitlementChatAccess unlocks every hire chat while subscribed; any
+	// non-zero value grants it. This is what SUBSCRIBED meant before plans.
+	EntitlementChatAccess Entitlement = "CHAT_ACCESS"
+
+	// EntitlementMonthlyChatUnlocks is the number of chats the recruiter may
+	// unlock per calendar month (UTC) before falling back to tickets.
+	EntitlementMonthlyChatUnlocks Entitlement = "MONTHLY_CHAT_UNLOCKS"
+
+	// EntitlementActivePosts is the number of posts the user may have open
+	// at once. Posts live outside the SDK; callers check it themselves.
+	EntitlementActivePosts Entitlement = "ACTIVE_POSTS"
+)
+
+// EntitlementUnlimited is the limit of an entitlement without a quota.
+const EntitlementUnlimited = -1
+
+// Entitlements maps each entitlement a plan grants to its limit. A missing
+// entitlement is not granted.
+type Entitlements map[Entitlement]int
+
+// legacyEntitlements is what a subscription without a plan grants.
+var legacyEntitlements = Entitlements{EntitlementChatAccess: EntitlementUnlimited}
+
+// Limit returns the limit of e, 0 if it isn't granted.
+func (es Entitlements) Limit(e Entitlement) int {
+	return es[e]
+}
+
+// Allows reports whether a user who already used `used` of e may use one
+// more.
+func (es Entitlements) Allows(e Entitlement, used int) bool {
+	limit := es[e]
+	return limit == EntitlementUnlimited || used < limit
+}
+
+// Value implements the driver.Valuer interface for inserting as jsonb
+func (es Entitlements) Value() (driver.Value, error) {
+	return json.Marshal(es)
+}
+
+// Scan implements the sql.Scanner interface for reading jsonb
+func (es *Entitlements) Scan(value interface{}) error {
+	if value == nil {
+		return nil
+	}
+	bytes, ok := value.([]byte)
+	if !ok {
+		return errors.New("type assertion to []byte failed")
+	}
+	return json.Unmarshal(bytes, es)
+}
+
+// Plan is a subscription tier of an app.
+type Plan struct {
+	ID           string       `json:"id" db:"id"`
+	AppID        string       `json:"-" db:"app_id"`
+	Name         string       `json:"name" db:"name"`
+	Entitlements Entitlements `json:"entitlements" db:"entitlements"`
+
+	// ProductIDs are the store product IDs that subscribe to this plan; a
+	// verified receipt for one of them moves the user onto the plan.
+	ProductIDs []string  `json:"-" db:"product_ids"`
+	CreatedAt  time.Time `json:"-" db:"created_at"`
+	UpdatedAt  time.Time `json:"-" db:"updated_at"`
+}
+
+// EntitlementsAt returns what the subscription grants at now under plan,
+// the plan s.PlanID refers to (nil when s has none). Inactive subscriptions
+// grant nothing; active ones without a plan keep the pre-plan behavior of
+// unlocking every chat.
+func (s *UserSubscription) EntitlementsAt(now time.Time, plan *Plan) Entitlements {
+	if !s.IsSubscribedAt(now) {
+		return Entitlements{}
+	}
+	if plan == nil {
+		return legacyEntitlements
+	}
+	return plan.Entitlements
+}
+
+// EntitlementPeriod returns the usage period quotas like
+// EntitlementMonthlyChatUnlocks are counted in, e.g. "2026-10".
+func EntitlementPeriod(now time.Time) string {
+	return now.UTC().Format("2006-01")
+}
@@ -0,0 +1,42 @@
+package models
+
+import (
+	"testing"
+	"time"
+)
+
+func TestEntitlementsAt(t *testing.T) {
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	later, earlier := now.Add(time.Hour), now.Add(-time.Hour)
+	basic := &Plan{ID: "basic", Entitlements: Entitlements{EntitlementMonthlyChatUnlocks: 5, EntitlementActivePosts: 1}}
+
+	active := &UserSubscription{Status: SubscriptionSubscribed, ExpiresAt: &later}
+	if got := active.EntitlementsAt(now, nil); !got.Allows(EntitlementChatAccess, 1000) {
+		t.Errorf("a subscription without a plan should keep unlimited chat access, got %v", got)
+	}
+
+	got := active.EntitlementsAt(now, basic)
+	if got.Allows(EntitlementChatAccess, 0) {
+		t.Error("basic plan should not open every chat")
+	}
+	if !got.Allows(EntitlementMonthlyChatUnlocks, 4) || got.Allows(EntitlementMonthlyChatUnlocks, 5) {
+		t.Errorf("monthly chat unlocks should allow 5, got limit %d", got.Limit(EntitlementMonthlyChatUnlocks))
+	}
+
+	expired := &UserSubscription{Status: SubscriptionSubscribed, ExpiresAt: &earlier}
+	if got := expired.EntitlementsAt(now, basic); got.Allows(EntitlementActivePosts, 0) || got.Allows(EntitlementChatAccess, 0) {
+		t.Errorf("an expired subscription should grant nothing, got %v", got)
+	}
+	var never *UserSubscription
+	if got := never.EntitlementsAt(now, nil); len(got) != 0 {
+		t.Errorf("no subscription should grant nothing, got %v", got)
+	}
+}
+
+func TestEntitlementPeriod(t *testing.T) {
+	// 07:30 on 1 November in Taipei is still October in UTC
+	taipei := time.FixedZone("Asia/Taipei", 8*60*60)
+	if got := EntitlementPeriod(time.Date(2026, 11, 1, 7, 30, 0, 0, taipei)); got != "2026-10" {
+		t.Errorf("EntitlementPeriod() = %q, want 2026-10", got)
+	}
+}
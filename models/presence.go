@@ -0,0 +1,28 @@
+package models
+
+import "time"
+
+type PresenceEventType string
+
+const (
+	PresenceTyping PresenceEventType = "TYPING" // the user is typing in ChatID until ExpiresAt
+	PresenceActive PresenceEventType = "ACTIVE" // the user was active at At
+)
+
+// PresenceEvent is an ephemeral change in what a user is doing. Typing
+// implies being active.
+type PresenceEvent struct {
+	AppID     string            `json:"-"`
+	Type      PresenceEventType `json:"type"`
+	UserID    string            `json:"user_id"`
+	ChatID    string            `json:"chat_id,omitempty"`
+	At        time.Time         `json:"at"`
+	ExpiresAt *time.Time        `json:"expires_at,omitempty"`
+}
+
+// Presence is what the other party of a chat sees of a user.
+type Presence struct {
+	IsOnline     bool       `json:"is_online"`
+	IsTyping     bool       `json:"is_typing"`
+	LastActiveAt *time.Time `json:"last_active_at"`
+}
@@ -0,0 +1,148 @@
+package models
+
+import "time"
+
+// UserDataExportVersion is the format version of UserDataExport; bump it
+// whenever a field changes meaning or goes away.
+const UserDataExportVersion = 1
+
+// UserDataExport is everything the SDK holds about a user of an app, as
+// handed out for a data subject access request. Media lists every file
+// referenced by the user's messages, sent or scheduled. MessageTemplates
+// holds only the templates the user owns, not the app's shared ones.
+type UserDataExport struct {
+	FormatVersion int       `json:"format_version"`
+	AppID         string    `json:"app_id"`
+	UserID        string    `json:"user_id"`
+	ExportedAt    time.Time `json:"exported_at"`
+
+	Resume                *ExportedResume                 `json:"resume"`
+	ResumeSnapshots       []*ExportedResumeSnapshot       `json:"resume_snapshots"`
+	ResumeRelations       []*ExportedResumeRelation       `json:"resume_relations"`
+	BusinessCard          *ExportedBusinessCard           `json:"business_card"`
+	BusinessCardSnapshots []*ExportedBusinessCardSnapshot `json:"business_card_snapshots"`
+	Chats                 []*ExportedChat                 `json:"chats"`
+	Messages              []*ExportedMessage              `json:"messages"`
+	Reactions             []*ExportedReaction             `json:"reactions"`
+	ScheduledMessages     []*ScheduledMessage             `json:"scheduled_messages"`
+	MessageTemplates      []*MessageTemplate              `json:"message_templates"`
+	Media                 []*ExportedMedia                `json:"media"`
+	Subscription          *UserSubscription               `json:"subscription"`
+	SubscriptionEvents    []*SubscriptionEvent            `json:"subscription_events"`
+	Consents              []*ConsentEvent                 `json:"consents"`
+}
+
+type ExportedResume struct {
+	Content   *ResumeContent `json:"content"`
+	CreatedAt time.Time      `json:"created_at"`
+	UpdatedAt time.Time      `json:"updated_at"`
+}
+
+type ExportedResumeSnapshot struct {
+	ID        string         `json:"id"`
+	Content   *ResumeContent `json:"content"`
+	CreatedAt time.Time      `json:"created_at"`
+}
+
+// ExportedResumeRelation is a resume the user sent to a post.
+type ExportedResumeRelation struct {
+	SnapshotID *string      `json:"snapshot_id"`
+	PostID     string       `json:"post_id"`
+	ChatID     string       `json:"chat_id"`
+	Status     ResumeStatus `json:"status"`
+	IsRead     bool         `json:"is_read"`
+	CreatedAt  time.Time    `json:"created_at"`
+}
+
+type ExportedBusinessCard struct {
+	Content   *BusinessCardContent `json:"content"`
+	CreatedAt time.Time            `json:"created_at"`
+	UpdatedAt time.Time            `json:"updated_at"`
+}
+
+type ExportedBusinessCardSnapshot struct {
+	ID        string               `json:"id"`
+	Content   *BusinessCardContent `json:"content"`
+	CreatedAt time.Time            `json:"created_at"`
+}
+
+// ExportedChat is one of the user's chat threads.
+type ExportedChat struct {
+	ChatID      string         `json:"chat_id"`
+	PeerID      string         `json:"peer_id"`
+	PostID      *string        `json:"post_id"`
+	Status      ChatAnnotation `json:"status"`
+	HireContact *HireContact   `json:"hire_contact"`
+	CreatedAt   time.Time      `json:"created_at"`
+}
+
+// ExportedMessage is a message the user sent.
+type ExportedMessage struct {
+	ID               string        `json:"message_id"`
+	ChatID           string        `json:"chat_id"`
+	Type             string        `json:"type"`
+	Status           MessageStatus `json:"status"`
+	Body             *string       `json:"body,omitempty"`
+	MediaIDs         []string      `json:"media_ids,omitempty"`
+	ReplyToMessageID *string       `json:"reply_to_message_id,omitempty"`
+	ReferenceID      *string       `json:"reference_id,omitempty"`
+	CreatedAt        time.Time     `json:"created_at"`
+}
+
+// ExportedReaction is an emoji reaction the user left on a message.
+type ExportedReaction struct {
+	MessageID string    `json:"message_id" db:"message_id"`
+	Emoji     string    `json:"emoji" db:"emoji"`
+	CreatedAt time.Time `json:"created_at" db:"created_at"`
+}
+
+// ExportedMedia references a file the user sent. URL is a signed download
+// URL for media in the blob store.
+type ExportedMedia struct {
+	ID          string     `json:"id"`
+	Type        MediaType  `json:"type"`
+	URL         URL        `json:"url"`
+	ContentType *string    `json:"content_type,omitempty"`
+	SizeBytes   *int64     `json:"size_bytes,omitempty"`
+	ExpiredAt   *time.Time `json:"expired_at,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+}
+
+// ResumePIIFields are the resume content fields that identify the user or
+// reach them. Erasure removes them from the snapshots recruiters still hold
+// and keeps the rest, so a recruiter's chat keeps showing what was applied
+// with.
+var ResumePIIFields = []string{
+	"real_name",
+	"email",
+	"phone_number",
+	"contact_times",
+	"gender",
+	"birth_year",
+	"alma_mater",
+	"year_of_graduation",
+	"current_organization",
+	"certificate",
+	"special_requirement",
+}
+
+// BusinessCardPIIFields are the business card content fields that identify
+// the user.
+var BusinessCardPIIFields = []string{
+	"real_name",
+	"current_organization",
+}
+
+// ErasureReport counts the rows an account erasure touched.
+type ErasureReport struct {
+	Resumes               int `json:"resumes"`
+	ResumeSnapshots       int `json:"resume_snapshots"`
+	BusinessCards         int `json:"business_cards"`
+	BusinessCardSnapshots int `json:"business_card_snapshots"`
+	ChatThreads           int `json:"chat_threads"`
+	Messages              int `json:"messages"`
+	Reactions             int `json:"reactions"`
+	ScheduledMessages     int `json:"scheduled_messages"`
+	MessageTemplates      int `json:"message_templates"`
+	Media                 int `json:"media"`
+}
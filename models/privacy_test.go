@@ -0,0 +1,32 @@
+package models
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func jsonFields(v interface{}) map[string]bool {
+	fields := map[string]bool{}
+	t := reflect.TypeOf(v)
+	for i := 0; i < t.NumField(); i++ {
+		name, _, _ := strings.Cut(t.Field(i).Tag.Get("json"), ",")
+		fields[name] = true
+	}
+	return fields
+}
+
+func TestPIIFieldsExist(t *testing.T) {
+	resume := jsonFields(ResumeContent{})
+	for _, f := range ResumePIIFields {
+		if !resume[f] {
+			t.Errorf("ResumePIIFields: %q isn't a resume content field", f)
+		}
+	}
+	card := jsonFields(BusinessCardContent{})
+	for _, f := range BusinessCardPIIFields {
+		if !card[f] {
+			t.Errorf("BusinessCardPIIFields: %q isn't a business card content field", f)
+		}
+	}
+}
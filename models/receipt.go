@@ -0,0 +1,73 @@
+package models
+
+import "time"
+
+// StorePlatform identifies the app store a purchase was made in.
+type StorePlatform string
+
+const (
+	StoreAppStore  StorePlatform = "APP_STORE"
+	StorePlayStore StorePlatform = "PLAY_STORE"
+)
+
+// Receipt is a raw, unverified store notification as received by the
+// webhook endpoint.
+type Receipt struct {
+	Platform StorePlatform
+
+	// Payload is the request body: {"signedPayload": "..."} for App Store
+	// Server Notifications V2, or the Pub/Sub push envelope
+	// {"message": {"data": "...", "messageId": "..."}} for Play RTDN.
+	Payload []byte
+
+	// Authorization is the Authorization header of the Pub/Sub push
+	// ("Bearer <OIDC token>"). Only used for the Play Store.
+	Authorization string
+}
+
+// StoreTransaction is the verified subscription state a receipt describes.
+type StoreTransaction struct {
+	Platform StorePlatform `db:"platform"`
+
+	// NotificationID identifies the delivery (Apple notificationUUID, Pub/Sub
+	// messageId); retries of the same delivery share it.
+	NotificationID   string `db:"notification_id"`
+	NotificationType string `db:"notification_type"`
+
+	// BundleID is the App Store bundle ID or the Play package name.
+	BundleID  string `db:"bundle_id"`
+	ProductID string `db:"product_id"`
+
+	TransactionID string `db:"transaction_id"`
+	// OriginalTransactionID stays the same across renewals; it ties every
+	// renewal of a subscription to the user who first bought it.
+	OriginalTransactionID string `db:"original_transaction_id"`
+
+	ExpiresAt *time.Time `db:"expires_at"`
+	RevokedAt *time.Time `db:"revoked_at"`
+}
+
+// StatusAt derives the subscription status and expiry the transaction grants
+// at now. Revoked (refunded) and lapsed transactions grant nothing.
+func (t *StoreTransaction) StatusAt(now time.Time) (SubscriptionStatus, *time.Time) {
+	if t.RevokedAt != nil || t.ExpiresAt == nil || !now.Before(*t.ExpiresAt) {
+		return SubscriptionNone, nil
+	}
+	expiresAt := *t.ExpiresAt
+	return SubscriptionSubscribed, &expiresAt
+}
+
+// ApplyTo derives the status and expiry current (nil when the user has no
+// subscription yet) moves to at now. It returns false when the transaction
+// changes nothing: an older delivery arriving after one that expires later.
+// The free option is granted outside the stores and is kept.
+func (t *StoreTransaction) ApplyTo(current *UserSubscription, now time.Time) (SubscriptionStatus, *time.Time, bool) {
+	status, expiresAt := t.StatusAt(now)
+	if current == nil {
+		return status, expiresAt, true
+	}
+	if t.RevokedAt == nil && current.IsSubscribedAt(now) && (expiresAt == nil || current.ExpiresAt.After(*expiresAt)) {
+		return current.Status, current.ExpiresAt, false
+	}
+	return status | current.Status&SubOptionFree, expiresAt, true
+}
@@ -66,34 +66,9 @@ const (
 	YearOfExperienceMoreThanTen
 )
 
+// Chinese is the zh-TW shortcut for Label.
 func (y YearOfExperienceType) Chinese() string {
-	switch y {
-	case YearOfExperienceNone:
-		return "無經驗"
-	case YearOfExperienceLessThanOne:
-		return "1年以下"
-	case YearOfExperienceOneToTwo:
-		return "1年 ~ 2年"
-	case YearOfExperienceTwoToThree:
-		return "2年 ~ 3年"
-	case YearOfExperienceThreeToFour:
-		return "3年 ~ 4年"
-	case YearOfExperienceFourToFive:
-		return "4年 ~ 5年"
-	case YearOfExperienceFiveToSix:
-		return "5年 ~ 6年"
-	case YearOfExperienceSixToSeven:
-		return "6年 ~ 7年"
-	case YearOfExperienceSevenToEight:
-		return "7年 ~ 8年"
-	case YearOfExperienceEightToNine:
-		return "8年 ~ 9年"
-	case YearOfExperienceNineToTen:
-		return "9年 ~ 10年"
-	case YearOfExperienceMoreThanTen:
-		return "10年以上"
-	}
-	return ""
+	return y.Label(LocaleZhTW)
 }
 
 // ValidateYearOfExperience reports whether y is one of the defined ordinals.
@@ -127,30 +102,9 @@ const (
 	CollaborationType_ProductExperience                          // 產品體驗
 )
 
+// Chinese is the zh-TW shortcut for Label.
 func (c CollaborationType) Chinese() string {
-	switch c {
-	case CollaborationType_FullTime:
-		return "全職"
-	case CollaborationType_PartTime:
-		return "兼職"
-	case CollaborationType_Attending:
-		return "掛牌"
-	case CollaborationType_Lecturer:
-		return "講座講師"
-	case CollaborationType_Prescription:
-		return "業配"
-	case CollaborationType_Endorsement:
-		return "代言"
-	case CollaborationType_Telemedicine:
-		return "遠距醫療"
-	case CollaborationType_MarketResearch:
-		return "市調訪談"
-	case CollaborationType_AcademicEditing:
-		return "學術編輯"
-	case CollaborationType_ProductExperience:
-		return "產品體驗"
-	}
-	return ""
+	return c.Label(LocaleZhTW)
 }
 
 type Resume struct {
@@ -173,7 +127,7 @@ type ResumeRelation struct {
 	ID         string       `json:"-" db:"id"`
 	AppID      string       `json:"-" db:"app_id"`
 	UserID     string       `json:"-" db:"user_id"`
-	SnapshotID string       `json:"-" db:"snapshot_id"`
+	SnapshotID *string      `json:"-" db:"snapshot_id"` // nil once retention purged the snapshot
 	PostID     string       `json:"-" db:"post_id"`
 	ChatID     string       `json:"-" db:"chat_id"`
 	IsRead     bool         `json:"-" db:"is_read"`
@@ -253,6 +207,7 @@ func ByPostID(postID string) GetRelationOptionFunc {
 type ListRelationOption struct {
 	After   *time.Time
 	ChatIDs []string
+	UserID  *string
 }
 type ListRelationOptionFunc func(*ListRelationOption) error
 
@@ -269,3 +224,11 @@ func ByChatIDs(chatIDs []string) ListRelationOptionFunc {
 		return nil
 	}
 }
+
+// ByApplicant lists the relations of the resumes userID sent.
+func ByApplicant(userID string) ListRelationOptionFunc {
+	return func(opt *ListRelationOption) error {
+		opt.UserID = &userID
+		return nil
+	}
+}
@@ -0,0 +1,54 @@
+package models
+
+import "time"
+
+// RetentionPolicy is how long an app keeps chat data. A zero field keeps
+// that data forever.
+type RetentionPolicy struct {
+	// MessageMonths purges the messages of chats without activity for that
+	// many months.
+	MessageMonths int `json:"message_months,omitempty"`
+
+	// SnapshotMonths purges the resume snapshots of relations older than
+	// that many months, and business card snapshots as old, once the chat
+	// they were sent in is gone (deleted or purged of its messages).
+	SnapshotMonths int `json:"snapshot_months,omitempty"`
+}
+
+// MessageCutoff returns the last activity before which a chat's messages
+// are purged, and false when messages are kept forever.
+func (p *RetentionPolicy) MessageCutoff(now time.Time) (time.Time, bool) {
+	if p == nil || p.MessageMonths <= 0 {
+		return time.Time{}, false
+	}
+	return now.AddDate(0, -p.MessageMonths, 0), true
+}
+
+// SnapshotCutoff returns the creation time before which snapshots of gone
+// chats are purged, and false when snapshots are kept forever.
+func (p *RetentionPolicy) SnapshotCutoff(now time.Time) (time.Time, bool) {
+	if p == nil || p.SnapshotMonths <= 0 {
+		return time.Time{}, false
+	}
+	return now.AddDate(0, -p.SnapshotMonths, 0), true
+}
+
+// RetentionReport counts what a retention run purged, or would purge on a
+// dry run.
+type RetentionReport struct {
+	AppID                 string    `json:"app_id"`
+	DryRun                bool      `json:"dry_run"`
+	RanAt                 time.Time `json:"ran_at"`
+	Messages              int       `json:"messages"`
+	ResumeSnapshots       int       `json:"resume_snapshots"`
+	BusinessCardSnapshots int       `json:"business_card_snapshots"`
+}
+
+// LegalHold exempts a user's data from retention purges, e.g. while a
+// dispute is pending.
+type LegalHold struct {
+	AppID     string    `json:"-" db:"app_id"`
+	UserID    string    `json:"user_id" db:"user_id"`
+	Reason    string    `json:"reason" db:"reason"`
+	CreatedAt time.Time `json:"created_at" db:"created_at"`
+}
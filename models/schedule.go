@@ -0,0 +1,64 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// scheduledMessageSpace is the UUID namespace of the messages scheduled
+// messages are sent as.
+var scheduledMessageSpace = uuid.MustParse("5b0f3f5e-8f3c-4c2e-9d7a-1c6f2a4e9b10")
+
+type ScheduledMessageStatus string
+
+const (
+	ScheduledPending  ScheduledMessageStatus = "PENDING"  // waiting for SendAt, can still be edited or canceled
+	ScheduledSending  ScheduledMessageStatus = "SENDING"  // claimed by a dispatcher
+	ScheduledSent     ScheduledMessageStatus = "SENT"     // delivered as MessageID
+	ScheduledCanceled ScheduledMessageStatus = "CANCELED" // canceled by the sender
+	ScheduledFailed   ScheduledMessageStatus = "FAILED"   // could not be sent at SendAt, see Error
+)
+
+// ScheduledMessage is a message a user wrote to be sent to a chat later.
+type ScheduledMessage struct {
+	ID               string                 `json:"id" db:"id"`
+	AppID            string                 `json:"-" db:"app_id"`
+	ChatID           string                 `json:"chat_id" db:"chat_id"`
+	SenderID         string                 `json:"-" db:"sender_id"`
+	SendAt           time.Time              `json:"send_at" db:"send_at" example:"2024-10-01T04:00:00Z"`
+	Type             MessageType            `json:"type" db:"type"`
+	Body             *string                `json:"body,omitempty" db:"body"`
+	MediaIDs         []string               `json:"media_ids,omitempty" db:"media_ids"`
+	ReplyToMessageID *string                `json:"reply_to_message_id,omitempty" db:"reply_to_message_id"`
+	Status           ScheduledMessageStatus `json:"status" db:"status"`
+	MessageID        *string                `json:"message_id,omitempty" db:"message_id"`
+	Error            *string                `json:"error,omitempty" db:"error"`
+	CreatedAt        time.Time              `json:"created_at" db:"created_at"`
+	UpdatedAt        time.Time              `json:"updated_at" db:"updated_at"`
+}
+
+// SentMessageID returns the ID m is sent as. It is the same for every
+// attempt, so a message sent twice by dispatchers racing on a lapsed claim
+// is only added once.
+func (m *ScheduledMessage) SentMessageID() string {
+	return uuid.NewSHA1(scheduledMessageSpace, []byte(m.ID)).String()
+}
+
+// SendOption returns what SendMessage would be given to send m now.
+func (m *ScheduledMessage) SendOption() *SendOption {
+	return &SendOption{
+		Type:             m.Type,
+		Body:             m.Body,
+		MediaIDs:         m.MediaIDs,
+		ReplyToMessageID: m.ReplyToMessageID,
+	}
+}
+
+// DispatchReport counts the scheduled messages one dispatch run handled.
+type DispatchReport struct {
+	AppID  string    `json:"app_id"`
+	RanAt  time.Time `json:"ran_at"`
+	Sent   int       `json:"sent"`
+	Failed int       `json:"failed"`
+}
@@ -42,4 +42,76 @@ type UserSubscription struct {
 	ExpiresAt *time.Time         `json:"expires_at" db:"expires_at"`
 	CreatedAt time.Time          `json:"-" db:"created_at"`
 	UpdatedAt time.Time          `json:"-" db:"updated_at"`
+
+	// PlanID is the plan the user is subscribed to; nil for subscriptions
+	// from before plans existed. See EntitlementsAt.
+	PlanID *string `json:"plan_id" db:"plan_id"`
+
+	// Entitlements is filled in by the service with what the subscription
+	// grants right now.
+	Entitlements Entitlements `json:"entitlements" db:"-"`
+}
+
+// StatusAt returns the status as of now: a SUBSCRIBED flag whose expiry has
+// passed (or was never set) is downgraded to SubscriptionNone. This is the
+// single definition of "is subscribed now" shared by every service.
+func (s *UserSubscription) StatusAt(now time.Time) SubscriptionStatus {
+	if s == nil {
+		return SubscriptionNever
+	}
+	status := s.Status
+	if status.HasOneOf(SubscriptionSubscribed) && (s.ExpiresAt == nil || !now.Before(*s.ExpiresAt)) {
+		status = (status &^ SubscriptionSubscribed) | SubscriptionNone
+	}
+	return status
+}
+
+// IsSubscribedAt reports whether the subscription is active at now.
+func (s *UserSubscription) IsSubscribedAt(now time.Time) bool {
+	return s.StatusAt(now).HasOneOf(SubscriptionSubscribed)
+}
+
+// SubscriptionEventType classifies a row of the subscription history.
+type SubscriptionEventType string
+
+const (
+	SubscriptionEventPurchased SubscriptionEventType = "PURCHASED" // not subscribed → subscribed
+	SubscriptionEventRenewed   SubscriptionEventType = "RENEWED"   // subscribed → subscribed with a later expiry
+	SubscriptionEventCancelled SubscriptionEventType = "CANCELLED" // subscribed → not subscribed before the expiry
+	SubscriptionEventExpired   SubscriptionEventType = "EXPIRED"   // moved to SubscriptionNone by the expiry sweeper
+	SubscriptionEventChanged   SubscriptionEventType = "CHANGED"   // anything else, e.g. a free-ticket flag change
+)
+
+// SubscriptionEvent is an append-only record of every change made to a
+// user_subscription row.
+type SubscriptionEvent struct {
+	ID            string                `json:"id" db:"id"`
+	AppID         string                `json:"-" db:"app_id"`
+	UserID        string                `json:"-" db:"user_id"`
+	Type          SubscriptionEventType `json:"type" db:"type"`
+	Status        SubscriptionStatus    `json:"status" db:"status"`
+	ExpiresAt     *time.Time            `json:"expires_at" db:"expires_at"`
+	PrevStatus    *SubscriptionStatus   `json:"prev_status" db:"prev_status"`
+	PrevExpiresAt *time.Time            `json:"prev_expires_at" db:"prev_expires_at"`
+	CreatedAt     time.Time             `json:"created_at" db:"created_at"`
+}
+
+// ClassifySubscriptionEvent derives the event type of replacing prev (nil
+// when the user has no row yet) with status and expiresAt at now.
+func ClassifySubscriptionEvent(prev *UserSubscription, status SubscriptionStatus, expiresAt *time.Time, now time.Time) SubscriptionEventType {
+	wasSubscribed := prev.IsSubscribedAt(now)
+	isSubscribed := status.HasOneOf(SubscriptionSubscribed)
+	switch {
+	case !wasSubscribed && isSubscribed:
+		return SubscriptionEventPurchased
+	case wasSubscribed && isSubscribed:
+		if expiresAt != nil && prev.ExpiresAt != nil && expiresAt.After(*prev.ExpiresAt) {
+			return SubscriptionEventRenewed
+		}
+		return SubscriptionEventChanged
+	case wasSubscribed && !isSubscribed:
+		return SubscriptionEventCancelled
+	default:
+		return SubscriptionEventChanged
+	}
 }
@@ -0,0 +1,84 @@
+package models
+
+import (
+	"testing"
+	"time"
+)
+
+func TestUserSubscriptionStatusAt(t *testing.T) {
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	later, earlier := now.Add(time.Hour), now.Add(-time.Hour)
+
+	cases := []struct {
+		name string
+		sub  *UserSubscription
+		want SubscriptionStatus
+	}{
+		{"no row", nil, SubscriptionNever},
+		{"active", &UserSubscription{Status: SubscriptionSubscribed, ExpiresAt: &later}, SubscriptionSubscribed},
+		{"expired", &UserSubscription{Status: SubscriptionSubscribed, ExpiresAt: &earlier}, SubscriptionNone},
+		{"expires exactly now", &UserSubscription{Status: SubscriptionSubscribed, ExpiresAt: &now}, SubscriptionNone},
+		{"missing expiry", &UserSubscription{Status: SubscriptionSubscribed}, SubscriptionNone},
+		{"expired keeps free ticket", &UserSubscription{Status: SubscriptionSubscribed | SubOptionFree, ExpiresAt: &earlier}, SubOptionFree | SubscriptionNone},
+		{"never", &UserSubscription{Status: SubscriptionNever}, SubscriptionNever},
+	}
+	for _, c := range cases {
+		if got := c.sub.StatusAt(now); got != c.want {
+			t.Errorf("%s: StatusAt() = %b, want %b", c.name, got, c.want)
+		}
+		if got, want := c.sub.IsSubscribedAt(now), c.want.HasOneOf(SubscriptionSubscribed); got != want {
+			t.Errorf("%s: IsSubscribedAt() = %v, want %v", c.name, got, want)
+		}
+	}
+}
+
+func TestClassifySubscriptionEvent(t *testing.T) {
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	month, twoMonths, past := now.AddDate(0, 1, 0), now.AddDate(0, 2, 0), now.AddDate(0, -1, 0)
+	active := &UserSubscription{Status: SubscriptionSubscribed, ExpiresAt: &month}
+	lapsed := &UserSubscription{Status: SubscriptionSubscribed, ExpiresAt: &past}
+
+	cases := []struct {
+		name      string
+		prev      *UserSubscription
+		status    SubscriptionStatus
+		expiresAt *time.Time
+		want      SubscriptionEventType
+	}{
+		{"first purchase", nil, SubscriptionSubscribed, &month, SubscriptionEventPurchased},
+		{"resubscribe after lapse", lapsed, SubscriptionSubscribed, &month, SubscriptionEventPurchased},
+		{"renewal", active, SubscriptionSubscribed, &twoMonths, SubscriptionEventRenewed},
+		{"same expiry", active, SubscriptionSubscribed, &month, SubscriptionEventChanged},
+		{"cancel", active, SubscriptionNone, nil, SubscriptionEventCancelled},
+		{"free ticket", nil, SubOptionFree, nil, SubscriptionEventChanged},
+	}
+	for _, c := range cases {
+		if got := ClassifySubscriptionEvent(c.prev, c.status, c.expiresAt, now); got != c.want {
+			t.Errorf("%s: got %s, want %s", c.name, got, c.want)
+		}
+	}
+}
+
+func TestStoreTransactionApplyTo(t *testing.T) {
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	month, twoMonths := now.AddDate(0, 1, 0), now.AddDate(0, 2, 0)
+	active := &UserSubscription{Status: SubscriptionSubscribed | SubOptionFree, ExpiresAt: &twoMonths}
+
+	cases := []struct {
+		name       string
+		txn        *StoreTransaction
+		current    *UserSubscription
+		wantStatus SubscriptionStatus
+		wantApply  bool
+	}{
+		{"first purchase", &StoreTransaction{ExpiresAt: &month}, nil, SubscriptionSubscribed, true},
+		{"older delivery", &StoreTransaction{ExpiresAt: &month}, active, active.Status, false},
+		{"refund keeps free ticket", &StoreTransaction{ExpiresAt: &month, RevokedAt: &now}, active, SubscriptionNone | SubOptionFree, true},
+	}
+	for _, c := range cases {
+		status, _, apply := c.txn.ApplyTo(c.current, now)
+		if status != c.wantStatus || apply != c.wantApply {
+			t.Errorf("%s: ApplyTo() = %b, %v; want %b, %v", c.name, status, apply, c.wantStatus, c.wantApply)
+		}
+	}
+}
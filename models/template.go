@@ -0,0 +1,112 @@
+package models
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// Variables a message template may use, written as {{real_name}} etc.
+const (
+	TemplateVarRealName     = "real_name"     // the applicant's name on their resume
+	TemplateVarPostTitle    = "post_title"    // the title of the chat's post
+	TemplateVarContactTimes = "contact_times" // when the applicant prefers to be contacted
+)
+
+const (
+	maxTemplateNameLength = 50
+	maxTemplateBodyLength = 2000
+)
+
+var templateVarPattern = regexp.MustCompile(`\{\{\s*([a-z_]+)\s*\}\}`)
+
+// MessageTemplate is a text message recruiters send over and over, with
+// variables filled in per chat when it is sent.
+type MessageTemplate struct {
+	ID        string    `json:"id" db:"id"`
+	AppID     string    `json:"-" db:"app_id"`
+	OwnerID   *string   `json:"owner_id,omitempty" db:"owner_id"` // nil for templates shared by the whole app
+	Name      string    `json:"name" db:"name" example:"感謝應徵"`
+	Body      string    `json:"body" db:"body" example:"{{real_name}} 您好，感謝應徵{{post_title}}，方便於{{contact_times}}致電嗎？"`
+	CreatedAt time.Time `json:"created_at" db:"created_at"`
+	UpdatedAt time.Time `json:"updated_at" db:"updated_at"`
+}
+
+// Variables returns the distinct variables used in the template body, in the
+// order they first appear.
+func (t *MessageTemplate) Variables() []string {
+	seen := map[string]bool{}
+	vars := []string{}
+	for _, match := range templateVarPattern.FindAllStringSubmatch(t.Body, -1) {
+		if name := match[1]; !seen[name] {
+			seen[name] = true
+			vars = append(vars, name)
+		}
+	}
+	return vars
+}
+
+// Validate checks the template has a name and a body of reasonable length
+// and uses only known variables.
+func (t *MessageTemplate) Validate() error {
+	name := strings.TrimSpace(t.Name)
+	if name == "" || utf8.RuneCountInString(name) > maxTemplateNameLength {
+		return ErrorWrongParams
+	}
+	if strings.TrimSpace(t.Body) == "" || utf8.RuneCountInString(t.Body) > maxTemplateBodyLength {
+		return ErrorWrongParams
+	}
+	for _, name := range t.Variables() {
+		switch name {
+		case TemplateVarRealName, TemplateVarPostTitle, TemplateVarContactTimes:
+		default:
+			return ErrorWrongParams
+		}
+	}
+	return nil
+}
+
+// Render fills the variables of the template body in with vars. Variables
+// without a value fail the whole render with a *TemplateVarsMissingError,
+// rather than sending a message with blanks in it.
+func (t *MessageTemplate) Render(vars map[string]string) (string, error) {
+	missing := []string{}
+	for _, name := range t.Variables() {
+		if vars[name] == "" {
+			missing = append(missing, name)
+		}
+	}
+	if len(missing) > 0 {
+		return "", &TemplateVarsMissingError{Vars: missing}
+	}
+	return templateVarPattern.ReplaceAllStringFunc(t.Body, func(placeholder string) string {
+		return vars[templateVarPattern.FindStringSubmatch(placeholder)[1]]
+	}), nil
+}
+
+// TemplateVarsMissingError is returned when a template uses variables that
+// have no value for the chat, e.g. the resume's name is masked until the
+// chat is unlocked.
+type TemplateVarsMissingError struct {
+	Vars []string
+}
+
+func (e *TemplateVarsMissingError) Error() string {
+	return fmt.Sprintf("template variables missing: %s", strings.Join(e.Vars, ", "))
+}
+
+func (e *TemplateVarsMissingError) Is(target error) bool {
+	return target == ErrorWrongParams
+}
+
+// FormatContactTimes renders contact times as the contact_times variable,
+// e.g. "星期一 09:00-18:00、星期三 13:00-17:00".
+func FormatContactTimes(times []ContactTime) string {
+	parts := make([]string, 0, len(times))
+	for _, t := range times {
+		parts = append(parts, fmt.Sprintf("%s %s-%s", t.DayOfWeek, t.StartTime, t.EndTime))
+	}
+	return strings.Join(parts, "、")
+}
@@ -0,0 +1,50 @@
+package models
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestMessageTemplateRender(t *testing.T) {
+	tmpl := &MessageTemplate{
+		Name: "thanks",
+		Body: "{{real_name}} 您好，感謝應徵{{ post_title }}。{{real_name}}方便於{{contact_times}}致電嗎？",
+	}
+	if err := tmpl.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	if vars := tmpl.Variables(); len(vars) != 3 || vars[0] != TemplateVarRealName || vars[1] != TemplateVarPostTitle || vars[2] != TemplateVarContactTimes {
+		t.Errorf("variables = %v", vars)
+	}
+
+	got, err := tmpl.Render(map[string]string{
+		TemplateVarRealName:     "王小明",
+		TemplateVarPostTitle:    "住院醫師",
+		TemplateVarContactTimes: FormatContactTimes([]ContactTime{{DayOfWeek: "星期一", StartTime: "09:00", EndTime: "12:00"}, {DayOfWeek: "星期三", StartTime: "13:00", EndTime: "17:00"}}),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "王小明 您好，感謝應徵住院醫師。王小明方便於星期一 09:00-12:00、星期三 13:00-17:00致電嗎？"; got != want {
+		t.Errorf("Render = %q, want %q", got, want)
+	}
+
+	_, err = tmpl.Render(map[string]string{TemplateVarPostTitle: "住院醫師"})
+	var missing *TemplateVarsMissingError
+	if !errors.As(err, &missing) || !errors.Is(err, ErrorWrongParams) {
+		t.Fatalf("Render without values: err = %v, want TemplateVarsMissingError", err)
+	}
+	if len(missing.Vars) != 2 || missing.Vars[0] != TemplateVarRealName || missing.Vars[1] != TemplateVarContactTimes {
+		t.Errorf("missing = %v", missing.Vars)
+	}
+
+	for _, bad := range []*MessageTemplate{
+		{Name: "", Body: "hi"},
+		{Name: "hi", Body: "  "},
+		{Name: "hi", Body: "hi {{salary}}"},
+	} {
+		if err := bad.Validate(); err != ErrorWrongParams {
+			t.Errorf("Validate(%+v) = %v, want ErrorWrongParams", bad, err)
+		}
+	}
+}
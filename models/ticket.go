@@ -0,0 +1,24 @@
+package models
+
+import "time"
+
+// TicketReason explains a movement in a user's one-time ticket balance.
+type TicketReason string
+
+const (
+	TicketReasonGrant      TicketReason = "GRANT"       // tickets bought or given to the user
+	TicketReasonUnlockChat TicketReason = "UNLOCK_CHAT" // a ticket spent on unlocking a chat
+	TicketReasonAdjust     TicketReason = "ADJUST"      // manual correction by an operator
+)
+
+// TicketLedgerEntry is one row of the append-only ticket ledger. The
+// balance is the sum of Delta over a user's entries.
+type TicketLedgerEntry struct {
+	ID        string       `json:"id" db:"id"`
+	AppID     string       `json:"-" db:"app_id"`
+	UserID    string       `json:"-" db:"user_id"`
+	Delta     int          `json:"delta" db:"delta"`
+	Reason    TicketReason `json:"reason" db:"reason"`
+	ChatID    *string      `json:"chat_id,omitempty" db:"chat_id"`
+	CreatedAt time.Time    `json:"created_at" db:"created_at"`
+}
@@ -2,11 +2,40 @@ package service
 
 import (
 	"context"
+	"database/sql"
+	"strings"
 
 	"github.com/A-pen-app/hire-sdk/models"
 	"github.com/A-pen-app/hire-sdk/store"
+	"github.com/A-pen-app/logging"
 )
 
+// AgreementPolicy lists the documents users must have accepted before they
+// can act, per role.
+type AgreementPolicy struct {
+	// All is required of every user, including those whose role can't be
+	// told, such as in chats without a post.
+	All       []models.DocumentType
+	Recruiter []models.DocumentType
+	JobSeeker []models.DocumentType
+}
+
+// roleUnknown is the role of a user who is neither the recruiter nor the job
+// seeker of a chat as far as the service can tell.
+const roleUnknown models.Role = -1
+
+// Documents returns the documents required of role.
+func (p AgreementPolicy) Documents(role models.Role) []models.DocumentType {
+	docs := append([]models.DocumentType{}, p.All...)
+	switch role {
+	case models.RoleRecruiter:
+		docs = append(docs, p.Recruiter...)
+	case models.RoleJobSeeker:
+		docs = append(docs, p.JobSeeker...)
+	}
+	return docs
+}
+
 type agreementService struct {
 	a  store.App
 	am store.Agreement
@@ -16,20 +45,121 @@ func NewAgreement(a store.App, am store.Agreement) Agreement {
 	return &agreementService{a: a, am: am}
 }
 
-func (s *agreementService) Agree(ctx context.Context, bundleID, userID, version string) error {
+// Agree records the user's acceptance of a document with the client's
+// evidence. Only the version in force can be accepted, and a document hash
+// in the evidence must match the published one; otherwise it returns
+// ErrorWrongParams. Without a hash from the client the published hash is
+// recorded.
+func (s *agreementService) Agree(ctx context.Context, bundleID, userID string, docType models.DocumentType, version string, evidence *models.ConsentEvidence) error {
 	app, err := s.a.GetByBundleID(ctx, bundleID)
 	if err != nil {
 		return err
 	}
 
-	return s.am.Agree(ctx, app.ID, userID, version)
+	record, err := s.am.Get(ctx, app.ID, userID, docType)
+	if err == sql.ErrNoRows {
+		return models.ErrorWrongParams
+	} else if err != nil {
+		return err
+	}
+	if record.VersionLatest != version {
+		return models.ErrorWrongParams
+	}
+
+	recorded := models.ConsentEvidence{}
+	if evidence != nil {
+		recorded = *evidence
+	}
+	if published := record.Latest.Hash; published != nil {
+		if recorded.DocumentHash == nil {
+			recorded.DocumentHash = published
+		} else if !strings.EqualFold(*recorded.DocumentHash, *published) {
+			return models.ErrorWrongParams
+		}
+	}
+
+	return s.am.Agree(ctx, app.ID, userID, docType, version, &recorded)
+}
+
+// Revoke withdraws the user's consent to a document, after which it is
+// pending again. It returns ErrorNotFound when the user hasn't agreed to it.
+func (s *agreementService) Revoke(ctx context.Context, bundleID, userID string, docType models.DocumentType, evidence *models.ConsentEvidence) error {
+	app, err := s.a.GetByBundleID(ctx, bundleID)
+	if err != nil {
+		return err
+	}
+
+	return s.am.Revoke(ctx, app.ID, userID, docType, evidence)
+}
+
+// History exports the user's full consent history, oldest first.
+func (s *agreementService) History(ctx context.Context, bundleID, userID string) ([]*models.ConsentEvent, error) {
+	app, err := s.a.GetByBundleID(ctx, bundleID)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.am.History(ctx, app.ID, userID)
+}
+
+// Get returns the user's agreement to docType, or ErrorNotFound when the app
+// has no such document.
+func (s *agreementService) Get(ctx context.Context, bundleID, userID string, docType models.DocumentType) (*models.AgreementRecord, error) {
+	app, err := s.a.GetByBundleID(ctx, bundleID)
+	if err != nil {
+		return nil, err
+	}
+
+	record, err := s.am.Get(ctx, app.ID, userID, docType)
+	if err == sql.ErrNoRows {
+		return nil, models.ErrorNotFound
+	}
+	return record, err
 }
 
-func (s *agreementService) Get(ctx context.Context, bundleID, userID string) (*models.AgreementRecord, error) {
+// Pending returns every document in force the user hasn't accepted the
+// latest version of, limited to types when given.
+func (s *agreementService) Pending(ctx context.Context, bundleID, userID string, types ...models.DocumentType) ([]*models.AgreementRecord, error) {
 	app, err := s.a.GetByBundleID(ctx, bundleID)
 	if err != nil {
+		logging.Errorw(ctx, "failed to get app by bundle ID", "err", err, "bundleID", bundleID)
 		return nil, err
 	}
 
-	return s.am.Get(ctx, app.ID, userID)
+	docs, err := s.am.LatestDocuments(ctx, app.ID)
+	if err != nil {
+		return nil, err
+	}
+	agreed, err := s.am.ListAgreed(ctx, app.ID, userID)
+	if err != nil {
+		return nil, err
+	}
+	return pendingAgreements(docs, agreed, types), nil
+}
+
+func pendingAgreements(docs []*models.AgreementDocument, agreed map[models.DocumentType]*models.AgreementRecord, types []models.DocumentType) []*models.AgreementRecord {
+	wanted := map[models.DocumentType]bool{}
+	for _, t := range types {
+		wanted[t] = true
+	}
+
+	pending := []*models.AgreementRecord{}
+	for _, doc := range docs {
+		if len(wanted) > 0 && !wanted[doc.Type] {
+			continue
+		}
+		record := &models.AgreementRecord{
+			DocumentType:  doc.Type,
+			VersionLatest: doc.Version,
+			Latest:        doc,
+		}
+		if r, ok := agreed[doc.Type]; ok {
+			record.VersionAgreed = r.VersionAgreed
+			record.AgreedAt = r.AgreedAt
+		}
+		if record.IsPending() {
+			pending = append(pending, record)
+		}
+	}
+	return pending
 }
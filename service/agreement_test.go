@@ -0,0 +1,197 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+
+	"github.com/A-pen-app/hire-sdk/models"
+)
+
+func TestPendingAgreements(t *testing.T) {
+	v1, v2 := "1", "2"
+	docs := []*models.AgreementDocument{
+		{Type: models.DocumentTerms, Version: v2},
+		{Type: models.DocumentPrivacy, Version: v1},
+		{Type: models.DocumentRecruiterTerms, Version: v1},
+	}
+	agreed := map[models.DocumentType]*models.AgreementRecord{
+		models.DocumentTerms:   {DocumentType: models.DocumentTerms, VersionAgreed: &v1},
+		models.DocumentPrivacy: {DocumentType: models.DocumentPrivacy, VersionAgreed: &v1},
+	}
+
+	pending := pendingAgreements(docs, agreed, nil)
+	if len(pending) != 2 || pending[0].DocumentType != models.DocumentTerms || pending[1].DocumentType != models.DocumentRecruiterTerms {
+		t.Fatalf("unexpected pending documents: %+v", pending)
+	}
+	if *pending[0].VersionAgreed != v1 || pending[0].VersionLatest != v2 {
+		t.Errorf("terms: agreed %v, latest %s", *pending[0].VersionAgreed, pending[0].VersionLatest)
+	}
+	if pending[1].VersionAgreed != nil {
+		t.Errorf("recruiter terms were never agreed to, got %v", *pending[1].VersionAgreed)
+	}
+
+	pending = pendingAgreements(docs, agreed, []models.DocumentType{models.DocumentPrivacy})
+	if len(pending) != 0 {
+		t.Errorf("privacy policy is up to date, got %+v", pending)
+	}
+}
+
+func TestAgreementDocumentURL(t *testing.T) {
+	doc := &models.AgreementDocument{URLs: models.LocalizedURLs{models.DefaultLocale: "https://example.com/terms"}}
+	if got := doc.URL("ja"); got != "https://example.com/terms" {
+		t.Errorf("URL(ja) = %q, want the default locale's URL", got)
+	}
+}
+
+// fakeAgreement is an Agreement whose pending documents are fixed.
+type fakeAgreement struct {
+	pending []*models.AgreementRecord
+}
+
+func (f *fakeAgreement) Agree(ctx context.Context, bundleID, userID string, docType models.DocumentType, version string, evidence *models.ConsentEvidence) error {
+	return nil
+}
+
+func (f *fakeAgreement) Revoke(ctx context.Context, bundleID, userID string, docType models.DocumentType, evidence *models.ConsentEvidence) error {
+	return nil
+}
+
+func (f *fakeAgreement) History(ctx context.Context, bundleID, userID string) ([]*models.ConsentEvent, error) {
+	return nil, nil
+}
+
+func (f *fakeAgreement) Get(ctx context.Context, bundleID, userID string, docType models.DocumentType) (*models.AgreementRecord, error) {
+	return nil, models.ErrorNotFound
+}
+
+func (f *fakeAgreement) Pending(ctx context.Context, bundleID, userID string, types ...models.DocumentType) ([]*models.AgreementRecord, error) {
+	docs := []*models.AgreementDocument{}
+	agreed := map[models.DocumentType]*models.AgreementRecord{}
+	for _, r := range f.pending {
+		docs = append(docs, &models.AgreementDocument{Type: r.DocumentType, Version: r.VersionLatest})
+	}
+	return pendingAgreements(docs, agreed, types), nil
+}
+
+func TestRequireAgreements(t *testing.T) {
+	ctx := context.Background()
+	s := &chatService{
+		agreements: &fakeAgreement{pending: []*models.AgreementRecord{
+			{DocumentType: models.DocumentRecruiterTerms, VersionLatest: "3"},
+		}},
+		policy: AgreementPolicy{
+			All:       []models.DocumentType{models.DocumentTerms},
+			Recruiter: []models.DocumentType{models.DocumentRecruiterTerms},
+		},
+	}
+
+	for _, role := range []models.Role{models.RoleJobSeeker, roleUnknown} {
+		if err := s.requireAgreements(ctx, "com.yoku.apen", "user", role); err != nil {
+			t.Errorf("role %d: err = %v, want nil", role, err)
+		}
+	}
+
+	err := s.requireAgreements(ctx, "com.yoku.apen", "user", models.RoleRecruiter)
+	required := &models.AgreementRequiredError{}
+	if !errors.As(err, &required) || !errors.Is(err, models.ErrorAgreementRequired) {
+		t.Fatalf("recruiter: err = %v, want an AgreementRequiredError", err)
+	}
+	if required.DocumentType != models.DocumentRecruiterTerms || required.Version != "3" {
+		t.Errorf("recruiter: required %s version %s", required.DocumentType, required.Version)
+	}
+
+	if err := (&chatService{}).requireAgreements(ctx, "com.yoku.apen", "user", models.RoleRecruiter); err != nil {
+		t.Errorf("without a gate: err = %v, want nil", err)
+	}
+}
+
+func TestNewChatRole(t *testing.T) {
+	postID := "post"
+	cases := []struct {
+		postID *string
+		opt    models.NewChatOption
+		want   models.Role
+	}{
+		{&postID, models.NewChatOption{RecruiterContact: &models.HireContact{}}, models.RoleRecruiter},
+		{&postID, models.NewChatOption{}, models.RoleJobSeeker},
+		{nil, models.NewChatOption{Card: &models.BusinessCardContent{}}, models.RoleJobSeeker},
+		{nil, models.NewChatOption{}, roleUnknown},
+	}
+	for i, c := range cases {
+		if got := newChatRole(c.postID, &c.opt); got != c.want {
+			t.Errorf("case %d: role = %d, want %d", i, got, c.want)
+		}
+	}
+}
+
+// fakeAgreementStore is a store.Agreement with one published document that
+// remembers the evidence of the last consent.
+type fakeAgreementStore struct {
+	doc      *models.AgreementDocument
+	evidence *models.ConsentEvidence
+}
+
+func (f *fakeAgreementStore) Agree(ctx context.Context, appID, userID string, docType models.DocumentType, version string, evidence *models.ConsentEvidence) error {
+	f.evidence = evidence
+	return nil
+}
+
+func (f *fakeAgreementStore) Revoke(ctx context.Context, appID, userID string, docType models.DocumentType, evidence *models.ConsentEvidence) error {
+	return models.ErrorNotFound
+}
+
+func (f *fakeAgreementStore) History(ctx context.Context, appID, userID string) ([]*models.ConsentEvent, error) {
+	return nil, nil
+}
+
+func (f *fakeAgreementStore) Get(ctx context.Context, appID, userID string, docType models.DocumentType) (*models.AgreementRecord, error) {
+	if docType != f.doc.Type {
+		return nil, sql.ErrNoRows
+	}
+	return &models.AgreementRecord{DocumentType: docType, VersionLatest: f.doc.Version, Latest: f.doc}, nil
+}
+
+func (f *fakeAgreementStore) ListAgreed(ctx context.Context, appID, userID string) (map[models.DocumentType]*models.AgreementRecord, error) {
+	return nil, nil
+}
+
+func (f *fakeAgreementStore) LatestDocuments(ctx context.Context, appID string) ([]*models.AgreementDocument, error) {
+	return []*models.AgreementDocument{f.doc}, nil
+}
+
+func (f *fakeAgreementStore) PublishDocument(ctx context.Context, doc *models.AgreementDocument) error {
+	return nil
+}
+
+func TestAgreeEvidence(t *testing.T) {
+	ctx := context.Background()
+	hash, ip := "ABC123", "203.0.113.7"
+	am := &fakeAgreementStore{doc: &models.AgreementDocument{Type: models.DocumentPrivacy, Version: "2", Hash: &hash}}
+	s := NewAgreement(fakeApps{"com.yoku.apen": {ID: "app", BundleID: "com.yoku.apen"}}, am)
+
+	if err := s.Agree(ctx, "com.yoku.apen", "user", models.DocumentPrivacy, "2", &models.ConsentEvidence{IP: &ip}); err != nil {
+		t.Fatalf("Agree: %v", err)
+	}
+	if *am.evidence.IP != ip || am.evidence.DocumentHash == nil || *am.evidence.DocumentHash != hash {
+		t.Errorf("recorded evidence %+v, want the client IP and the published hash", am.evidence)
+	}
+
+	other := "def456"
+	cases := []struct {
+		name     string
+		docType  models.DocumentType
+		version  string
+		evidence *models.ConsentEvidence
+	}{
+		{"old version", models.DocumentPrivacy, "1", nil},
+		{"unpublished document", models.DocumentTerms, "2", nil},
+		{"different text", models.DocumentPrivacy, "2", &models.ConsentEvidence{DocumentHash: &other}},
+	}
+	for _, c := range cases {
+		if err := s.Agree(ctx, "com.yoku.apen", "user", c.docType, c.version, c.evidence); err != models.ErrorWrongParams {
+			t.Errorf("%s: err = %v, want ErrorWrongParams", c.name, err)
+		}
+	}
+}
@@ -3,7 +3,8 @@ package service
 import (
 	"context"
 	"database/sql"
-	"strconv"
+	"errors"
+	"fmt"
 	"time"
 
 	"github.com/A-pen-app/hire-sdk/models"
@@ -18,17 +19,90 @@ type chatService struct {
 	m  store.Media
 	s  store.Subscription
 	bc store.BusinessCard
+	t  store.Ticket
+	p  store.Plan
+
+	media Media
+
+	agreements Agreement
+	policy     AgreementPolicy
+
+	readNotifier ReadNotifier
+	presence     store.Presence
+	scheduled    store.ScheduledMessage
+	templates    store.Template
+	posts        PostTitles
+
+	legacyMediaBefore time.Time
+}
+
+// ReadNotifier delivers read receipts to the sender of the messages read,
+// e.g. over a push or websocket channel.
+type ReadNotifier interface {
+	NotifyRead(ctx context.Context, receipt *models.ReadReceipt) error
+}
+
+// ChatOption configures the optional collaborators of the chat service.
+type ChatOption func(*chatService)
+
+// WithMediaSigner makes the chat service sign blob-backed media URLs through
+// ms whenever it fills in msg.Medias. Without it such media has no URL.
+func WithMediaSigner(ms Media) ChatOption {
+	return func(s *chatService) {
+		s.media = ms
+	}
+}
+
+// WithAgreementGate makes New and SendMessage refuse users who haven't
+// accepted the documents policy requires of their role, with an
+// *models.AgreementRequiredError.
+func WithAgreementGate(ag Agreement, policy AgreementPolicy) ChatOption {
+	return func(s *chatService) {
+		s.agreements = ag
+		s.policy = policy
+	}
+}
+
+// WithReadNotifier makes Read tell the other party of the chat that their
+// messages were read, through n.
+func WithReadNotifier(n ReadNotifier) ChatOption {
+	return func(s *chatService) {
+		s.readNotifier = n
+	}
 }
 
-func NewChat(c store.Chat, r store.Resume, a store.App, m store.Media, s store.Subscription, bc store.BusinessCard) Chat {
-	return &chatService{
+// WithPresence makes Get and GetChats show whether the other party is
+// online or typing on ChatRoom.Receiver.
+func WithPresence(p store.Presence) ChatOption {
+	return func(s *chatService) {
+		s.presence = p
+	}
+}
+
+// WithLegacyMediaBefore lets any sender attach media without a recorded
+// owner that was created before cutoff, the time the deployment started
+// recording uploaders. Without it, media without an owner can't be attached.
+func WithLegacyMediaBefore(cutoff time.Time) ChatOption {
+	return func(s *chatService) {
+		s.legacyMediaBefore = cutoff
+	}
+}
+
+func NewChat(c store.Chat, r store.Resume, a store.App, m store.Media, s store.Subscription, bc store.BusinessCard, t store.Ticket, p store.Plan, options ...ChatOption) Chat {
+	cs := &chatService{
 		c:  c,
 		r:  r,
 		a:  a,
 		m:  m,
 		s:  s,
 		bc: bc,
+		t:  t,
+		p:  p,
 	}
+	for _, option := range options {
+		option(cs)
+	}
+	return cs
 }
 
 func (s *chatService) New(ctx context.Context, bundleID, senderID, receiverID string, postID *string, options ...models.NewChatOptionFunc) (string, error) {
@@ -46,12 +120,18 @@ func (s *chatService) New(ctx context.Context, bundleID, senderID, receiverID st
 		return "", err
 	}
 
+	if err := s.requireAgreements(ctx, bundleID, senderID, newChatRole(postID, &opt)); err != nil {
+		return "", err
+	}
+
 	var chatOpts []models.GetChatIDOptionFunc
 	if opt.RecruiterContact != nil {
 		chatOpts = append(chatOpts, models.WithChatRecruiterContact(opt.RecruiterContact))
 	}
 	if opt.AccessStatus != nil {
 		chatOpts = append(chatOpts, models.WithChatAccessStatus(*opt.AccessStatus))
+	} else {
+		chatOpts = append(chatOpts, models.WithChatDefaultAccessStatus(app.Config.AccessStatusOrDefault()))
 	}
 
 	chatID, created, err := s.c.GetChatID(ctx, app.ID, senderID, receiverID, postID, chatOpts...)
@@ -95,11 +175,20 @@ func (s *chatService) New(ctx context.Context, bundleID, senderID, receiverID st
 			return "", err
 		}
 
-		// Create a relation: derive ResumeStatus from AccessStatus
-		resumeStatus := models.ResumeStatusLocked
-		if opt.AccessStatus != nil && *opt.AccessStatus == models.AccessStatusUnlocked {
-			resumeStatus = models.ResumeStatusUnlocked
+		// Create a relation: derive ResumeStatus from AccessStatus, falling back
+		// to whatever the chat ended up with (e.g. the app's default)
+		accessStatus := models.AccessStatusLocked
+		if opt.AccessStatus != nil {
+			accessStatus = *opt.AccessStatus
+		} else {
+			chat, err := s.c.Get(ctx, app.ID, chatID, senderID)
+			if err != nil {
+				logging.Errorw(ctx, "failed to get chat", "err", err, "appID", app.ID, "chatID", chatID, "senderID", senderID)
+				return "", err
+			}
+			accessStatus = chat.AccessStatus
 		}
+		resumeStatus := toResumeStatus(accessStatus)
 
 		if _, err := s.r.CreateRelation(ctx, app.ID, senderID, snapshot.ID, chatID, *postID, resumeStatus); err != nil {
 			logging.Errorw(ctx, "failed to create resume relation", "err", err, "snapshotID", snapshot.ID, "chatID", chatID, "postID", *postID)
@@ -192,33 +281,33 @@ func (s *chatService) Get(ctx context.Context, bundleID, chatID, userID string)
 			jobSeekerID = ownerMap[*chat.BusinessCardSnapshotID]
 		}
 
-		// AccessStatus: 求職方永遠 UNLOCKED，徵才方先看 DB 值、再看 subscription
+		// AccessStatus: 求職方永遠 UNLOCKED，徵才方先看 DB 值、再看方案權益
 		if userID == jobSeekerID {
 			chat.AccessStatus = models.AccessStatusUnlocked
 		} else if chat.AccessStatus != models.AccessStatusUnlocked {
-			subscription, err := s.s.Get(ctx, app.ID, userID)
-			if err != nil && err != sql.ErrNoRows {
-				logging.Errorw(ctx, "failed to get subscription", "err", err, "appID", app.ID, "userID", userID)
+			entitlements, err := entitlementsOf(ctx, s.s, s.p, app.ID, userID)
+			if err != nil {
 				return nil, err
 			}
-			if subscription != nil && subscription.Status.HasOneOf(models.SubscriptionSubscribed) {
+			if entitlements.Allows(models.EntitlementChatAccess, 0) {
 				chat.AccessStatus = models.AccessStatusUnlocked
 			}
 		}
 
-		// Resume snapshot
-		if relation != nil {
-			snapshot, err := s.r.GetSnapshot(ctx, relation.SnapshotID)
+		// Resume snapshot, unless retention purged it
+		if relation != nil && relation.SnapshotID != nil {
+			snapshot, err := s.r.GetSnapshot(ctx, *relation.SnapshotID)
 			if err != nil {
-				logging.Errorw(ctx, "failed to get resume snapshot", "err", err, "snapshotID", relation.SnapshotID)
+				logging.Errorw(ctx, "failed to get resume snapshot", "err", err, "snapshotID", *relation.SnapshotID)
 				return nil, err
 			}
 
+			status := toResumeStatus(chat.AccessStatus)
 			chat.ResumeSnapshot = &models.ChatResumeSnapshot{
 				ID:      snapshot.ID,
-				Content: snapshot.Content,
+				Content: app.Config.MaskResume(snapshot.Content, status),
 				IsRead:  relation.IsRead,
-				Status:  toResumeStatus(chat.AccessStatus),
+				Status:  status,
 			}
 		}
 
@@ -233,6 +322,12 @@ func (s *chatService) Get(ctx context.Context, bundleID, chatID, userID string)
 		}
 	}
 
+	if s.presence != nil {
+		if err := attachPresence(ctx, s.presence, app.ID, []*models.ChatRoom{chat}, time.Now()); err != nil {
+			logging.Errorw(ctx, "attach presence failed", "err", err, "chatID", chatID)
+		}
+	}
+
 	return chat, nil
 }
 
@@ -255,7 +350,12 @@ func (s *chatService) GetChats(ctx context.Context, bundleID, userID string, nex
 		}
 	}
 
-	chats, err := s.c.GetChats(ctx, app.ID, userID, next, count+1, opt.Status, opt.UnreadOnly, opt.IsOfficialRole)
+	after, err := models.ParseChatCursor(next)
+	if err != nil {
+		return nil, "", err
+	}
+
+	chats, err := s.c.GetChats(ctx, app.ID, userID, after, count+1, opt.Status, opt.UnreadOnly, opt.IsOfficialRole)
 	if err != nil {
 		logging.Errorw(ctx, "failed to get chats", "err", err, "appID", app.ID, "userID", userID)
 		return nil, "", err
@@ -301,29 +401,70 @@ func (s *chatService) GetChats(ctx context.Context, bundleID, userID string, nex
 		}
 	}
 
-	// Subscription: query once
-	var subscription *models.UserSubscription
+	// Entitlements: query once
+	chatAccess := false
 	if len(hireChatIDs) > 0 {
-		subscription, err = s.s.Get(ctx, app.ID, userID)
-		if err != nil && err != sql.ErrNoRows {
-			logging.Errorw(ctx, "failed to get subscription", "err", err, "appID", app.ID, "userID", userID)
+		// on error, fall back to the stored access status
+		if entitlements, err := entitlementsOf(ctx, s.s, s.p, app.ID, userID); err == nil {
+			chatAccess = entitlements.Allows(models.EntitlementChatAccess, 0)
+		}
+	}
+
+	// Last messages: one query for the messages, one for their media
+	lastMsgMap, err := s.lastMessages(ctx, userID, chats)
+	if err != nil {
+		logging.Errorw(ctx, "failed to get last messages", "err", err, "appID", app.ID, "userID", userID)
+	}
+
+	// Snapshots: one query per kind, covering both the chats and their last messages
+	var resumeSnapshotIDs, bcSnapshotIDsToList []string
+	for _, chat := range chats {
+		if chat.PostID == nil {
+			continue
+		}
+		if rel, ok := resumeRelationMap[chat.ChatID]; ok && rel.SnapshotID != nil {
+			resumeSnapshotIDs = append(resumeSnapshotIDs, *rel.SnapshotID)
+		}
+		if chat.BusinessCardSnapshotID != nil {
+			bcSnapshotIDsToList = append(bcSnapshotIDsToList, *chat.BusinessCardSnapshotID)
+		}
+	}
+	for _, msg := range lastMsgMap {
+		if msg.RefID == nil {
+			continue
+		}
+		switch msg.Type {
+		case models.MsgResume:
+			resumeSnapshotIDs = append(resumeSnapshotIDs, *msg.RefID)
+		case models.MsgBusinessCard:
+			bcSnapshotIDsToList = append(bcSnapshotIDsToList, *msg.RefID)
+		}
+	}
+	resumeSnapshotMap := map[string]*models.ResumeSnapshot{}
+	if len(resumeSnapshotIDs) > 0 {
+		snapshots, err := s.r.ListSnapshots(ctx, resumeSnapshotIDs)
+		if err != nil {
+			logging.Errorw(ctx, "failed to list resume snapshots", "err", err, "appID", app.ID)
+		}
+		for _, snapshot := range snapshots {
+			resumeSnapshotMap[snapshot.ID] = snapshot
+		}
+	}
+	bcSnapshotMap := map[string]*models.BusinessCardSnapshot{}
+	if len(bcSnapshotIDsToList) > 0 {
+		snapshots, err := s.bc.ListSnapshots(ctx, bcSnapshotIDsToList)
+		if err != nil {
+			logging.Errorw(ctx, "failed to list business card snapshots", "err", err, "appID", app.ID)
+		}
+		for _, snapshot := range snapshots {
+			bcSnapshotMap[snapshot.ID] = snapshot
 		}
 	}
-	isSubscribed := subscription != nil && subscription.Status.HasOneOf(models.SubscriptionSubscribed)
 
 	for i := range chats {
 		hireStatus := models.HireStatusInactive
 		chats[i].HireStatus = &hireStatus
 
-		if msgID := chats[i].LastMessageID; msgID != nil {
-			msg, err := s.aggregateLastMessage(ctx, userID, *msgID, true)
-			if err != nil {
-				logging.Errorw(ctx, "aggregate last message failed", "err", err, "msgID", *msgID)
-			} else {
-				chats[i].LastMessage = msg
-			}
-		}
-
 		if chats[i].PostID != nil {
 			// Determine job seeker: prefer resume relation, fall back to business card owner
 			jobSeekerID := ""
@@ -335,31 +476,53 @@ func (s *chatService) GetChats(ctx context.Context, bundleID, userID string, nex
 
 			if userID == jobSeekerID {
 				chats[i].AccessStatus = models.AccessStatusUnlocked
-			} else if chats[i].AccessStatus != models.AccessStatusUnlocked && isSubscribed {
+			} else if chats[i].AccessStatus != models.AccessStatusUnlocked && chatAccess {
 				chats[i].AccessStatus = models.AccessStatusUnlocked
 			}
+		}
+
+		if msgID := chats[i].LastMessageID; msgID != nil {
+			if msg, ok := lastMsgMap[*msgID]; ok {
+				if msg.RefID != nil {
+					switch msg.Type {
+					case models.MsgResume:
+						if snapshot, ok := resumeSnapshotMap[*msg.RefID]; ok {
+							// the preview is masked like the chat's resume
+							msg.Resume = app.Config.MaskResume(snapshot.Content, toResumeStatus(chats[i].AccessStatus))
+						}
+					case models.MsgBusinessCard:
+						if snapshot, ok := bcSnapshotMap[*msg.RefID]; ok {
+							msg.BusinessCard = snapshot.Content
+						}
+					}
+				}
+				chats[i].LastMessage = msg
+			}
+		}
 
+		if chats[i].PostID != nil {
 			// Resume
-			if relation, ok := resumeRelationMap[chats[i].ChatID]; ok {
-				snapshot, err := s.r.GetSnapshot(ctx, relation.SnapshotID)
-				if err != nil {
-					logging.Errorw(ctx, "get resume snapshot failed", "err", err, "snapshotID", relation.SnapshotID)
+			if relation, ok := resumeRelationMap[chats[i].ChatID]; ok && relation.SnapshotID != nil {
+				snapshot, ok := resumeSnapshotMap[*relation.SnapshotID]
+				if !ok {
+					logging.Errorw(ctx, "resume snapshot not found", "snapshotID", *relation.SnapshotID)
 					continue
 				}
 
+				status := toResumeStatus(chats[i].AccessStatus)
 				chats[i].ResumeSnapshot = &models.ChatResumeSnapshot{
 					ID:      snapshot.ID,
-					Content: snapshot.Content,
+					Content: app.Config.MaskResume(snapshot.Content, status),
 					IsRead:  relation.IsRead,
-					Status:  toResumeStatus(chats[i].AccessStatus),
+					Status:  status,
 				}
 			}
 
 			// Business card
 			if chats[i].BusinessCardSnapshotID != nil {
-				bcSnapshot, err := s.bc.GetSnapshot(ctx, *chats[i].BusinessCardSnapshotID)
-				if err != nil {
-					logging.Errorw(ctx, "get business card snapshot failed", "err", err, "snapshotID", *chats[i].BusinessCardSnapshotID)
+				bcSnapshot, ok := bcSnapshotMap[*chats[i].BusinessCardSnapshotID]
+				if !ok {
+					logging.Errorw(ctx, "business card snapshot not found", "snapshotID", *chats[i].BusinessCardSnapshotID)
 					continue
 				}
 				chats[i].BusinessCardSnapshot = bcSnapshot
@@ -370,12 +533,68 @@ func (s *chatService) GetChats(ctx context.Context, bundleID, userID string, nex
 	next = ""
 	n := len(chats)
 	if n > count {
-		next = strconv.FormatInt(chats[count-1].UpdatedAt.Unix(), 10)
+		last := chats[count-1]
+		next = models.ChatCursor{IsPinned: last.IsPinned, UpdatedAt: last.UpdatedAt, ID: last.ChatID}.String()
 		n = count
 	}
+	if s.presence != nil {
+		if err := attachPresence(ctx, s.presence, app.ID, chats[:n], time.Now()); err != nil {
+			logging.Errorw(ctx, "attach presence failed", "err", err, "appID", app.ID, "userID", userID)
+		}
+	}
 	return chats[:n], next, nil
 }
 
+// Read marks the chat as read by the user and, with a ReadNotifier, tells
+// the other party. A failed notification does not fail the read.
+func (s *chatService) Read(ctx context.Context, bundleID, userID, chatID string) error {
+	app, err := s.a.GetByBundleID(ctx, bundleID)
+	if err != nil {
+		logging.Errorw(ctx, "failed to get app by bundle ID", "err", err, "bundleID", bundleID)
+		return err
+	}
+
+	// check ownership
+	chat, err := s.c.Get(ctx, app.ID, chatID, userID)
+	if err != nil {
+		logging.Errorw(ctx, "failed to verify chat ownership", "err", err, "appID", app.ID, "chatID", chatID, "userID", userID)
+		return err
+	}
+
+	readAt, err := s.c.Read(ctx, userID, chatID)
+	if err != nil {
+		return err
+	}
+
+	if s.readNotifier != nil {
+		receipt := &models.ReadReceipt{
+			ChatID:   chatID,
+			ReaderID: userID,
+			SenderID: chat.ReceiverID,
+			ReadAt:   readAt,
+		}
+		if err := s.readNotifier.NotifyRead(ctx, receipt); err != nil {
+			logging.Errorw(ctx, "notify read receipt failed", "err", err, "chatID", chatID, "userID", userID)
+		}
+	}
+	return nil
+}
+
+// markRead sets the read state of the user's own messages from when the
+// other party last read the chat.
+func markRead(chat *models.ChatRoom, userID string, msgs []*models.Message) {
+	for _, msg := range msgs {
+		if msg.SenderID != userID {
+			continue
+		}
+		isRead := chat.LastSeenAt != nil && !msg.CreatedAt.After(*chat.LastSeenAt)
+		msg.IsReadByReceiver = &isRead
+		if isRead {
+			msg.ReadAt = chat.LastSeenAt
+		}
+	}
+}
+
 func (s *chatService) FetchNewMessages(ctx context.Context, bundleID, userID, chatID string, messageID string) ([]*models.Message, error) {
 
 	app, err := s.a.GetByBundleID(ctx, bundleID)
@@ -385,7 +604,8 @@ func (s *chatService) FetchNewMessages(ctx context.Context, bundleID, userID, ch
 	}
 
 	// check ownership
-	if _, err := s.c.Get(ctx, app.ID, chatID, userID); err != nil {
+	chat, err := s.c.Get(ctx, app.ID, chatID, userID)
+	if err != nil {
 		logging.Errorw(ctx, "failed to verify chat ownership", "err", err, "appID", app.ID, "chatID", chatID, "userID", userID)
 		return nil, err
 	}
@@ -402,7 +622,15 @@ func (s *chatService) FetchNewMessages(ctx context.Context, bundleID, userID, ch
 		return nil, err
 	}
 
-	return s.aggregateMessages(ctx, userID, nonFilteredMsgs), nil
+	msgs, err := s.aggregateMessages(ctx, userID, nonFilteredMsgs)
+	if err != nil {
+		return nil, err
+	}
+	markRead(chat, userID, msgs)
+	if err := s.maskResumes(ctx, app, chat, userID, msgs); err != nil {
+		return nil, err
+	}
+	return msgs, nil
 }
 
 func (s *chatService) GetChatMessages(ctx context.Context, bundleID, userID, chatID string, next string, count int) ([]*models.Message, string, error) {
@@ -414,7 +642,8 @@ func (s *chatService) GetChatMessages(ctx context.Context, bundleID, userID, cha
 	}
 
 	// check ownership
-	if _, err := s.c.Get(ctx, app.ID, chatID, userID); err != nil {
+	chat, err := s.c.Get(ctx, app.ID, chatID, userID)
+	if err != nil {
 		logging.Errorw(ctx, "failed to verify chat ownership", "err", err, "appID", app.ID, "chatID", chatID, "userID", userID)
 		return nil, "", err
 	}
@@ -422,20 +651,33 @@ func (s *chatService) GetChatMessages(ctx context.Context, bundleID, userID, cha
 		return []*models.Message{}, next, nil
 	}
 
+	before, err := models.ParseMessageCursor(next)
+	if err != nil {
+		return nil, "", err
+	}
+
 	// get one more element for determining next cursor
-	nonFilteredMsgs, err := s.c.GetMessages(ctx, chatID, next, count+1)
+	nonFilteredMsgs, err := s.c.GetMessages(ctx, chatID, before, count+1)
 	if err != nil {
 		logging.Errorw(ctx, "failed to get messages", "err", err, "chatID", chatID, "count", count+1)
 		return nil, "", err
 	}
 
-	msgs := s.aggregateMessages(ctx, userID, nonFilteredMsgs)
+	msgs, err := s.aggregateMessages(ctx, userID, nonFilteredMsgs)
+	if err != nil {
+		return nil, "", err
+	}
+	markRead(chat, userID, msgs)
+	if err := s.maskResumes(ctx, app, chat, userID, msgs); err != nil {
+		return nil, "", err
+	}
 
 	// prepare next cursor
 	next = ""
 	n := len(nonFilteredMsgs)
 	if n > count { // more elements available
-		next = strconv.FormatInt(nonFilteredMsgs[count-1].CreatedAt.Unix(), 10)
+		last := nonFilteredMsgs[count-1]
+		next = models.MessageCursor{CreatedAt: last.CreatedAt, ID: last.ID}.String()
 		n = count
 	}
 	if n > len(msgs) {
@@ -445,13 +687,13 @@ func (s *chatService) GetChatMessages(ctx context.Context, bundleID, userID, cha
 	return msgs[:n], next, nil
 }
 
-func (s *chatService) SendMessage(ctx context.Context, bundleID, userID, chatID string, options ...models.SendOptionFunc) (*models.Message, error) {
-	params := models.SendOption{}
-	for _, optionFunc := range options {
-		if err := optionFunc(&params); err != nil {
-			logging.Errorw(ctx, "build send option failed", "err", err)
-			return nil, err
-		}
+// GetMessagesAround returns up to before messages older and after messages
+// newer than the anchor message, with the anchor in between, filtered like
+// GetChatMessages. It lets a client jump to a replied-to message or a search
+// hit without loading everything in between.
+func (s *chatService) GetMessagesAround(ctx context.Context, bundleID, userID, chatID, messageID string, before, after int) (*models.MessageWindow, error) {
+	if before < 0 || after < 0 {
+		return nil, models.ErrorWrongParams
 	}
 
 	app, err := s.a.GetByBundleID(ctx, bundleID)
@@ -460,9 +702,138 @@ func (s *chatService) SendMessage(ctx context.Context, bundleID, userID, chatID
 		return nil, err
 	}
 
+	// check ownership
 	chat, err := s.c.Get(ctx, app.ID, chatID, userID)
 	if err != nil {
-		logging.Errorw(ctx, "get chat failed", "err", err, "user_id", userID, "chat_id", chatID)
+		logging.Errorw(ctx, "failed to verify chat ownership", "err", err, "appID", app.ID, "chatID", chatID, "userID", userID)
+		return nil, err
+	}
+
+	anchor, err := s.c.GetMessage(ctx, messageID)
+	if err != nil {
+		return nil, err
+	} else if anchor.ChatID != chatID {
+		return nil, models.ErrorNotAllowed
+	}
+	at := &models.MessageCursor{CreatedAt: anchor.CreatedAt, ID: anchor.ID}
+
+	// get one more element each way for determining the cursors
+	older, err := s.c.GetMessages(ctx, chatID, at, before+1)
+	if err != nil {
+		return nil, err
+	}
+	newer, err := s.c.GetMessagesAfter(ctx, chatID, at, after+1)
+	if err != nil {
+		return nil, err
+	}
+
+	window := &models.MessageWindow{}
+	if len(older) > before {
+		older = older[:before]
+		window.Older = cursorAfter(at, older).String()
+	}
+	if len(newer) > after {
+		newer = newer[:after]
+		window.Newer = cursorAfter(at, newer).String()
+	}
+
+	// newest first, like GetChatMessages
+	nonFilteredMsgs := make([]*models.Message, 0, len(newer)+1+len(older))
+	for i := len(newer) - 1; i >= 0; i-- {
+		nonFilteredMsgs = append(nonFilteredMsgs, newer[i])
+	}
+	nonFilteredMsgs = append(nonFilteredMsgs, anchor)
+	nonFilteredMsgs = append(nonFilteredMsgs, older...)
+
+	if window.Messages, err = s.aggregateMessages(ctx, userID, nonFilteredMsgs); err != nil {
+		return nil, err
+	}
+	markRead(chat, userID, window.Messages)
+	if err := s.maskResumes(ctx, app, chat, userID, window.Messages); err != nil {
+		return nil, err
+	}
+	return window, nil
+}
+
+// GetNewerMessages pages forward from the Newer cursor of a message window:
+// it returns up to count messages after the cursor, newest first, and the
+// cursor of the page after them.
+func (s *chatService) GetNewerMessages(ctx context.Context, bundleID, userID, chatID string, next string, count int) ([]*models.Message, string, error) {
+	after, err := models.ParseMessageCursor(next)
+	if err != nil {
+		return nil, "", err
+	} else if after == nil {
+		return nil, "", models.ErrorWrongParams
+	}
+
+	app, err := s.a.GetByBundleID(ctx, bundleID)
+	if err != nil {
+		logging.Errorw(ctx, "failed to get app by bundle ID", "err", err, "bundleID", bundleID)
+		return nil, "", err
+	}
+
+	// check ownership
+	chat, err := s.c.Get(ctx, app.ID, chatID, userID)
+	if err != nil {
+		logging.Errorw(ctx, "failed to verify chat ownership", "err", err, "appID", app.ID, "chatID", chatID, "userID", userID)
+		return nil, "", err
+	}
+	if count == 0 {
+		return []*models.Message{}, next, nil
+	}
+
+	// get one more element for determining next cursor
+	newer, err := s.c.GetMessagesAfter(ctx, chatID, after, count+1)
+	if err != nil {
+		logging.Errorw(ctx, "failed to get messages", "err", err, "chatID", chatID, "count", count+1)
+		return nil, "", err
+	}
+
+	next = ""
+	if len(newer) > count {
+		newer = newer[:count]
+		next = cursorAfter(after, newer).String()
+	}
+
+	nonFilteredMsgs := make([]*models.Message, 0, len(newer))
+	for i := len(newer) - 1; i >= 0; i-- {
+		nonFilteredMsgs = append(nonFilteredMsgs, newer[i])
+	}
+	msgs, err := s.aggregateMessages(ctx, userID, nonFilteredMsgs)
+	if err != nil {
+		return nil, "", err
+	}
+	markRead(chat, userID, msgs)
+	if err := s.maskResumes(ctx, app, chat, userID, msgs); err != nil {
+		return nil, "", err
+	}
+	return msgs, next, nil
+}
+
+// cursorAfter returns the cursor of the last message of a page read from
+// start, or start itself for an empty page.
+func cursorAfter(start *models.MessageCursor, page []*models.Message) models.MessageCursor {
+	if len(page) == 0 {
+		return *start
+	}
+	last := page[len(page)-1]
+	return models.MessageCursor{CreatedAt: last.CreatedAt, ID: last.ID}
+}
+
+func (s *chatService) SendMessage(ctx context.Context, bundleID, userID, chatID string, options ...models.SendOptionFunc) (*models.Message, error) {
+	params, err := buildSendOption(ctx, options)
+	if err != nil {
+		return nil, err
+	}
+
+	app, err := s.a.GetByBundleID(ctx, bundleID)
+	if err != nil {
+		logging.Errorw(ctx, "failed to get app by bundle ID", "err", err, "bundleID", bundleID)
+		return nil, err
+	}
+
+	chat, err := s.checkSendable(ctx, app, bundleID, userID, chatID, params)
+	if err != nil {
 		return nil, err
 	}
 
@@ -477,11 +848,98 @@ func (s *chatService) SendMessage(ctx context.Context, bundleID, userID, chatID
 		logging.Errorw(ctx, "get message failed", "err", err, "message_id", msgID)
 		return nil, err
 	}
-	s.injectContent(ctx, userID, msg, true)
+	if err := s.injectContent(ctx, userID, msg, true); err != nil {
+		logging.Errorw(ctx, "inject content to message failed", "err", err, "message_id", msgID)
+	}
+	markRead(chat, userID, []*models.Message{msg})
+	if err := s.maskResumes(ctx, app, chat, userID, []*models.Message{msg}); err != nil {
+		return nil, err
+	}
 
 	return msg, nil
 }
 
+func buildSendOption(ctx context.Context, options []models.SendOptionFunc) (*models.SendOption, error) {
+	params := models.SendOption{}
+	for _, optionFunc := range options {
+		if err := optionFunc(&params); err != nil {
+			logging.Errorw(ctx, "build send option failed", "err", err)
+			return nil, err
+		}
+	}
+	return &params, nil
+}
+
+// checkSendable runs every check SendMessage makes before adding a message
+// to the chat, and returns the user's side of the chat.
+func (s *chatService) checkSendable(ctx context.Context, app *models.App, bundleID, userID, chatID string, params *models.SendOption) (*models.ChatRoom, error) {
+	if err := app.Config.ValidateMessage(params); err != nil {
+		logging.Errorw(ctx, "message rejected by app config", "err", err, "app_id", app.ID, "type", params.Type.String())
+		return nil, err
+	}
+
+	chat, err := s.c.Get(ctx, app.ID, chatID, userID)
+	if err != nil {
+		logging.Errorw(ctx, "get chat failed", "err", err, "user_id", userID, "chat_id", chatID)
+		return nil, err
+	}
+
+	role, err := s.chatRole(ctx, chat, userID)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.requireAgreements(ctx, bundleID, userID, role); err != nil {
+		return nil, err
+	}
+
+	if err := s.validateAttachments(ctx, userID, params); err != nil {
+		logging.Errorw(ctx, "message attachments rejected", "err", err, "user_id", userID, "chat_id", chatID, "media_ids", params.MediaIDs)
+		return nil, err
+	}
+	return chat, nil
+}
+
+// validateAttachments checks the media of an image or file message: every
+// ID must exist, have the message's media type and not be expired
+// (ErrorWrongParams), and have been uploaded by the sender (ErrorNotAllowed).
+func (s *chatService) validateAttachments(ctx context.Context, userID string, params *models.SendOption) error {
+	mediaType, ok := params.Type.AttachmentType()
+	if !ok {
+		if len(params.MediaIDs) > 0 {
+			return models.ErrorWrongParams
+		}
+		return nil
+	}
+	if len(params.MediaIDs) == 0 {
+		return models.ErrorWrongParams
+	}
+
+	medias, missing, err := s.m.Get(ctx, params.MediaIDs)
+	if err != nil {
+		logging.Errorw(ctx, "get media failed", "err", err, "media_ids", params.MediaIDs)
+		return err
+	}
+	if len(missing) > 0 {
+		return models.ErrorWrongParams
+	}
+
+	now := time.Now()
+	seen := make(map[string]struct{}, len(medias))
+	for _, media := range medias {
+		if _, dup := seen[media.ID]; dup || media.Type != mediaType || media.IsExpiredAt(now) {
+			return models.ErrorWrongParams
+		}
+		seen[media.ID] = struct{}{}
+		// media uploaded before owners were recorded has none, and only
+		// stays usable by anyone up to the configured cutoff
+		legacy := media.OwnerID == nil && media.CreatedAt.Before(s.legacyMediaBefore)
+		if !legacy && !media.IsOwnedBy(userID) {
+			return models.ErrorNotAllowed
+		}
+	}
+	return nil
+}
+
 func (s *chatService) UnsendMessage(ctx context.Context, bundleID, userID, messageID string) error {
 
 	app, err := s.a.GetByBundleID(ctx, bundleID)
@@ -522,6 +980,111 @@ func (s *chatService) UnsendMessage(ctx context.Context, bundleID, userID, messa
 	return nil
 }
 
+// React adds the user's emoji reaction to a message of a chat they are in.
+// Reacting again with the same emoji changes nothing.
+func (s *chatService) React(ctx context.Context, bundleID, userID, messageID, emoji string) error {
+	if !models.ValidReaction(emoji) {
+		return models.ErrorWrongParams
+	}
+	if err := s.checkReactable(ctx, bundleID, userID, messageID); err != nil {
+		return err
+	}
+	return s.c.AddReaction(ctx, messageID, userID, emoji)
+}
+
+// Unreact takes the user's emoji reaction to a message back, if any.
+func (s *chatService) Unreact(ctx context.Context, bundleID, userID, messageID, emoji string) error {
+	if err := s.checkReactable(ctx, bundleID, userID, messageID); err != nil {
+		return err
+	}
+	return s.c.RemoveReaction(ctx, messageID, userID, emoji)
+}
+
+// checkReactable fails unless the user is in the message's chat and can see
+// the message.
+func (s *chatService) checkReactable(ctx context.Context, bundleID, userID, messageID string) error {
+	app, err := s.a.GetByBundleID(ctx, bundleID)
+	if err != nil {
+		logging.Errorw(ctx, "failed to get app by bundle ID", "err", err, "bundleID", bundleID)
+		return err
+	}
+
+	msg, err := s.c.GetMessage(ctx, messageID)
+	if err != nil {
+		return err
+	}
+
+	// check ownership
+	if _, err := s.c.Get(ctx, app.ID, msg.ChatID, userID); err != nil {
+		logging.Errorw(ctx, "failed to verify chat ownership", "err", err, "appID", app.ID, "chatID", msg.ChatID, "userID", userID)
+		return err
+	}
+	if isHiddenLastMessage(userID, msg) {
+		return models.ErrorNotAllowed
+	}
+	return nil
+}
+
+// Unlock unlocks a LOCKED hire chat for the recruiter, spending one of the
+// plan's monthly chat unlocks if any are left and a one-time ticket
+// otherwise. Unlocking a chat that is already UNLOCKED, or that the plan's
+// chat access already opens, is a no-op and costs nothing, so clients can
+// safely retry.
+func (s *chatService) Unlock(ctx context.Context, bundleID, recruiterID, chatID string) error {
+	app, err := s.a.GetByBundleID(ctx, bundleID)
+	if err != nil {
+		logging.Errorw(ctx, "failed to get app by bundle ID", "err", err, "bundleID", bundleID)
+		return err
+	}
+
+	// check ownership
+	chat, err := s.c.Get(ctx, app.ID, chatID, recruiterID)
+	if err != nil {
+		logging.Errorw(ctx, "failed to verify chat ownership", "err", err, "appID", app.ID, "chatID", chatID, "userID", recruiterID)
+		return err
+	}
+	if chat.PostID == nil {
+		return models.ErrorNotAllowed
+	}
+
+	// only the recruiter side can unlock
+	jobSeekerID, err := s.jobSeekerID(ctx, chat)
+	if err != nil {
+		return err
+	}
+	if jobSeekerID == "" || jobSeekerID == recruiterID {
+		return models.ErrorNotAllowed
+	}
+
+	// the plan's monthly unlocks are spent before tickets; a plan that opens
+	// every chat has nothing to spend
+	entitlements, err := entitlementsOf(ctx, s.s, s.p, app.ID, recruiterID)
+	if err != nil {
+		return err
+	}
+	if entitlements.Allows(models.EntitlementChatAccess, 0) {
+		return nil
+	}
+	if limit := entitlements.Limit(models.EntitlementMonthlyChatUnlocks); limit != 0 {
+		_, err := s.p.UnlockChat(ctx, app.ID, recruiterID, chatID, models.EntitlementPeriod(time.Now()), limit)
+		if err == nil {
+			return nil
+		}
+		if err != models.ErrorInsufficientQuota {
+			logging.Errorw(ctx, "failed to unlock chat with plan quota", "err", err, "appID", app.ID, "chatID", chatID, "recruiterID", recruiterID)
+			return err
+		}
+	}
+
+	if _, err := s.t.UnlockChat(ctx, app.ID, recruiterID, chatID); err != nil {
+		if err != models.ErrorInsufficientQuota {
+			logging.Errorw(ctx, "failed to unlock chat", "err", err, "appID", app.ID, "chatID", chatID, "recruiterID", recruiterID)
+		}
+		return err
+	}
+	return nil
+}
+
 func (s *chatService) GetBusinessCardOnly(ctx context.Context, bundleID string, before time.Duration) ([]*models.BusinessCardChat, error) {
 	app, err := s.a.GetByBundleID(ctx, bundleID)
 	if err != nil {
@@ -581,6 +1144,158 @@ func (s *chatService) GetBusinessCardOnly(ctx context.Context, bundleID string,
 	return filtered, nil
 }
 
+// accessStatus resolves the access status userID sees for a hire chat,
+// the same way Get does for a single chat room.
+func (s *chatService) accessStatus(ctx context.Context, app *models.App, chat *models.ChatRoom, userID string) (models.AccessStatus, error) {
+	if chat.PostID == nil || chat.AccessStatus == models.AccessStatusUnlocked {
+		return chat.AccessStatus, nil
+	}
+
+	jobSeekerID, err := s.jobSeekerID(ctx, chat)
+	if err != nil {
+		return chat.AccessStatus, err
+	}
+	if userID == jobSeekerID {
+		return models.AccessStatusUnlocked, nil
+	}
+
+	entitlements, err := entitlementsOf(ctx, s.s, s.p, app.ID, userID)
+	if err != nil {
+		return chat.AccessStatus, err
+	}
+	if entitlements.Allows(models.EntitlementChatAccess, 0) {
+		return models.AccessStatusUnlocked, nil
+	}
+	return chat.AccessStatus, nil
+}
+
+// chatRole returns the user's role in a hire chat, or roleUnknown for chats
+// without a post or job seeker.
+func (s *chatService) chatRole(ctx context.Context, chat *models.ChatRoom, userID string) (models.Role, error) {
+	if s.agreements == nil || chat.PostID == nil {
+		return roleUnknown, nil
+	}
+	jobSeekerID, err := s.jobSeekerID(ctx, chat)
+	if err != nil {
+		return roleUnknown, err
+	}
+	switch jobSeekerID {
+	case "":
+		return roleUnknown, nil
+	case userID:
+		return models.RoleJobSeeker, nil
+	default:
+		return models.RoleRecruiter, nil
+	}
+}
+
+// newChatRole tells the sender's role from the options of a new chat: the
+// recruiter hands over their contact, while a job seeker applies to a post,
+// possibly with a resume, business card or contact.
+func newChatRole(postID *string, opt *models.NewChatOption) models.Role {
+	switch {
+	case opt.RecruiterContact != nil:
+		return models.RoleRecruiter
+	case postID != nil, opt.Resume != nil, opt.Card != nil, opt.JobSeekerContact != nil:
+		return models.RoleJobSeeker
+	default:
+		return roleUnknown
+	}
+}
+
+// requireAgreements returns an *models.AgreementRequiredError for the first
+// document of the policy the user hasn't accepted the latest version of. It
+// does nothing without an agreement gate.
+func (s *chatService) requireAgreements(ctx context.Context, bundleID, userID string, role models.Role) error {
+	if s.agreements == nil {
+		return nil
+	}
+	required := s.policy.Documents(role)
+	if len(required) == 0 {
+		return nil
+	}
+	pending, err := s.agreements.Pending(ctx, bundleID, userID, required...)
+	if err != nil {
+		logging.Errorw(ctx, "failed to get pending agreements", "err", err, "bundleID", bundleID, "userID", userID)
+		return err
+	}
+	for _, docType := range required {
+		for _, record := range pending {
+			if record.DocumentType != docType {
+				continue
+			}
+			url := ""
+			if record.Latest != nil {
+				url = record.Latest.URL(models.DefaultLocale)
+			}
+			return &models.AgreementRequiredError{
+				DocumentType: docType,
+				Version:      record.VersionLatest,
+				URL:          url,
+			}
+		}
+	}
+	return nil
+}
+
+// jobSeekerID returns the job seeker of a hire chat: the resume relation's
+// user if there is one, otherwise the owner of the business card snapshot.
+// It returns "" when neither exists.
+func (s *chatService) jobSeekerID(ctx context.Context, chat *models.ChatRoom) (string, error) {
+	relation, err := s.r.GetRelation(ctx, models.ByChat(chat.ChatID))
+	if err != nil && err != sql.ErrNoRows {
+		logging.Errorw(ctx, "failed to get resume relation", "err", err, "chatID", chat.ChatID)
+		return "", err
+	}
+	if relation != nil {
+		return relation.UserID, nil
+	}
+	if chat.BusinessCardSnapshotID == nil {
+		return "", nil
+	}
+	ownerMap, err := s.bc.GetSnapshotOwners(ctx, []string{*chat.BusinessCardSnapshotID})
+	if err != nil {
+		logging.Errorw(ctx, "failed to get business card snapshot owner", "err", err, "snapshotID", *chat.BusinessCardSnapshotID)
+		return "", err
+	}
+	return ownerMap[*chat.BusinessCardSnapshotID], nil
+}
+
+// maskResumes applies the app's resume masking policy to every resume
+// carried by msgs (including replied-to messages). The viewer's access status
+// is only resolved when there is something to mask.
+func (s *chatService) maskResumes(ctx context.Context, app *models.App, chat *models.ChatRoom, userID string, msgs []*models.Message) error {
+	if app.Config == nil || app.Config.ResumeMasking == models.ResumeMaskingNone {
+		return nil
+	}
+
+	var targets []*models.Message
+	for _, msg := range msgs {
+		if msg == nil {
+			continue
+		}
+		if msg.Resume != nil {
+			targets = append(targets, msg)
+		}
+		if msg.ReplyTo != nil && msg.ReplyTo.Resume != nil {
+			targets = append(targets, msg.ReplyTo)
+		}
+	}
+	if len(targets) == 0 {
+		return nil
+	}
+
+	access, err := s.accessStatus(ctx, app, chat, userID)
+	if err != nil {
+		return err
+	}
+	status := toResumeStatus(access)
+	for _, msg := range targets {
+		msg.Resume = app.Config.MaskResume(msg.Resume, status)
+	}
+	return nil
+}
+
 func toResumeStatus(status models.AccessStatus) models.ResumeStatus {
 	if status == models.AccessStatusUnlocked {
 		return models.ResumeStatusUnlocked
@@ -596,15 +1311,10 @@ func (s *chatService) aggregateLastMessage(ctx context.Context, userID string, m
 		return nil, err
 	}
 
-	status := msg.Status
-	switch {
-	case status.HasOneOf(models.DeletedBySender) && userID == msg.SenderID,
-		status.HasOneOf(models.DeletedByReceiver) && userID != msg.SenderID,
-		status.HasOneOf(models.Unsent):
+	if isHiddenLastMessage(userID, msg) {
 		return nil, nil
-	default:
-		msg.Status = models.Normal
 	}
+	msg.Status = models.Normal
 
 	if isInjectContent {
 		if err := s.injectContent(ctx, userID, msg, false); err != nil {
@@ -616,74 +1326,309 @@ func (s *chatService) aggregateLastMessage(ctx context.Context, userID string, m
 	return msg, nil
 }
 
-// injectContent processes message content based on type and handles reply messages (without user info)
-func (s *chatService) injectContent(ctx context.Context, userID string, msg *models.Message, injectReplyTo bool) error {
-	switch msg.Type {
-	case models.MsgText:
-		if msg.Body == nil {
-			emptyString := ""
-			msg.Body = &emptyString
-		}
-	case models.MsgImage, models.MsgFile:
-		media, err := s.m.Get(ctx, msg.MediaIDs)
-		if err != nil {
+// isHiddenLastMessage reports whether msg must not be shown to the user as
+// the last message of a chat: deleted on their side or unsent.
+func isHiddenLastMessage(userID string, msg *models.Message) bool {
+	status := msg.Status
+	return status.HasOneOf(models.DeletedBySender) && userID == msg.SenderID ||
+		status.HasOneOf(models.DeletedByReceiver) && userID != msg.SenderID ||
+		status.HasOneOf(models.Unsent)
+}
+
+// lastMessages returns the last messages of chats that the user may see,
+// keyed by message ID, with their media filled in. It costs one message
+// query and one media query however many chats there are; snapshots are
+// left to the caller to batch with the chats' own.
+func (s *chatService) lastMessages(ctx context.Context, userID string, chats []*models.ChatRoom) (map[string]*models.Message, error) {
+	msgIDs := []string{}
+	for _, chat := range chats {
+		if chat.LastMessageID != nil {
+			msgIDs = append(msgIDs, *chat.LastMessageID)
+		}
+	}
+	lastMsgMap := map[string]*models.Message{}
+	if len(msgIDs) == 0 {
+		return lastMsgMap, nil
+	}
+
+	msgs, err := s.c.GetMessagesByIDs(ctx, msgIDs)
+	if err != nil {
+		return lastMsgMap, err
+	}
+
+	var withMedia []*models.Message
+	for _, msg := range msgs {
+		if isHiddenLastMessage(userID, msg) {
+			continue
+		}
+		msg.Status = models.Normal
+		switch msg.Type {
+		case models.MsgText:
+			if msg.Body == nil {
+				emptyString := ""
+				msg.Body = &emptyString
+			}
+		case models.MsgImage, models.MsgFile:
+			withMedia = append(withMedia, msg)
+		}
+		lastMsgMap[msg.ID] = msg
+	}
+
+	if err := s.injectMedias(ctx, withMedia); err != nil {
+		// show the messages without their media rather than not at all
+		logging.Errorw(ctx, "inject medias to last messages failed", "err", err, "userID", userID)
+	}
+	return lastMsgMap, nil
+}
+
+// injectMedias fills in msg.Medias for image and file messages with a single
+// media lookup and a single signing pass.
+func (s *chatService) injectMedias(ctx context.Context, msgs []*models.Message) error {
+	var mediaIDs []string
+	for _, msg := range msgs {
+		msg.Medias = []*models.Media{}
+		mediaIDs = append(mediaIDs, msg.MediaIDs...)
+	}
+	if len(mediaIDs) == 0 {
+		return nil
+	}
+
+	medias, missing, err := s.m.Get(ctx, mediaIDs)
+	if err != nil {
+		return err
+	}
+	if len(missing) > 0 {
+		logging.Errorw(ctx, "messages reference missing media", "missing", missing)
+	}
+
+	// expired media stays on record but is no longer shown
+	now := time.Now()
+	shown := make([]*models.Media, 0, len(medias))
+	mediaMap := map[string]*models.Media{}
+	for _, media := range medias {
+		if !media.IsExpiredAt(now) {
+			shown = append(shown, media)
+			mediaMap[media.ID] = media
+		}
+	}
+	if s.media != nil {
+		if err := s.media.Sign(ctx, shown); err != nil {
 			return err
 		}
-		msg.Medias = media
-	case models.MsgForm:
-		//TODO: inject form
-	case models.MsgMeetup:
-		//TODO: inject meetup
-	case models.MsgBusinessCard:
-		if msg.RefID != nil {
-			snapshot, err := s.bc.GetSnapshot(ctx, *msg.RefID)
-			if err != nil {
-				return err
+	}
+	for _, msg := range msgs {
+		msg.Medias = make([]*models.Media, 0, len(msg.MediaIDs))
+		for _, id := range msg.MediaIDs {
+			if media, ok := mediaMap[id]; ok {
+				msg.Medias = append(msg.Medias, media)
+			}
+		}
+	}
+	return nil
+}
+
+// messageError reports a message whose content could not be filled in.
+type messageError struct {
+	messageID string
+	err       error
+}
+
+func (e *messageError) Error() string {
+	return fmt.Sprintf("message %s: %v", e.messageID, e.err)
+}
+
+func (e *messageError) Unwrap() error {
+	return e.err
+}
+
+// contentMissing records on msg that part of its content is gone.
+func contentMissing(msg *models.Message, err error) error {
+	if msg.ContentError == "" {
+		msg.ContentError = err.Error()
+	} else {
+		msg.ContentError += "; " + err.Error()
+	}
+	return &messageError{msg.ID, err}
+}
+
+// injectContent processes message content based on type and handles reply messages (without user info)
+func (s *chatService) injectContent(ctx context.Context, userID string, msg *models.Message, injectReplyTo bool) error {
+	failures, err := s.hydrateMessages(ctx, userID, []*models.Message{msg}, injectReplyTo)
+	if len(failures) > 0 {
+		logging.Errorw(ctx, "message hydrated without some content", "err", errors.Join(failures...), "userID", userID)
+	}
+	return err
+}
+
+// hydrateMessages fills in the content of a page of messages in two phases:
+// it first collects the replies, reactions, media and snapshots the page
+// refers to, then fetches each kind in bulk and assembles the messages, so a
+// page costs the same few queries however long it is. A message whose reply
+// or snapshot no longer exists is left partly filled with its ContentError
+// set, and is listed in the returned failures; only failed queries return an
+// error.
+func (s *chatService) hydrateMessages(ctx context.Context, userID string, msgs []*models.Message, injectReplyTo bool) ([]error, error) {
+	var errs, failures []error
+
+	all := msgs
+	if injectReplyTo {
+		var replyIDs []string
+		for _, msg := range msgs {
+			if msg.ReplyToMessageID != nil {
+				replyIDs = append(replyIDs, *msg.ReplyToMessageID)
 			}
-			msg.BusinessCard = snapshot.Content
 		}
-	case models.MsgResume:
-		if msg.RefID != nil {
-			snapshot, err := s.r.GetSnapshot(ctx, *msg.RefID)
+		if len(replyIDs) > 0 {
+			replies, err := s.c.GetMessagesByIDs(ctx, replyIDs)
 			if err != nil {
-				return err
+				errs = append(errs, err)
+			}
+			replyMap := map[string]*models.Message{}
+			for _, reply := range replies {
+				replyMap[reply.ID] = reply
+			}
+
+			all = append([]*models.Message{}, msgs...)
+			for _, msg := range msgs {
+				if msg.ReplyToMessageID == nil {
+					continue
+				}
+				reply, ok := replyMap[*msg.ReplyToMessageID]
+				if !ok {
+					if err == nil {
+						failures = append(failures, contentMissing(msg, fmt.Errorf("reply %s: %w", *msg.ReplyToMessageID, sql.ErrNoRows)))
+					}
+					continue
+				}
+				// every message gets its own copy, since masking rewrites it
+				replyMsg := *reply
+				markReply(userID, &replyMsg)
+				msg.ReplyTo = &replyMsg
+				all = append(all, msg.ReplyTo)
 			}
-			msg.Resume = snapshot.Content
 		}
 	}
 
-	if injectReplyTo && msg.ReplyToMessageID != nil {
-		replyMsg, err := s.c.GetMessage(ctx, *msg.ReplyToMessageID)
+	var reactable []string
+	for _, msg := range msgs {
+		if msg.Status != models.Unsent {
+			reactable = append(reactable, msg.ID)
+		}
+	}
+	if len(reactable) > 0 {
+		reactions, err := s.c.GetReactions(ctx, reactable, userID)
 		if err != nil {
-			return err
+			errs = append(errs, err)
 		}
-		status := replyMsg.Status
-		switch {
-		case status.HasOneOf(models.DeletedBySender) && userID == replyMsg.SenderID,
-			status.HasOneOf(models.DeletedByReceiver) && userID != replyMsg.SenderID,
-			status.HasOneOf(models.Unsent):
+		for _, msg := range msgs {
+			msg.Reactions = reactions[msg.ID]
+		}
+	}
+
+	var withMedia []*models.Message
+	var resumeIDs, businessCardIDs []string
+	for _, msg := range all {
+		switch msg.Type {
+		case models.MsgText:
+			if msg.Body == nil {
+				emptyString := ""
+				msg.Body = &emptyString
+			}
+		case models.MsgImage, models.MsgFile:
+			withMedia = append(withMedia, msg)
+		case models.MsgForm:
+			//TODO: inject form
+		case models.MsgMeetup:
+			//TODO: inject meetup
+		case models.MsgBusinessCard:
+			if msg.RefID != nil {
+				businessCardIDs = append(businessCardIDs, *msg.RefID)
+			}
+		case models.MsgResume:
+			if msg.RefID != nil {
+				resumeIDs = append(resumeIDs, *msg.RefID)
+			}
+		}
+	}
 
-			// user deleted/unsent this message, mark it as unavailable
-			replyMsg.Status = models.Unavailable
+	if err := s.injectMedias(ctx, withMedia); err != nil {
+		errs = append(errs, err)
+	}
 
-			// wipe out message content for unsent
-			replyMsg.Body = nil
-			replyMsg.MediaIDs = nil
-			// replyMsg.Type = models.MsgEmpty
-		default:
-			replyMsg.Status = models.Normal
+	resumeMap := map[string]*models.ResumeSnapshot{}
+	var resumeErr error
+	if len(resumeIDs) > 0 {
+		var snapshots []*models.ResumeSnapshot
+		snapshots, resumeErr = s.r.ListSnapshots(ctx, resumeIDs)
+		if resumeErr != nil {
+			errs = append(errs, resumeErr)
+		}
+		for _, snapshot := range snapshots {
+			resumeMap[snapshot.ID] = snapshot
+		}
+	}
+	businessCardMap := map[string]*models.BusinessCardSnapshot{}
+	var businessCardErr error
+	if len(businessCardIDs) > 0 {
+		var snapshots []*models.BusinessCardSnapshot
+		snapshots, businessCardErr = s.bc.ListSnapshots(ctx, businessCardIDs)
+		if businessCardErr != nil {
+			errs = append(errs, businessCardErr)
+		}
+		for _, snapshot := range snapshots {
+			businessCardMap[snapshot.ID] = snapshot
 		}
+	}
 
-		if err := s.injectContent(ctx, userID, replyMsg, false); err != nil {
-			return err
+	for _, msg := range all {
+		if msg.RefID == nil {
+			continue
+		}
+		switch msg.Type {
+		case models.MsgBusinessCard:
+			if snapshot, ok := businessCardMap[*msg.RefID]; ok {
+				msg.BusinessCard = snapshot.Content
+			} else if businessCardErr == nil {
+				failures = append(failures, contentMissing(msg, fmt.Errorf("business card snapshot %s: %w", *msg.RefID, sql.ErrNoRows)))
+			}
+		case models.MsgResume:
+			if snapshot, ok := resumeMap[*msg.RefID]; ok {
+				msg.Resume = snapshot.Content
+			} else if resumeErr == nil {
+				failures = append(failures, contentMissing(msg, fmt.Errorf("resume snapshot %s: %w", *msg.RefID, sql.ErrNoRows)))
+			}
 		}
+	}
+
+	return failures, errors.Join(errs...)
+}
+
+// markReply hides the content of a replied-to message the user deleted or
+// its sender unsent.
+func markReply(userID string, replyMsg *models.Message) {
+	status := replyMsg.Status
+	switch {
+	case status.HasOneOf(models.DeletedBySender) && userID == replyMsg.SenderID,
+		status.HasOneOf(models.DeletedByReceiver) && userID != replyMsg.SenderID,
+		status.HasOneOf(models.Unsent):
 
-		msg.ReplyTo = replyMsg
+		// user deleted/unsent this message, mark it as unavailable
+		replyMsg.Status = models.Unavailable
+
+		// wipe out message content for unsent
+		replyMsg.Body = nil
+		replyMsg.MediaIDs = nil
+		// replyMsg.Type = models.MsgEmpty
+	default:
+		replyMsg.Status = models.Normal
 	}
-	return nil
 }
 
-func (s *chatService) aggregateMessages(ctx context.Context, userID string, nonFilteredMsgs []*models.Message) []*models.Message {
+// aggregateMessages drops the messages the user deleted, wipes the content
+// of unsent ones and hydrates the rest. A message whose reply or snapshot is
+// gone is still shown, with its ContentError set; only failed queries fail
+// the page.
+func (s *chatService) aggregateMessages(ctx context.Context, userID string, nonFilteredMsgs []*models.Message) ([]*models.Message, error) {
 	msgs := []*models.Message{}
 	for i := range nonFilteredMsgs {
 		msg := nonFilteredMsgs[i]
@@ -703,9 +1648,16 @@ func (s *chatService) aggregateMessages(ctx context.Context, userID string, nonF
 			msg.Status = models.Normal
 		}
 
-		s.injectContent(ctx, userID, msg, true)
-
 		msgs = append(msgs, msg)
 	}
-	return msgs
+
+	failures, err := s.hydrateMessages(ctx, userID, msgs, true)
+	if err != nil {
+		logging.Errorw(ctx, "hydrate messages failed", "err", err, "userID", userID)
+		return nil, err
+	}
+	if len(failures) > 0 {
+		logging.Errorw(ctx, "messages hydrated without some content", "err", errors.Join(failures...), "userID", userID)
+	}
+	return msgs, nil
 }
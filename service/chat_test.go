@@ -0,0 +1,747 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/A-pen-app/hire-sdk/models"
+	"github.com/A-pen-app/hire-sdk/store"
+)
+
+func TestValidateAttachments(t *testing.T) {
+	owner, past := "alice", time.Now().Add(-time.Hour)
+	other := "bob"
+	s := &chatService{m: &fakeMedia{medias: map[string]*models.Media{
+		"img":       {ID: "img", Type: models.Image, OwnerID: &owner},
+		"img2":      {ID: "img2", Type: models.Image, OwnerID: &owner},
+		"file":      {ID: "file", Type: models.File, OwnerID: &owner},
+		"expired":   {ID: "expired", Type: models.Image, OwnerID: &owner, ExpiredAt: &past},
+		"theirs":    {ID: "theirs", Type: models.Image, OwnerID: &other},
+		"legacy":    {ID: "legacy", Type: models.Image, CreatedAt: past},
+		"ownerless": {ID: "ownerless", Type: models.Image, CreatedAt: time.Now()},
+	}}, legacyMediaBefore: past.Add(time.Minute)}
+
+	cases := []struct {
+		name string
+		opt  models.SendOptionFunc
+		want error
+	}{
+		{"images", models.WithMedia([]string{"img", "img2"}), nil},
+		{"file", models.WithFile([]string{"file"}), nil},
+		{"text", models.WithText("hi"), nil},
+		{"no media", models.WithMedia(nil), models.ErrorWrongParams},
+		{"missing", models.WithMedia([]string{"img", "nope"}), models.ErrorWrongParams},
+		{"file as image", models.WithMedia([]string{"file"}), models.ErrorWrongParams},
+		{"image as file", models.WithFile([]string{"img"}), models.ErrorWrongParams},
+		{"expired", models.WithMedia([]string{"expired"}), models.ErrorWrongParams},
+		{"duplicate", models.WithMedia([]string{"img", "img"}), models.ErrorWrongParams},
+		{"someone else's", models.WithMedia([]string{"img", "theirs"}), models.ErrorNotAllowed},
+		{"no owner before the cutoff", models.WithMedia([]string{"legacy"}), nil},
+		{"no owner after the cutoff", models.WithMedia([]string{"ownerless"}), models.ErrorNotAllowed},
+	}
+	for _, c := range cases {
+		params := models.SendOption{}
+		if err := c.opt(&params); err != nil {
+			t.Fatal(err)
+		}
+		if got := s.validateAttachments(context.Background(), owner, &params); got != c.want {
+			t.Errorf("%s: err = %v, want %v", c.name, got, c.want)
+		}
+	}
+
+	// without a cutoff no ownerless media can be attached
+	s.legacyMediaBefore = time.Time{}
+	params := models.SendOption{}
+	_ = models.WithMedia([]string{"legacy"})(&params)
+	if got := s.validateAttachments(context.Background(), owner, &params); got != models.ErrorNotAllowed {
+		t.Errorf("no cutoff: err = %v, want %v", got, models.ErrorNotAllowed)
+	}
+}
+
+// fakeThread is a store.Chat holding one chat's messages, oldest first.
+type fakeThread struct {
+	store.Chat
+	chatID string
+	msgs   []*models.Message
+	// seen is when each user last read the chat
+	seen map[string]time.Time
+	// reactions lists message ID, user ID and emoji of each reaction
+	reactions [][3]string
+}
+
+func (f *fakeThread) AddReaction(ctx context.Context, messageID, userID, emoji string) error {
+	for _, r := range f.reactions {
+		if r == [3]string{messageID, userID, emoji} {
+			return nil
+		}
+	}
+	f.reactions = append(f.reactions, [3]string{messageID, userID, emoji})
+	return nil
+}
+
+func (f *fakeThread) RemoveReaction(ctx context.Context, messageID, userID, emoji string) error {
+	for i, r := range f.reactions {
+		if r == [3]string{messageID, userID, emoji} {
+			f.reactions = append(f.reactions[:i], f.reactions[i+1:]...)
+			break
+		}
+	}
+	return nil
+}
+
+func (f *fakeThread) GetReactions(ctx context.Context, messageIDs []string, userID string) (map[string][]*models.Reaction, error) {
+	reactions := map[string][]*models.Reaction{}
+	for _, messageID := range messageIDs {
+		for _, r := range f.reactions {
+			if r[0] != messageID {
+				continue
+			}
+			var reaction *models.Reaction
+			for _, existing := range reactions[messageID] {
+				if existing.Emoji == r[2] {
+					reaction = existing
+				}
+			}
+			if reaction == nil {
+				reaction = &models.Reaction{Emoji: r[2]}
+				reactions[messageID] = append(reactions[messageID], reaction)
+			}
+			reaction.Count++
+			reaction.Mine = reaction.Mine || r[1] == userID
+		}
+	}
+	return reactions, nil
+}
+
+func (f *fakeThread) Get(ctx context.Context, appID, chatID, userID string) (*models.ChatRoom, error) {
+	if chatID != f.chatID {
+		return nil, models.ErrorNotFound
+	}
+	// the chat is between alice and bob
+	receiverID := "alice"
+	if userID == "alice" {
+		receiverID = "bob"
+	}
+	chat := &models.ChatRoom{ChatID: chatID, SenderID: userID, ReceiverID: receiverID}
+	if seen, ok := f.seen[receiverID]; ok {
+		chat.LastSeenAt = &seen
+	}
+	return chat, nil
+}
+
+// GetChats returns the chat to alice and bob, the only users in it.
+func (f *fakeThread) GetChats(ctx context.Context, appID, userID string, after *models.ChatCursor, count int, status models.ChatAnnotation, unreadOnly, isOfficialRole bool) ([]*models.ChatRoom, error) {
+	if userID != "alice" && userID != "bob" {
+		return []*models.ChatRoom{}, nil
+	}
+	chat, err := f.Get(ctx, appID, f.chatID, userID)
+	if err != nil {
+		return nil, err
+	}
+	return []*models.ChatRoom{chat}, nil
+}
+
+func (f *fakeThread) HasChats(ctx context.Context, appID, userID string) (bool, error) {
+	return userID == "alice" || userID == "bob", nil
+}
+
+func (f *fakeThread) Read(ctx context.Context, userID, chatID string) (time.Time, error) {
+	readAt := f.msgs[len(f.msgs)-1].CreatedAt
+	if f.seen == nil {
+		f.seen = map[string]time.Time{}
+	}
+	f.seen[userID] = readAt
+	return readAt, nil
+}
+
+func (f *fakeThread) GetMessage(ctx context.Context, messageID string) (*models.Message, error) {
+	for _, msg := range f.msgs {
+		if msg.ID == messageID {
+			copied := *msg
+			return &copied, nil
+		}
+	}
+	return nil, models.ErrorNotFound
+}
+
+func (f *fakeThread) GetMessages(ctx context.Context, chatID string, before *models.MessageCursor, count int) ([]*models.Message, error) {
+	msgs := []*models.Message{}
+	for i := len(f.msgs) - 1; i >= 0 && len(msgs) < count; i-- {
+		if before == nil || f.msgs[i].CreatedAt.Before(before.CreatedAt) {
+			copied := *f.msgs[i]
+			msgs = append(msgs, &copied)
+		}
+	}
+	return msgs, nil
+}
+
+func (f *fakeThread) GetMessagesAfter(ctx context.Context, chatID string, after *models.MessageCursor, count int) ([]*models.Message, error) {
+	msgs := []*models.Message{}
+	for i := 0; i < len(f.msgs) && len(msgs) < count; i++ {
+		if f.msgs[i].CreatedAt.After(after.CreatedAt) {
+			copied := *f.msgs[i]
+			msgs = append(msgs, &copied)
+		}
+	}
+	return msgs, nil
+}
+
+func TestGetMessagesAround(t *testing.T) {
+	ctx := context.Background()
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	thread := &fakeThread{chatID: "chat"}
+	// cursors carry message IDs, which are UUIDs; names maps them to m0..m6
+	ids, names := make([]string, 7), map[string]string{}
+	for i := range ids {
+		ids[i] = fmt.Sprintf("00000000-0000-4000-8000-%012d", i)
+		names[ids[i]] = fmt.Sprintf("m%d", i)
+		body := names[ids[i]]
+		msg := &models.Message{ID: ids[i], ChatID: "chat", SenderID: "alice", Type: models.MsgText, Body: &body, CreatedAt: start.Add(time.Duration(i) * time.Minute)}
+		thread.msgs = append(thread.msgs, msg)
+	}
+	thread.msgs[2].Status = models.DeletedByReceiver
+	thread.msgs[4].Status = models.Unsent
+	s := &chatService{
+		a: fakeApps{"com.yoku.apen": {ID: "app", BundleID: "com.yoku.apen"}},
+		c: thread,
+	}
+
+	window, err := s.GetMessagesAround(ctx, "com.yoku.apen", "bob", "chat", ids[3], 2, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// m2 was deleted by bob, m4 was unsent
+	var got []string
+	for _, msg := range window.Messages {
+		got = append(got, names[msg.ID])
+	}
+	if got, want := strings.Join(got, ","), "m5,m4,m3,m1"; got != want {
+		t.Errorf("window = %s, want %s", got, want)
+	}
+	if msg := window.Messages[1]; msg.Body == nil || *msg.Body != "" || msg.Status != models.Unsent {
+		t.Errorf("unsent message kept content: %+v", msg)
+	}
+	if window.Older == "" || window.Newer == "" {
+		t.Fatalf("cursors = %q, %q, want both", window.Older, window.Newer)
+	}
+
+	older, next, err := s.GetChatMessages(ctx, "com.yoku.apen", "bob", "chat", window.Older, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(older) != 1 || older[0].ID != ids[0] || next != "" {
+		t.Errorf("older page = %v, %q", older, next)
+	}
+	newer, next, err := s.GetNewerMessages(ctx, "com.yoku.apen", "bob", "chat", window.Newer, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(newer) != 1 || newer[0].ID != ids[6] || next != "" {
+		t.Errorf("newer page = %v, %q", newer, next)
+	}
+
+	window, err = s.GetMessagesAround(ctx, "com.yoku.apen", "bob", "chat", ids[6], 1, 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(window.Messages) != 2 || window.Older == "" || window.Newer != "" {
+		t.Errorf("window at the end = %d messages, %q, %q", len(window.Messages), window.Older, window.Newer)
+	}
+
+	thread.msgs = append(thread.msgs, &models.Message{ID: "elsewhere", ChatID: "other", CreatedAt: start})
+	if _, err := s.GetMessagesAround(ctx, "com.yoku.apen", "bob", "chat", "elsewhere", 1, 1); err != models.ErrorNotAllowed {
+		t.Errorf("anchor in another chat: err = %v, want %v", err, models.ErrorNotAllowed)
+	}
+}
+
+// The hydration fakes count every store call in queries, standing in for
+// round trips to the database.
+type hydrationChats struct {
+	store.Chat
+	queries *int
+	chats   []*models.ChatRoom
+	msgs    map[string]*models.Message
+}
+
+func (f *hydrationChats) GetChats(ctx context.Context, appID, userID string, after *models.ChatCursor, count int, status models.ChatAnnotation, unreadOnly, isOfficialRole bool) ([]*models.ChatRoom, error) {
+	*f.queries++
+	chats := []*models.ChatRoom{}
+	for _, chat := range f.chats[:min(count, len(f.chats))] {
+		copied := *chat
+		chats = append(chats, &copied)
+	}
+	return chats, nil
+}
+
+func (f *hydrationChats) GetMessage(ctx context.Context, messageID string) (*models.Message, error) {
+	*f.queries++
+	copied := *f.msgs[messageID]
+	return &copied, nil
+}
+
+func (f *hydrationChats) GetMessagesByIDs(ctx context.Context, messageIDs []string) ([]*models.Message, error) {
+	*f.queries++
+	msgs := []*models.Message{}
+	for _, id := range messageIDs {
+		if msg, ok := f.msgs[id]; ok {
+			copied := *msg
+			msgs = append(msgs, &copied)
+		}
+	}
+	return msgs, nil
+}
+
+func (f *hydrationChats) GetReactions(ctx context.Context, messageIDs []string, userID string) (map[string][]*models.Reaction, error) {
+	*f.queries++
+	return map[string][]*models.Reaction{}, nil
+}
+
+type hydrationResumes struct {
+	store.Resume
+	queries *int
+}
+
+func (f hydrationResumes) ListRelations(ctx context.Context, appID string, opts ...models.ListRelationOptionFunc) ([]*models.ResumeRelation, error) {
+	*f.queries++
+	opt := models.ListRelationOption{}
+	for _, o := range opts {
+		o(&opt)
+	}
+	relations := []*models.ResumeRelation{}
+	for _, chatID := range opt.ChatIDs {
+		snapshotID := "rs-" + chatID
+		relations = append(relations, &models.ResumeRelation{ChatID: chatID, UserID: "seeker", SnapshotID: &snapshotID})
+	}
+	return relations, nil
+}
+
+func (f hydrationResumes) GetSnapshot(ctx context.Context, snapshotID string) (*models.ResumeSnapshot, error) {
+	*f.queries++
+	return &models.ResumeSnapshot{ID: snapshotID, Content: &models.ResumeContent{}}, nil
+}
+
+func (f hydrationResumes) ListSnapshots(ctx context.Context, snapshotIDs []string) ([]*models.ResumeSnapshot, error) {
+	*f.queries++
+	snapshots := []*models.ResumeSnapshot{}
+	for _, id := range snapshotIDs {
+		if strings.HasPrefix(id, "missing") {
+			continue
+		}
+		email := "seeker@example.com"
+		snapshots = append(snapshots, &models.ResumeSnapshot{ID: id, Content: &models.ResumeContent{Email: &email}})
+	}
+	return snapshots, nil
+}
+
+type hydrationCards struct {
+	store.BusinessCard
+	queries *int
+}
+
+func (f hydrationCards) GetSnapshotOwners(ctx context.Context, snapshotIDs []string) (map[string]string, error) {
+	*f.queries++
+	return map[string]string{}, nil
+}
+
+func (f hydrationCards) GetSnapshot(ctx context.Context, snapshotID string) (*models.BusinessCardSnapshot, error) {
+	*f.queries++
+	return &models.BusinessCardSnapshot{ID: snapshotID, Content: &models.BusinessCardContent{}}, nil
+}
+
+func (f hydrationCards) ListSnapshots(ctx context.Context, snapshotIDs []string) ([]*models.BusinessCardSnapshot, error) {
+	*f.queries++
+	snapshots := []*models.BusinessCardSnapshot{}
+	for _, id := range snapshotIDs {
+		snapshots = append(snapshots, &models.BusinessCardSnapshot{ID: id, Content: &models.BusinessCardContent{}})
+	}
+	return snapshots, nil
+}
+
+type hydrationMedia struct {
+	store.Media
+	queries *int
+}
+
+func (f hydrationMedia) Get(ctx context.Context, mediaIDs []string) ([]*models.Media, []string, error) {
+	*f.queries++
+	medias := []*models.Media{}
+	for _, id := range mediaIDs {
+		medias = append(medias, &models.Media{ID: id, Type: models.Image})
+	}
+	return medias, nil, nil
+}
+
+type hydrationSubscriptions struct {
+	store.Subscription
+	queries *int
+}
+
+func (f hydrationSubscriptions) Get(ctx context.Context, appID, userID string) (*models.UserSubscription, error) {
+	*f.queries++
+	return nil, sql.ErrNoRows
+}
+
+// newHydrationChatService returns a chat service over a page of n hire chats
+// whose last messages cycle through text, image, resume and business card,
+// and a pointer to the number of store calls it has made.
+func newHydrationChatService(n int) (*chatService, *int) {
+	queries := new(int)
+	chats := &hydrationChats{queries: queries, msgs: map[string]*models.Message{}}
+	postID := "post"
+	types := []models.MessageType{models.MsgText, models.MsgImage, models.MsgResume, models.MsgBusinessCard}
+	for i := 0; i < n; i++ {
+		chatID, msgID, cardID := fmt.Sprintf("chat-%d", i), fmt.Sprintf("msg-%d", i), fmt.Sprintf("bs-%d", i)
+		msg := &models.Message{ID: msgID, ChatID: chatID, SenderID: "seeker", Type: types[i%len(types)]}
+		switch msg.Type {
+		case models.MsgImage:
+			msg.MediaIDs = []string{"media-" + msgID}
+		case models.MsgResume, models.MsgBusinessCard:
+			ref := "ref-" + msgID
+			msg.RefID = &ref
+		}
+		chats.msgs[msgID] = msg
+		chats.chats = append(chats.chats, &models.ChatRoom{ChatID: chatID, PostID: &postID, LastMessageID: &msgID, BusinessCardSnapshotID: &cardID})
+	}
+	return &chatService{
+		a:  fakeApps{"com.yoku.apen": {ID: "app", BundleID: "com.yoku.apen"}},
+		c:  chats,
+		r:  hydrationResumes{queries: queries},
+		bc: hydrationCards{queries: queries},
+		m:  hydrationMedia{queries: queries},
+		s:  hydrationSubscriptions{queries: queries},
+	}, queries
+}
+
+func TestGetChatsMasksLastMessage(t *testing.T) {
+	ctx := context.Background()
+	s, _ := newHydrationChatService(4)
+	s.a = fakeApps{"com.yoku.apen": {ID: "app", BundleID: "com.yoku.apen", Config: &models.AppConfig{ResumeMasking: models.ResumeMaskingContact}}}
+
+	for _, tc := range []struct {
+		userID string
+		masked bool
+	}{
+		{"recruiter", true}, // the chats are locked
+		{"seeker", false},   // their own resume
+	} {
+		chats, _, err := s.GetChats(ctx, "com.yoku.apen", tc.userID, "", 4)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, chat := range chats {
+			if msg := chat.LastMessage; msg.Type == models.MsgResume {
+				if masked := msg.Resume.Email == nil; masked != tc.masked {
+					t.Errorf("%s: last message of %s masked = %v, want %v", tc.userID, chat.ChatID, masked, tc.masked)
+				}
+			}
+			if masked := chat.ResumeSnapshot.Content.Email == nil; masked != tc.masked {
+				t.Errorf("%s: resume of %s masked = %v, want %v", tc.userID, chat.ChatID, masked, tc.masked)
+			}
+		}
+	}
+}
+
+func TestGetChatsQueryCount(t *testing.T) {
+	ctx := context.Background()
+	var want int
+	for _, n := range []int{4, 20, 100} {
+		s, queries := newHydrationChatService(n)
+		chats, _, err := s.GetChats(ctx, "com.yoku.apen", "recruiter", "", n)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, chat := range chats {
+			if chat.LastMessage == nil || chat.ResumeSnapshot == nil || chat.BusinessCardSnapshot == nil {
+				t.Fatalf("%d chats: chat %s not hydrated", n, chat.ChatID)
+			}
+			switch msg := chat.LastMessage; msg.Type {
+			case models.MsgImage:
+				if len(msg.Medias) != 1 {
+					t.Errorf("%d chats: message %s has %d medias, want 1", n, msg.ID, len(msg.Medias))
+				}
+			case models.MsgResume:
+				if msg.Resume == nil {
+					t.Errorf("%d chats: message %s has no resume", n, msg.ID)
+				}
+			case models.MsgBusinessCard:
+				if msg.BusinessCard == nil {
+					t.Errorf("%d chats: message %s has no business card", n, msg.ID)
+				}
+			}
+		}
+		if want == 0 {
+			want = *queries
+		} else if *queries != want {
+			t.Errorf("%d chats cost %d queries, want %d like a page of 4", n, *queries, want)
+		}
+	}
+}
+
+func BenchmarkGetChatsHydration(b *testing.B) {
+	ctx := context.Background()
+	for _, n := range []int{5, 20, 100} {
+		b.Run(fmt.Sprintf("chats=%d", n), func(b *testing.B) {
+			s, queries := newHydrationChatService(n)
+			*queries = 0
+			for i := 0; i < b.N; i++ {
+				if _, _, err := s.GetChats(ctx, "com.yoku.apen", "recruiter", "", n); err != nil {
+					b.Fatal(err)
+				}
+			}
+			b.ReportMetric(float64(*queries)/float64(b.N), "queries/page")
+		})
+	}
+}
+
+func TestHydrateMessages(t *testing.T) {
+	ctx := context.Background()
+	s, queries := newHydrationChatService(8)
+	thread := s.c.(*hydrationChats)
+
+	page := func(n int) []*models.Message {
+		msgs := []*models.Message{}
+		for i := 0; i < n; i++ {
+			msg := *thread.msgs[fmt.Sprintf("msg-%d", i%8)]
+			msg.ID = fmt.Sprintf("page-%d", i)
+			replyTo := fmt.Sprintf("msg-%d", (i+1)%8)
+			msg.ReplyToMessageID = &replyTo
+			msgs = append(msgs, &msg)
+		}
+		return msgs
+	}
+
+	var want int
+	for _, n := range []int{4, 50} {
+		*queries = 0
+		msgs := page(n)
+		if failures, err := s.hydrateMessages(ctx, "recruiter", msgs, true); err != nil || len(failures) > 0 {
+			t.Fatal(failures, err)
+		}
+		for _, msg := range msgs {
+			if msg.ReplyTo == nil {
+				t.Fatalf("%d messages: %s has no reply", n, msg.ID)
+			}
+			for _, m := range []*models.Message{msg, msg.ReplyTo} {
+				if m.Type == models.MsgResume && m.Resume == nil || m.Type == models.MsgBusinessCard && m.BusinessCard == nil || m.Type == models.MsgImage && len(m.Medias) != 1 {
+					t.Errorf("%d messages: %s not hydrated", n, m.ID)
+				}
+			}
+		}
+		if want == 0 {
+			want = *queries
+		} else if *queries != want {
+			t.Errorf("%d messages cost %d queries, want %d like a page of 4", n, *queries, want)
+		}
+	}
+
+	// failures name their message and do not stop the rest of the page
+	msgs := page(4)
+	missing, gone := "missing-snapshot", "gone"
+	msgs[2].RefID = &missing
+	msgs[3].ReplyToMessageID = &gone
+	failures, err := s.hydrateMessages(ctx, "recruiter", msgs, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	failed := errors.Join(failures...)
+	if len(failures) != 2 || !strings.Contains(failed.Error(), "message page-2:") || !strings.Contains(failed.Error(), "message page-3:") {
+		t.Fatalf("failures = %v, want page-2 and page-3", failed)
+	}
+	if !errors.Is(failed, sql.ErrNoRows) {
+		t.Errorf("failures = %v, want them to wrap %v", failed, sql.ErrNoRows)
+	}
+	if msgs[2].ContentError == "" || msgs[3].ContentError == "" || msgs[1].ContentError != "" {
+		t.Errorf("content errors = %q, %q, %q; want them on page-2 and page-3 only", msgs[1].ContentError, msgs[2].ContentError, msgs[3].ContentError)
+	}
+	if msgs[1].Medias == nil || len(msgs[1].Medias) != 1 {
+		t.Errorf("page-1 lost its media after other failures")
+	}
+
+	// a page with such a message is still shown, the message flagged
+	msgs = page(4)
+	msgs[2].RefID = &missing
+	got, err := s.aggregateMessages(ctx, "recruiter", msgs)
+	if err != nil || len(got) != 4 {
+		t.Fatalf("aggregateMessages = %d messages, %v; want the page of 4", len(got), err)
+	}
+	if got[2].ContentError == "" {
+		t.Errorf("page-2 has no content error")
+	}
+}
+
+type receiptRecorder []*models.ReadReceipt
+
+func (r *receiptRecorder) NotifyRead(ctx context.Context, receipt *models.ReadReceipt) error {
+	*r = append(*r, receipt)
+	return nil
+}
+
+func TestReadReceipts(t *testing.T) {
+	ctx := context.Background()
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	thread := &fakeThread{chatID: "chat"}
+	for i, sender := range []string{"alice", "bob", "alice"} {
+		body := "hi"
+		thread.msgs = append(thread.msgs, &models.Message{ID: fmt.Sprintf("m%d", i), ChatID: "chat", SenderID: sender, Type: models.MsgText, Body: &body, CreatedAt: start.Add(time.Duration(i) * time.Minute)})
+	}
+	receipts := &receiptRecorder{}
+	s := NewChat(thread, nil, fakeApps{"com.yoku.apen": {ID: "app", BundleID: "com.yoku.apen"}}, nil, nil, nil, nil, nil, WithReadNotifier(receipts))
+
+	msgs, _, err := s.GetChatMessages(ctx, "com.yoku.apen", "alice", "chat", "", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, msg := range msgs {
+		if msg.SenderID == "bob" && msg.IsReadByReceiver != nil {
+			t.Errorf("%s: read state on bob's message shown to alice", msg.ID)
+		}
+		if msg.SenderID == "alice" && (msg.IsReadByReceiver == nil || *msg.IsReadByReceiver) {
+			t.Errorf("%s: want unread before bob reads", msg.ID)
+		}
+	}
+
+	if err := s.Read(ctx, "com.yoku.apen", "bob", "chat"); err != nil {
+		t.Fatal(err)
+	}
+	want := models.ReadReceipt{ChatID: "chat", ReaderID: "bob", SenderID: "alice", ReadAt: start.Add(2 * time.Minute)}
+	if len(*receipts) != 1 || *(*receipts)[0] != want {
+		t.Errorf("receipts = %+v, want %+v", *receipts, want)
+	}
+
+	msgs, _, err = s.GetChatMessages(ctx, "com.yoku.apen", "alice", "chat", "", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, msg := range msgs {
+		if msg.SenderID != "alice" {
+			continue
+		}
+		if msg.IsReadByReceiver == nil || !*msg.IsReadByReceiver || msg.ReadAt == nil || !msg.ReadAt.Equal(want.ReadAt) {
+			t.Errorf("%s: read = %v at %v, want read at %v", msg.ID, msg.IsReadByReceiver, msg.ReadAt, want.ReadAt)
+		}
+	}
+}
+
+func TestReactions(t *testing.T) {
+	ctx := context.Background()
+	thread := &fakeThread{chatID: "chat"}
+	body := "hi"
+	for i, status := range []models.MessageStatus{models.Normal, models.Unsent} {
+		thread.msgs = append(thread.msgs, &models.Message{ID: fmt.Sprintf("m%d", i), ChatID: "chat", SenderID: "alice", Type: models.MsgText, Body: &body, Status: status})
+	}
+	s := NewChat(thread, nil, fakeApps{"com.yoku.apen": {ID: "app", BundleID: "com.yoku.apen"}}, nil, nil, nil, nil, nil)
+
+	for _, r := range []struct{ userID, emoji string }{{"alice", "👍"}, {"bob", "👍"}, {"bob", "👍"}, {"bob", "❤️"}, {"bob", "1️⃣"}} {
+		if err := s.React(ctx, "com.yoku.apen", r.userID, "m0", r.emoji); err != nil {
+			t.Fatalf("%s reacting %s: %v", r.userID, r.emoji, err)
+		}
+	}
+	if err := s.Unreact(ctx, "com.yoku.apen", "bob", "m0", "1️⃣"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.React(ctx, "com.yoku.apen", "bob", "m0", "ok"); err != models.ErrorWrongParams {
+		t.Errorf("reacting with text: err = %v, want %v", err, models.ErrorWrongParams)
+	}
+	if err := s.React(ctx, "com.yoku.apen", "bob", "m1", "👍"); err != models.ErrorNotAllowed {
+		t.Errorf("reacting to an unsent message: err = %v, want %v", err, models.ErrorNotAllowed)
+	}
+
+	msgs, _, err := s.GetChatMessages(ctx, "com.yoku.apen", "alice", "chat", "", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := map[string][]*models.Reaction{}
+	for _, msg := range msgs {
+		got[msg.ID] = msg.Reactions
+	}
+	want := []models.Reaction{{Emoji: "👍", Count: 2, Mine: true}, {Emoji: "❤️", Count: 1, Mine: false}}
+	if len(got["m0"]) != len(want) {
+		t.Fatalf("reactions = %v, want %v", got["m0"], want)
+	}
+	for i := range want {
+		if *got["m0"][i] != want[i] {
+			t.Errorf("reaction %d = %+v, want %+v", i, *got["m0"][i], want[i])
+		}
+	}
+	if len(got["m1"]) != 0 {
+		t.Errorf("unsent message has reactions %v", got["m1"])
+	}
+}
+
+// fakeTickets is a store.Ticket whose UnlockChat is all or nothing, like
+// the transaction it stands in for.
+type fakeTickets struct {
+	store.Ticket
+	balance   int
+	unlocked  map[string]bool
+	ledger    []*models.TicketLedgerEntry
+	ledgerErr error
+}
+
+func (f *fakeTickets) UnlockChat(ctx context.Context, appID, userID, chatID string) (bool, error) {
+	if f.unlocked[chatID] {
+		return false, nil
+	}
+	if f.balance <= 0 {
+		return false, models.ErrorInsufficientQuota
+	}
+	if f.ledgerErr != nil {
+		return false, f.ledgerErr
+	}
+	f.balance--
+	f.ledger = append(f.ledger, &models.TicketLedgerEntry{AppID: appID, UserID: userID, Delta: -1, Reason: models.TicketReasonUnlockChat, ChatID: &chatID})
+	f.unlocked[chatID] = true
+	return true, nil
+}
+
+func TestUnlock(t *testing.T) {
+	errLedger := errors.New("ledger is down")
+	cases := []struct {
+		name        string
+		balance     int
+		unlocked    bool
+		ledgerErr   error
+		want        error
+		wantBalance int
+		wantLedger  int
+	}{
+		{"enough tickets", 2, false, nil, nil, 1, 1},
+		{"no tickets", 0, false, nil, models.ErrorInsufficientQuota, 0, 0},
+		{"already unlocked", 1, true, nil, nil, 1, 0},
+		{"ledger insert fails", 1, false, errLedger, errLedger, 1, 0},
+	}
+	for _, c := range cases {
+		tickets := &fakeTickets{balance: c.balance, unlocked: map[string]bool{"chat": c.unlocked}, ledgerErr: c.ledgerErr}
+		queries := 0
+		// alice recruits bob, and has no subscription
+		s := NewChat(postThread{&fakeThread{chatID: "chat"}}, bobsResume{}, fakeApps{"com.yoku.apen": {ID: "app", BundleID: "com.yoku.apen"}}, nil, hydrationSubscriptions{queries: &queries}, nil, tickets, nil)
+
+		if err := s.Unlock(context.Background(), "com.yoku.apen", "alice", "chat"); err != c.want {
+			t.Errorf("%s: err = %v, want %v", c.name, err, c.want)
+		}
+		if tickets.balance != c.wantBalance || len(tickets.ledger) != c.wantLedger {
+			t.Errorf("%s: balance %d with %d ledger entries, want %d with %d", c.name, tickets.balance, len(tickets.ledger), c.wantBalance, c.wantLedger)
+		}
+		if unlocked := tickets.unlocked["chat"]; unlocked != (c.unlocked || c.want == nil) {
+			t.Errorf("%s: unlocked = %v", c.name, unlocked)
+		}
+
+		// unlocking again spends nothing
+		if c.want == nil {
+			if err := s.Unlock(context.Background(), "com.yoku.apen", "alice", "chat"); err != nil || tickets.balance != c.wantBalance {
+				t.Errorf("%s: unlock again = %v with balance %d, want nil with %d", c.name, err, tickets.balance, c.wantBalance)
+			}
+		}
+	}
+
+	// bob, the job seeker, cannot unlock
+	s := NewChat(postThread{&fakeThread{chatID: "chat"}}, bobsResume{}, fakeApps{"com.yoku.apen": {ID: "app", BundleID: "com.yoku.apen"}}, nil, nil, nil, &fakeTickets{balance: 1, unlocked: map[string]bool{}}, nil)
+	if err := s.Unlock(context.Background(), "com.yoku.apen", "bob", "chat"); err != models.ErrorNotAllowed {
+		t.Errorf("job seeker: err = %v, want %v", err, models.ErrorNotAllowed)
+	}
+}
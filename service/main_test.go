@@ -0,0 +1,16 @@
+package service
+
+import (
+	"os"
+	"testing"
+
+	"github.com/A-pen-app/logging"
+)
+
+func TestMain(m *testing.M) {
+	// error paths log; without a logger they would panic
+	if err := logging.Initialize(nil); err != nil {
+		panic(err)
+	}
+	os.Exit(m.Run())
+}
@@ -0,0 +1,284 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"image"
+	"io"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/A-pen-app/hire-sdk/models"
+	"github.com/A-pen-app/hire-sdk/store"
+	"github.com/A-pen-app/logging"
+	"github.com/google/uuid"
+)
+
+type MediaConfig struct {
+	// UploadTTL is how long an upload intent's URL stays valid. Defaults to
+	// 15 minutes.
+	UploadTTL time.Duration
+
+	// DownloadTTL is how long a signed download URL stays valid. Defaults to
+	// one hour.
+	DownloadTTL time.Duration
+
+	// MaxBytes is the upload size limit per media type; types left out use
+	// defaultMaxUploadBytes. Apps can override it through
+	// AppConfig.MaxUploadBytes.
+	MaxBytes map[models.MediaType]int64
+}
+
+var defaultMaxUploadBytes = map[models.MediaType]int64{
+	models.Image: 10 << 20,
+	models.Audio: 50 << 20,
+	models.Video: 200 << 20,
+	models.File:  50 << 20,
+}
+
+// sniffLen is how much of an upload http.DetectContentType looks at.
+const sniffLen = 512
+
+type mediaService struct {
+	a   store.App
+	m   store.Media
+	b   store.Blob
+	cfg MediaConfig
+}
+
+func NewMedia(a store.App, m store.Media, b store.Blob, cfg MediaConfig) Media {
+	if cfg.UploadTTL <= 0 {
+		cfg.UploadTTL = 15 * time.Minute
+	}
+	if cfg.DownloadTTL <= 0 {
+		cfg.DownloadTTL = time.Hour
+	}
+	maxBytes := make(map[models.MediaType]int64, len(defaultMaxUploadBytes))
+	for t, limit := range defaultMaxUploadBytes {
+		maxBytes[t] = limit
+	}
+	for t, limit := range cfg.MaxBytes {
+		maxBytes[t] = limit
+	}
+	cfg.MaxBytes = maxBytes
+	return &mediaService{a: a, m: m, b: b, cfg: cfg}
+}
+
+// NewUploadIntent reserves a blob key under the user's prefix and returns a
+// signed URL the client uploads the file to.
+func (s *mediaService) NewUploadIntent(ctx context.Context, bundleID, userID, filename string) (*models.UploadIntent, error) {
+	app, err := s.a.GetByBundleID(ctx, bundleID)
+	if err != nil {
+		logging.Errorw(ctx, "failed to get app by bundle ID", "err", err, "bundleID", bundleID)
+		return nil, err
+	}
+
+	key := uploadPrefix(app.ID, userID) + uuid.New().String() + uploadExt(filename)
+	signed, err := s.b.SignedURL(ctx, http.MethodPut, key, s.cfg.UploadTTL)
+	if err != nil {
+		logging.Errorw(ctx, "failed to sign upload url", "err", err, "key", key)
+		return nil, err
+	}
+	return &models.UploadIntent{
+		Key:       key,
+		Method:    http.MethodPut,
+		URL:       signed,
+		ExpiresAt: time.Now().Add(s.cfg.UploadTTL),
+	}, nil
+}
+
+// CompleteUpload runs an uploaded intent through the upload pipeline and
+// creates its media. The key must be one of the user's own intents. The
+// pipeline enforces the size limit from the object's metadata and sniffs
+// the content type, which must match upload.MediaType, from its first
+// bytes. Only images are read whole: it records their dimensions, fills
+// Placeholder with a blurhash and strips GPS data from their Exif and XMP
+// metadata. Rejected uploads are deleted and return ErrorWrongParams. A
+// retry for a key that already has its media returns the same media ID.
+func (s *mediaService) CompleteUpload(ctx context.Context, bundleID, userID, key string, upload *models.MediaUpload) (string, error) {
+	if upload == nil {
+		return "", models.ErrorWrongParams
+	}
+	limit, ok := s.cfg.MaxBytes[upload.MediaType]
+	if !ok {
+		return "", models.ErrorWrongParams
+	}
+
+	app, err := s.a.GetByBundleID(ctx, bundleID)
+	if err != nil {
+		logging.Errorw(ctx, "failed to get app by bundle ID", "err", err, "bundleID", bundleID)
+		return "", err
+	}
+	if !ownsUpload(app.ID, userID, key) {
+		return "", models.ErrorNotAllowed
+	}
+	limit = app.Config.UploadLimit(upload.MediaType, limit)
+
+	size, err := s.b.Stat(ctx, key)
+	if err == models.ErrorNotFound {
+		return "", models.ErrorWrongParams
+	} else if err != nil {
+		logging.Errorw(ctx, "failed to stat upload", "err", err, "key", key)
+		return "", err
+	}
+	if size > limit {
+		return "", s.reject(ctx, key)
+	}
+
+	r, err := s.b.Get(ctx, key)
+	if err != nil {
+		logging.Errorw(ctx, "failed to read upload", "err", err, "key", key)
+		return "", err
+	}
+	defer r.Close()
+
+	// the type is told from the first bytes; only images are read whole
+	head := make([]byte, sniffLen)
+	n, err := io.ReadFull(r, head)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		logging.Errorw(ctx, "failed to read upload", "err", err, "key", key)
+		return "", err
+	}
+	head = head[:n]
+
+	contentType := http.DetectContentType(head)
+	if !upload.MediaType.Accepts(contentType) {
+		return "", s.reject(ctx, key)
+	}
+
+	stored := *upload
+	stored.URL = ""
+	stored.StorageKey = &key
+	stored.OwnerID = &userID
+	stored.ContentType = &contentType
+
+	sizeBytes := size
+	if upload.MediaType == models.Image {
+		data, err := io.ReadAll(io.LimitReader(io.MultiReader(bytes.NewReader(head), r), limit+1))
+		if err != nil {
+			logging.Errorw(ctx, "failed to read upload", "err", err, "key", key)
+			return "", err
+		}
+		if int64(len(data)) > limit {
+			return "", s.reject(ctx, key)
+		}
+		data, ok, err = s.processImage(ctx, key, data, contentType, &stored)
+		if err != nil {
+			return "", err
+		}
+		if !ok {
+			return "", s.reject(ctx, key)
+		}
+		sizeBytes = int64(len(data))
+	}
+
+	sizeText := formatSize(sizeBytes)
+	stored.SizeBytes = &sizeBytes
+	stored.Size = &sizeText
+	return s.m.New(ctx, &stored)
+}
+
+// processImage fills in the dimensions and blurhash of a decodable image and
+// writes the image back without its GPS data. It returns the image as
+// stored, and false for an image that can't be used. Formats the standard library can't decode (e.g.
+// WebP) are kept without dimensions or placeholder, but are still stripped.
+func (s *mediaService) processImage(ctx context.Context, key string, data []byte, contentType string, upload *models.MediaUpload) ([]byte, bool, error) {
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil && err != image.ErrFormat {
+		return nil, false, nil
+	}
+	if err == nil {
+		if config.Width <= 0 || config.Height <= 0 || int64(config.Width)*int64(config.Height) > maxImagePixels {
+			return nil, false, nil
+		}
+		img, _, err := image.Decode(bytes.NewReader(data))
+		if err != nil {
+			return nil, false, nil
+		}
+		placeholder := blurhash(img)
+		upload.Width = &config.Width
+		upload.Height = &config.Height
+		upload.Placeholder = &placeholder
+	}
+
+	if stripped, ok := stripGPS(data); ok {
+		if err := s.b.Put(ctx, key, bytes.NewReader(stripped), int64(len(stripped)), contentType); err != nil {
+			logging.Errorw(ctx, "failed to rewrite upload without gps", "err", err, "key", key)
+			return nil, false, err
+		}
+		return stripped, true, nil
+	}
+	return data, true, nil
+}
+
+// reject deletes a rejected upload so it doesn't linger in the blob store.
+func (s *mediaService) reject(ctx context.Context, key string) error {
+	if err := s.b.Delete(ctx, key); err != nil {
+		logging.Errorw(ctx, "failed to delete rejected upload", "err", err, "key", key)
+	}
+	return models.ErrorWrongParams
+}
+
+// formatSize renders n bytes for the legacy free-form Size field.
+func formatSize(n int64) string {
+	switch {
+	case n >= 1<<20:
+		return strconv.FormatFloat(float64(n)/(1<<20), 'f', 1, 64) + " MB"
+	case n >= 1<<10:
+		return strconv.FormatFloat(float64(n)/(1<<10), 'f', 1, 64) + " KB"
+	default:
+		return strconv.FormatInt(n, 10) + " B"
+	}
+}
+
+// Sign replaces the URL of every blob-backed media with a signed download
+// URL valid for DownloadTTL. Media with a plain URL is left as is.
+func (s *mediaService) Sign(ctx context.Context, medias []*models.Media) error {
+	for _, media := range medias {
+		if media == nil || media.StorageKey == nil {
+			continue
+		}
+		signed, err := s.b.SignedURL(ctx, http.MethodGet, *media.StorageKey, s.cfg.DownloadTTL)
+		if err != nil {
+			logging.Errorw(ctx, "failed to sign download url", "err", err, "key", *media.StorageKey)
+			return err
+		}
+		media.URL = models.URL(signed)
+	}
+	return nil
+}
+
+func uploadPrefix(appID, userID string) string {
+	return fmt.Sprintf("%s/%s/", appID, userID)
+}
+
+// ownsUpload reports whether key is one CreateUpload minted for userID: the
+// user's prefix followed by a UUID and an optional extension, so no other
+// path segment can follow.
+func ownsUpload(appID, userID, key string) bool {
+	name, ok := strings.CutPrefix(key, uploadPrefix(appID, userID))
+	if !ok {
+		return false
+	}
+	_, err := uuid.Parse(strings.TrimSuffix(name, path.Ext(name)))
+	return err == nil
+}
+
+// uploadExt keeps a short alphanumeric extension of filename, so stored
+// objects stay recognizable without letting the client pick the key.
+func uploadExt(filename string) string {
+	ext := strings.ToLower(path.Ext(filename))
+	if len(ext) < 2 || len(ext) > 10 {
+		return ""
+	}
+	for _, c := range ext[1:] {
+		if !('a' <= c && c <= 'z' || '0' <= c && c <= '9') {
+			return ""
+		}
+	}
+	return ext
+}
@@ -0,0 +1,408 @@
+package service
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"image"
+	_ "image/gif" // register decoders for image.Decode
+	_ "image/jpeg"
+	_ "image/png"
+	"math"
+	"regexp"
+	"strings"
+)
+
+// maxImagePixels bounds the images the upload pipeline decodes, so a small
+// file can't expand into more than 64MB of RGBA pixels. It still fits the
+// 12MP photos phones take by default.
+const maxImagePixels = 16_000_000
+
+// blurhash sampling: components per axis and the largest grid of pixels
+// that is sampled, which is plenty for a 4x3 hash.
+const (
+	blurhashX      = 4
+	blurhashY      = 3
+	blurhashSample = 64
+)
+
+const blurhashChars = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz#$%*+,-.:;=?@[]^_{|}~"
+
+// blurhash encodes img as a https://blurha.sh placeholder string.
+func blurhash(img image.Image) string {
+	bounds := img.Bounds()
+	w, h := bounds.Dx(), bounds.Dy()
+	if w == 0 || h == 0 {
+		return ""
+	}
+	sw, sh := min(w, blurhashSample), min(h, blurhashSample)
+
+	// linear RGB of the sampled grid
+	pixels := make([][3]float64, sw*sh)
+	for y := 0; y < sh; y++ {
+		for x := 0; x < sw; x++ {
+			r, g, b, _ := img.At(bounds.Min.X+x*w/sw, bounds.Min.Y+y*h/sh).RGBA()
+			pixels[y*sw+x] = [3]float64{srgbToLinear(r >> 8), srgbToLinear(g >> 8), srgbToLinear(b >> 8)}
+		}
+	}
+
+	factors := make([][3]float64, 0, blurhashX*blurhashY)
+	for j := 0; j < blurhashY; j++ {
+		for i := 0; i < blurhashX; i++ {
+			normalisation := 2.0
+			if i == 0 && j == 0 {
+				normalisation = 1
+			}
+			var f [3]float64
+			for y := 0; y < sh; y++ {
+				for x := 0; x < sw; x++ {
+					basis := math.Cos(math.Pi*float64(i*x)/float64(sw)) * math.Cos(math.Pi*float64(j*y)/float64(sh))
+					p := pixels[y*sw+x]
+					f[0] += basis * p[0]
+					f[1] += basis * p[1]
+					f[2] += basis * p[2]
+				}
+			}
+			scale := normalisation / float64(sw*sh)
+			factors = append(factors, [3]float64{f[0] * scale, f[1] * scale, f[2] * scale})
+		}
+	}
+
+	var sb strings.Builder
+	encode83(&sb, (blurhashX-1)+(blurhashY-1)*9, 1)
+
+	dc, ac := factors[0], factors[1:]
+	actualMax := 0.0
+	for _, f := range ac {
+		actualMax = math.Max(actualMax, math.Max(math.Abs(f[0]), math.Max(math.Abs(f[1]), math.Abs(f[2]))))
+	}
+	quantisedMax := int(math.Max(0, math.Min(82, math.Floor(actualMax*166-0.5))))
+	maxValue := float64(quantisedMax+1) / 166
+	encode83(&sb, quantisedMax, 1)
+
+	encode83(&sb, linearToSRGB(dc[0])<<16|linearToSRGB(dc[1])<<8|linearToSRGB(dc[2]), 4)
+	for _, f := range ac {
+		q := func(v float64) int {
+			return int(math.Max(0, math.Min(18, math.Floor(signPow(v/maxValue, 0.5)*9+9.5))))
+		}
+		encode83(&sb, q(f[0])*19*19+q(f[1])*19+q(f[2]), 2)
+	}
+	return sb.String()
+}
+
+func encode83(sb *strings.Builder, value, length int) {
+	for i := 1; i <= length; i++ {
+		digit := (value / int(math.Pow(83, float64(length-i)))) % 83
+		sb.WriteByte(blurhashChars[digit])
+	}
+}
+
+func srgbToLinear(v uint32) float64 {
+	c := float64(v) / 255
+	if c <= 0.04045 {
+		return c / 12.92
+	}
+	return math.Pow((c+0.055)/1.055, 2.4)
+}
+
+func linearToSRGB(v float64) int {
+	v = math.Max(0, math.Min(1, v))
+	if v <= 0.0031308 {
+		return int(v*12.92*255 + 0.5)
+	}
+	return int((1.055*math.Pow(v, 1/2.4)-0.055)*255 + 0.5)
+}
+
+func signPow(v, exp float64) float64 {
+	return math.Copysign(math.Pow(math.Abs(v), exp), v)
+}
+
+// exifTypeSizes is the byte size of each TIFF field type.
+var exifTypeSizes = map[uint16]uint32{1: 1, 2: 1, 3: 2, 4: 4, 5: 8, 6: 1, 7: 1, 8: 2, 9: 4, 10: 8, 11: 4, 12: 8}
+
+const exifGPSInfoTag = 0x8825
+
+// stripGPS removes the location from the Exif and XMP metadata of a JPEG,
+// PNG, WebP or GIF image. Metadata is blanked in place where the format
+// allows it, so orientation and the rest of it stay intact; what can't be
+// edited in place, such as compressed XMP in a PNG, is dropped. It returns
+// the image and whether anything was removed. Malformed files are left as
+// they are from the first broken block on.
+func stripGPS(data []byte) ([]byte, bool) {
+	switch {
+	case bytes.HasPrefix(data, []byte{0xFF, 0xD8}):
+		return data, stripJPEGGPS(data)
+	case bytes.HasPrefix(data, pngSignature):
+		return stripPNGGPS(data)
+	case len(data) >= 12 && string(data[:4]) == "RIFF" && string(data[8:12]) == "WEBP":
+		return data, stripWebPGPS(data)
+	case bytes.HasPrefix(data, []byte("GIF8")):
+		return stripGIFGPS(data)
+	}
+	return data, false
+}
+
+// stripJPEGGPS blanks the GPS IFD of every Exif segment of a JPEG in place:
+// every GPS value and entry is zeroed and the IFD is left empty, so no
+// location survives in the bytes while orientation and the rest of the Exif
+// data stay intact. GPS properties of XMP segments are blanked too. It
+// reports whether anything was removed. Malformed segments are left alone.
+func stripJPEGGPS(data []byte) bool {
+	if len(data) < 4 || data[0] != 0xFF || data[1] != 0xD8 {
+		return false
+	}
+	stripped := false
+	for pos := 2; pos+4 <= len(data); {
+		if data[pos] != 0xFF {
+			return stripped
+		}
+		marker := data[pos+1]
+		if marker == 0xDA || marker == 0xD9 { // start of scan, end of image
+			return stripped
+		}
+		length := int(binary.BigEndian.Uint16(data[pos+2:]))
+		end := pos + 2 + length
+		if length < 2 || end > len(data) {
+			return stripped
+		}
+		segment := data[pos+4 : end]
+		if marker == 0xE1 && bytes.HasPrefix(segment, []byte("Exif\x00\x00")) {
+			if stripTIFFGPS(segment[6:]) {
+				stripped = true
+			}
+		} else if marker == 0xE1 && bytes.HasPrefix(segment, []byte("http://ns.adobe.com/")) {
+			if stripXMPGPS(segment) {
+				stripped = true
+			}
+		}
+		pos = end
+	}
+	return stripped
+}
+
+func stripTIFFGPS(tiff []byte) bool {
+	if len(tiff) < 8 {
+		return false
+	}
+	var order binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return false
+	}
+
+	entries := func(ifd uint32) (uint32, int) {
+		if uint64(ifd)+2 > uint64(len(tiff)) {
+			return 0, 0
+		}
+		n := int(order.Uint16(tiff[ifd:]))
+		if uint64(ifd)+2+uint64(n)*12 > uint64(len(tiff)) {
+			return 0, 0
+		}
+		return ifd + 2, n
+	}
+
+	start, n := entries(order.Uint32(tiff[4:]))
+	gps := uint32(0)
+	for i := 0; i < n; i++ {
+		entry := tiff[start+uint32(i)*12:]
+		if order.Uint16(entry) == exifGPSInfoTag {
+			gps = order.Uint32(entry[8:])
+		}
+	}
+	if gps == 0 {
+		return false
+	}
+
+	start, n = entries(gps)
+	if n == 0 {
+		return false
+	}
+	for i := 0; i < n; i++ {
+		entry := tiff[start+uint32(i)*12 : start+uint32(i+1)*12]
+		size := uint64(exifTypeSizes[order.Uint16(entry[2:])]) * uint64(order.Uint32(entry[4:]))
+		if size > 4 {
+			offset := uint64(order.Uint32(entry[8:]))
+			if offset+size <= uint64(len(tiff)) {
+				clear(tiff[offset : offset+size])
+			}
+		}
+		clear(entry)
+	}
+	order.PutUint16(tiff[gps:], 0)
+	return true
+}
+
+var pngSignature = []byte("\x89PNG\r\n\x1a\n")
+
+// pngTextKeywords are the PNG text chunks that carry Exif or XMP, as written
+// by Adobe tools and ImageMagick.
+var pngTextKeywords = map[string]bool{
+	"XML:com.adobe.xmp":     true,
+	"Raw profile type exif": true,
+	"Raw profile type APP1": true,
+	"Raw profile type xmp":  true,
+}
+
+// stripPNGGPS blanks GPS data in the eXIf chunk and uncompressed XMP of a
+// PNG and updates their checksums. Compressed or hex encoded metadata in
+// text chunks is dropped.
+func stripPNGGPS(data []byte) ([]byte, bool) {
+	out := append([]byte{}, data[:len(pngSignature)]...)
+	stripped := false
+	for pos := len(pngSignature); pos < len(data); {
+		if pos+12 > len(data) {
+			return data, stripped
+		}
+		length := uint64(binary.BigEndian.Uint32(data[pos:]))
+		end := uint64(pos) + 12 + length
+		if end > uint64(len(data)) {
+			return data, stripped
+		}
+		chunk := data[pos:end]
+		typ, body := string(chunk[4:8]), chunk[8:8+length]
+
+		edited, drop := false, false
+		switch typ {
+		case "eXIf":
+			edited = stripTIFFGPS(body)
+		case "iTXt", "tEXt", "zTXt":
+			keyword, rest, _ := bytes.Cut(body, []byte{0})
+			if !pngTextKeywords[string(keyword)] {
+				break
+			}
+			// an iTXt is uncompressed when its compression flag is 0
+			if typ == "iTXt" && len(rest) > 0 && rest[0] == 0 {
+				edited = stripXMPGPS(rest)
+			} else {
+				drop = true
+			}
+		}
+		if edited {
+			binary.BigEndian.PutUint32(chunk[8+length:], crc32.ChecksumIEEE(chunk[4:8+length]))
+		}
+		stripped = stripped || edited || drop
+		if !drop {
+			out = append(out, chunk...)
+		}
+		pos = int(end)
+	}
+	return out, stripped
+}
+
+// stripWebPGPS blanks GPS data in the EXIF and XMP chunks of a WebP in
+// place.
+func stripWebPGPS(data []byte) bool {
+	stripped := false
+	for pos := 12; pos+8 <= len(data); {
+		size := uint64(binary.LittleEndian.Uint32(data[pos+4:]))
+		end := uint64(pos) + 8 + size
+		if end > uint64(len(data)) {
+			return stripped
+		}
+		body := data[pos+8 : end]
+		switch string(data[pos : pos+4]) {
+		case "EXIF":
+			// some writers keep the JPEG segment's Exif header
+			body = bytes.TrimPrefix(body, []byte("Exif\x00\x00"))
+			if stripTIFFGPS(body) {
+				stripped = true
+			}
+		case "XMP ":
+			if stripXMPGPS(body) {
+				stripped = true
+			}
+		}
+		// chunks are padded to an even size
+		pos = int(end + size&1)
+	}
+	return stripped
+}
+
+// stripGIFGPS drops the XMP application extensions of a GIF, whose raw
+// packet can't be edited without breaking the sub-blocks it is read as.
+func stripGIFGPS(data []byte) ([]byte, bool) {
+	if len(data) < 13 {
+		return data, false
+	}
+	pos := 13
+	if flags := data[10]; flags&0x80 != 0 {
+		pos += 3 << (flags&7 + 1)
+	}
+	out := append([]byte{}, data[:min(pos, len(data))]...)
+	stripped := false
+	for pos < len(data) {
+		start := pos
+		switch data[pos] {
+		case 0x21: // extension
+			if pos+2 > len(data) {
+				return data, stripped
+			}
+			xmp := data[pos+1] == 0xFF && bytes.HasPrefix(data[pos+2:], []byte("\x0bXMP DataXMP"))
+			if pos = skipGIFSubBlocks(data, pos+2); pos < 0 {
+				return data, stripped
+			}
+			if xmp {
+				stripped = true
+				continue
+			}
+		case 0x2C: // image descriptor
+			if pos+11 > len(data) {
+				return data, stripped
+			}
+			flags := data[pos+9]
+			pos += 10
+			if flags&0x80 != 0 {
+				pos += 3 << (flags&7 + 1)
+			}
+			// the LZW minimum code size precedes the image data
+			if pos = skipGIFSubBlocks(data, pos+1); pos < 0 {
+				return data, stripped
+			}
+		case 0x3B: // trailer
+			return append(out, data[pos:]...), stripped
+		default:
+			return data, stripped
+		}
+		out = append(out, data[start:pos]...)
+	}
+	return data, stripped
+}
+
+// skipGIFSubBlocks returns the position after the sub-blocks starting at
+// pos, or -1 if they run past the end of data.
+func skipGIFSubBlocks(data []byte, pos int) int {
+	for pos < len(data) {
+		n := int(data[pos])
+		pos++
+		if n == 0 {
+			return pos
+		}
+		pos += n
+	}
+	return -1
+}
+
+// xmpGPSProperties matches the GPS properties of an XMP packet (e.g.
+// exif:GPSLatitude), written either as attributes or as elements.
+var xmpGPSProperties = regexp.MustCompile(`(?is)\s[\w-]+:gps\w*\s*=\s*(?:"[^"]*"|'[^']*')|<[\w-]+:gps\w*[^>]*/>|<[\w-]+:gps\w*[^>]*>.*?</[\w-]+:gps\w*\s*>`)
+
+// stripXMPGPS blanks the GPS properties of an XMP packet in place with
+// spaces, which keeps its size and leaves valid XML. Namespace declarations
+// that happen to match stay, as their prefix may still be in use.
+func stripXMPGPS(xmp []byte) bool {
+	stripped := false
+	for _, m := range xmpGPSProperties.FindAllIndex(xmp, -1) {
+		if bytes.HasPrefix(bytes.TrimSpace(xmp[m[0]:m[1]]), []byte("xmlns:")) {
+			continue
+		}
+		for i := m[0]; i < m[1]; i++ {
+			xmp[i] = ' '
+		}
+		stripped = true
+	}
+	return stripped
+}
@@ -0,0 +1,434 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/A-pen-app/hire-sdk/models"
+	"github.com/A-pen-app/hire-sdk/store"
+)
+
+type fakeApps map[string]*models.App
+
+func (f fakeApps) GetByBundleID(ctx context.Context, bundleID string) (*models.App, error) {
+	app, ok := f[bundleID]
+	if !ok {
+		return nil, models.ErrorNotFound
+	}
+	return app, nil
+}
+
+// fakeMedia is an in-memory store.Media.
+type fakeMedia struct {
+	uploads map[string]*models.MediaUpload
+	medias  map[string]*models.Media
+}
+
+func (f *fakeMedia) Get(ctx context.Context, mediaIDs []string) ([]*models.Media, []string, error) {
+	medias, missing := []*models.Media{}, []string(nil)
+	for _, id := range mediaIDs {
+		if media, ok := f.medias[id]; ok {
+			medias = append(medias, media)
+		} else {
+			missing = append(missing, id)
+		}
+	}
+	return medias, missing, nil
+}
+
+// New creates media once per storage key, like the store.
+func (f *fakeMedia) New(ctx context.Context, upload *models.MediaUpload) (string, error) {
+	for id, existing := range f.uploads {
+		if upload.StorageKey != nil && existing.StorageKey != nil && *existing.StorageKey == *upload.StorageKey {
+			return id, nil
+		}
+	}
+	id := "media-" + string(rune('a'+len(f.uploads)))
+	f.uploads[id] = upload
+	return id, nil
+}
+
+func (f *fakeMedia) Expire(ctx context.Context, mediaIDs []string, at time.Time) (int, error) {
+	return 0, nil
+}
+
+func (f *fakeMedia) ListExpired(ctx context.Context, before time.Time, limit int) ([]*models.Media, error) {
+	return nil, nil
+}
+
+func (f *fakeMedia) DeleteOrphaned(ctx context.Context, createdBefore time.Time, limit int) ([]*models.Media, error) {
+	return nil, nil
+}
+
+// gpsLatitude is the marker value stored as the GPS latitude of test photos.
+var gpsLatitude = []byte{0, 0, 0, 25, 0, 0, 0, 1, 0, 0, 0, 2, 0, 0, 0, 1, 0, 0, 0, 3, 0, 0, 0, 1}
+
+// jpegWithGPS returns a w×h JPEG carrying an Exif segment whose GPS IFD has
+// a GPSLatitude of gpsLatitude.
+func jpegWithGPS(t *testing.T, w, h int) []byte {
+	t.Helper()
+	encoded := bytes.Buffer{}
+	if err := jpeg.Encode(&encoded, testImage(w, h), nil); err != nil {
+		t.Fatal(err)
+	}
+
+	segment := append([]byte("Exif\x00\x00"), gpsTIFF()...)
+	app1 := []byte{0xFF, 0xE1, 0, 0}
+	binary.BigEndian.PutUint16(app1[2:], uint16(len(segment)+2))
+
+	out := append([]byte{}, encoded.Bytes()[:2]...)
+	out = append(out, app1...)
+	out = append(out, segment...)
+	return append(out, encoded.Bytes()[2:]...)
+}
+
+// gpsXMP is an XMP packet locating the photo at testXMPLatitude and
+// testXMPLongitude, next to an orientation that must survive.
+const (
+	testXMPLatitude  = "25,2.5N"
+	testXMPLongitude = "121,30.1E"
+	gpsXMP           = `<x:xmpmeta xmlns:x="adobe:ns:meta/"><rdf:RDF xmlns:rdf="http://www.w3.org/1999/02/22-rdf-syntax-ns#">` +
+		`<rdf:Description xmlns:exif="http://ns.adobe.com/exif/1.0/" xmlns:tiff="http://ns.adobe.com/tiff/1.0/" exif:GPSLatitude="` + testXMPLatitude + `" tiff:Orientation="6">` +
+		`<exif:GPSLongitude>` + testXMPLongitude + `</exif:GPSLongitude></rdf:Description></rdf:RDF></x:xmpmeta>`
+)
+
+// gpsTIFF is a big-endian TIFF whose IFD0 has one entry (GPSInfo → 26) and
+// whose GPS IFD at 26 has one entry (GPSLatitude, 3 rationals at 44) set to
+// gpsLatitude.
+func gpsTIFF() []byte {
+	tiff := make([]byte, 44+len(gpsLatitude))
+	copy(tiff, "MM\x00\x2a\x00\x00\x00\x08")
+	binary.BigEndian.PutUint16(tiff[8:], 1)
+	binary.BigEndian.PutUint16(tiff[10:], exifGPSInfoTag)
+	binary.BigEndian.PutUint16(tiff[12:], 4)
+	binary.BigEndian.PutUint32(tiff[14:], 1)
+	binary.BigEndian.PutUint32(tiff[18:], 26)
+	binary.BigEndian.PutUint16(tiff[26:], 1)
+	binary.BigEndian.PutUint16(tiff[28:], 2)
+	binary.BigEndian.PutUint16(tiff[30:], 5)
+	binary.BigEndian.PutUint32(tiff[32:], 3)
+	binary.BigEndian.PutUint32(tiff[36:], 44)
+	copy(tiff[44:], gpsLatitude)
+	return tiff
+}
+
+func testImage(w, h int) image.Image {
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			img.Set(x, y, color.RGBA{uint8(x * 255 / w), 80, uint8(y * 255 / h), 255})
+		}
+	}
+	return img
+}
+
+// pngWithGPS returns a PNG with gpsTIFF in an eXIf chunk, gpsXMP in an
+// uncompressed iTXt chunk, and a compressed copy of it in a zTXt chunk.
+func pngWithGPS(t *testing.T) []byte {
+	t.Helper()
+	encoded := bytes.Buffer{}
+	if err := png.Encode(&encoded, testImage(8, 6)); err != nil {
+		t.Fatal(err)
+	}
+	chunk := func(typ string, body []byte) []byte {
+		out := binary.BigEndian.AppendUint32(nil, uint32(len(body)))
+		out = append(out, typ...)
+		out = append(out, body...)
+		return binary.BigEndian.AppendUint32(out, crc32.ChecksumIEEE(out[4:]))
+	}
+	// the IHDR chunk comes first, after the 8-byte signature
+	ihdrEnd := 8 + 12 + 13
+	out := append([]byte{}, encoded.Bytes()[:ihdrEnd]...)
+	out = append(out, chunk("eXIf", gpsTIFF())...)
+	out = append(out, chunk("iTXt", []byte("XML:com.adobe.xmp\x00\x00\x00\x00\x00"+gpsXMP))...)
+	out = append(out, chunk("zTXt", []byte("Raw profile type xmp\x00\x00compressed"))...)
+	return append(out, encoded.Bytes()[ihdrEnd:]...)
+}
+
+// gifWithGPS returns a GIF carrying gpsXMP in an XMP application extension.
+func gifWithGPS(t *testing.T) []byte {
+	t.Helper()
+	encoded := bytes.Buffer{}
+	if err := gif.Encode(&encoded, testImage(8, 6), nil); err != nil {
+		t.Fatal(err)
+	}
+	// header, logical screen descriptor and global color table
+	data := encoded.Bytes()
+	end := 13 + 3<<(data[10]&7+1)
+	out := append([]byte{}, data[:end]...)
+	out = append(out, "\x21\xff\x0bXMP DataXMP"+gpsXMP...)
+	// the "magic trailer" every XMP application extension ends with
+	out = append(out, 1)
+	for i := 255; i >= 0; i-- {
+		out = append(out, byte(i))
+	}
+	out = append(out, 0)
+	return append(out, data[end:]...)
+}
+
+// webpWithGPS returns the chunks of a WebP carrying gpsTIFF and gpsXMP, with
+// a stand-in for the image data.
+func webpWithGPS() []byte {
+	chunk := func(fourCC string, body []byte) []byte {
+		out := append([]byte(fourCC), binary.LittleEndian.AppendUint32(nil, uint32(len(body)))...)
+		out = append(out, body...)
+		if len(body)%2 == 1 {
+			out = append(out, 0)
+		}
+		return out
+	}
+	body := []byte("WEBP")
+	body = append(body, chunk("VP8X", []byte{0x0C, 0, 0, 0, 7, 0, 0, 5, 0, 0})...)
+	body = append(body, chunk("VP8L", []byte{0x2F, 7, 0x40, 1, 0})...)
+	body = append(body, chunk("EXIF", gpsTIFF())...)
+	body = append(body, chunk("XMP ", []byte(gpsXMP))...)
+	return append(append([]byte("RIFF"), binary.LittleEndian.AppendUint32(nil, uint32(len(body)))...), body...)
+}
+
+// jpegWithXMP returns a JPEG with gpsXMP in an APP1 segment.
+func jpegWithXMP(t *testing.T) []byte {
+	t.Helper()
+	encoded := bytes.Buffer{}
+	if err := jpeg.Encode(&encoded, testImage(8, 6), nil); err != nil {
+		t.Fatal(err)
+	}
+	segment := []byte("http://ns.adobe.com/xap/1.0/\x00" + gpsXMP)
+	app1 := binary.BigEndian.AppendUint16([]byte{0xFF, 0xE1}, uint16(len(segment)+2))
+	out := append([]byte{}, encoded.Bytes()[:2]...)
+	out = append(out, app1...)
+	out = append(out, segment...)
+	return append(out, encoded.Bytes()[2:]...)
+}
+
+func TestStripGPS(t *testing.T) {
+	cases := []struct {
+		name   string
+		data   []byte
+		decode func(io.Reader) (image.Image, error)
+	}{
+		{"jpeg xmp", jpegWithXMP(t), jpeg.Decode},
+		{"png", pngWithGPS(t), png.Decode},
+		{"gif", gifWithGPS(t), gif.Decode},
+		{"webp", webpWithGPS(), nil},
+	}
+	for _, c := range cases {
+		stripped, ok := stripGPS(c.data)
+		if !ok {
+			t.Errorf("%s: nothing stripped", c.name)
+			continue
+		}
+		for _, location := range [][]byte{gpsLatitude, []byte(testXMPLatitude), []byte(testXMPLongitude)} {
+			if bytes.Contains(stripped, location) {
+				t.Errorf("%s: %q survived", c.name, location)
+			}
+		}
+		if c.decode != nil {
+			if _, err := c.decode(bytes.NewReader(stripped)); err != nil {
+				t.Errorf("%s: stripped image no longer decodes: %v", c.name, err)
+			}
+		}
+	}
+
+	// XMP keeps everything but the location
+	xmp := []byte(gpsXMP)
+	if !stripXMPGPS(xmp) || !bytes.Contains(xmp, []byte(`tiff:Orientation="6"`)) || !bytes.Contains(xmp, []byte(`xmlns:exif=`)) || len(xmp) != len(gpsXMP) {
+		t.Errorf("stripped XMP = %s", xmp)
+	}
+}
+
+func newTestMediaService(t *testing.T, config *models.AppConfig) (Media, store.Blob, *fakeMedia) {
+	t.Helper()
+	blob := store.NewLocalBlob(t.TempDir(), "http://localhost/blob", []byte("secret"))
+	media := &fakeMedia{uploads: map[string]*models.MediaUpload{}}
+	apps := fakeApps{"com.yoku.apen": {ID: "app", BundleID: "com.yoku.apen", Config: config}}
+	return NewMedia(apps, media, blob, MediaConfig{}), blob, media
+}
+
+func upload(t *testing.T, svc Media, blob store.Blob, filename string, data []byte) string {
+	t.Helper()
+	intent, err := svc.NewUploadIntent(context.Background(), "com.yoku.apen", "user", filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := blob.Put(context.Background(), intent.Key, bytes.NewReader(data), int64(len(data)), ""); err != nil {
+		t.Fatal(err)
+	}
+	return intent.Key
+}
+
+func TestCompleteUploadImage(t *testing.T) {
+	svc, blob, media := newTestMediaService(t, nil)
+	ctx := context.Background()
+	key := upload(t, svc, blob, "photo.JPG", jpegWithGPS(t, 40, 30))
+
+	id, err := svc.CompleteUpload(ctx, "com.yoku.apen", "user", key, &models.MediaUpload{MediaType: models.Image})
+	if err != nil {
+		t.Fatalf("CompleteUpload: %v", err)
+	}
+	stored := media.uploads[id]
+	if *stored.ContentType != "image/jpeg" || *stored.Width != 40 || *stored.Height != 30 {
+		t.Errorf("unexpected metadata: %s %dx%d", *stored.ContentType, *stored.Width, *stored.Height)
+	}
+	if stored.Placeholder == nil || len(*stored.Placeholder) != 28 {
+		t.Errorf("expected a 4x3 blurhash placeholder, got %v", stored.Placeholder)
+	}
+	if *stored.StorageKey != key || !strings.HasSuffix(key, ".jpg") {
+		t.Errorf("unexpected storage key %q", *stored.StorageKey)
+	}
+
+	r, _ := blob.Get(ctx, key)
+	data, _ := io.ReadAll(r)
+	r.Close()
+	if *stored.SizeBytes != int64(len(data)) {
+		t.Errorf("SizeBytes = %d, want %d", *stored.SizeBytes, len(data))
+	}
+	if bytes.Contains(data, gpsLatitude) {
+		t.Error("GPS latitude survived the upload pipeline")
+	}
+	if _, err := jpeg.Decode(bytes.NewReader(data)); err != nil {
+		t.Errorf("stripped JPEG no longer decodes: %v", err)
+	}
+
+	// a retry returns the same media
+	retried, err := svc.CompleteUpload(ctx, "com.yoku.apen", "user", key, &models.MediaUpload{MediaType: models.Image})
+	if err != nil || retried != id || len(media.uploads) != 1 {
+		t.Errorf("retry = %s, %v with %d media; want %s again", retried, err, len(media.uploads), id)
+	}
+}
+
+func TestCompleteUploadStripsWebP(t *testing.T) {
+	svc, blob, media := newTestMediaService(t, nil)
+	ctx := context.Background()
+	key := upload(t, svc, blob, "photo.webp", webpWithGPS())
+
+	id, err := svc.CompleteUpload(ctx, "com.yoku.apen", "user", key, &models.MediaUpload{MediaType: models.Image})
+	if err != nil {
+		t.Fatalf("CompleteUpload: %v", err)
+	}
+	if stored := media.uploads[id]; *stored.ContentType != "image/webp" || stored.Width != nil {
+		t.Errorf("unexpected metadata: %s, width %v", *stored.ContentType, stored.Width)
+	}
+	r, _ := blob.Get(ctx, key)
+	data, _ := io.ReadAll(r)
+	r.Close()
+	if bytes.Contains(data, gpsLatitude) || bytes.Contains(data, []byte(testXMPLatitude)) {
+		t.Error("GPS survived the upload pipeline")
+	}
+}
+
+// countingBlob is a store.Blob that counts the bytes read from it.
+type countingBlob struct {
+	store.Blob
+	read *int64
+}
+
+func (b countingBlob) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	r, err := b.Blob.Get(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	return countingReader{r, b.read}, nil
+}
+
+type countingReader struct {
+	io.ReadCloser
+	read *int64
+}
+
+func (r countingReader) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	*r.read += int64(n)
+	return n, err
+}
+
+func TestCompleteUploadOnlySniffsFiles(t *testing.T) {
+	ctx := context.Background()
+	_, blob, media := newTestMediaService(t, nil)
+	read := int64(0)
+	apps := fakeApps{"com.yoku.apen": {ID: "app", BundleID: "com.yoku.apen"}}
+	svc := NewMedia(apps, media, countingBlob{blob, &read}, MediaConfig{})
+
+	data := bytes.Repeat([]byte("plain text "), 1<<16)
+	key := upload(t, svc, blob, "notes.txt", data)
+	id, err := svc.CompleteUpload(ctx, "com.yoku.apen", "user", key, &models.MediaUpload{MediaType: models.File})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if read > sniffLen {
+		t.Errorf("read %d bytes of a file, want at most %d", read, sniffLen)
+	}
+	if size := *media.uploads[id].SizeBytes; size != int64(len(data)) {
+		t.Errorf("SizeBytes = %d, want %d", size, len(data))
+	}
+}
+
+func TestOwnsUpload(t *testing.T) {
+	id := "0b7c3e1e-8a51-4c1c-9d8e-2f1b6a1d3c4e"
+	cases := []struct {
+		key  string
+		want bool
+	}{
+		{"app/alice/" + id + ".jpg", true},
+		{"app/alice/" + id, true},
+		{"app/alice/", false},
+		{"app/alice/bob/" + id + ".jpg", false},
+		{"app/alice/../bob/" + id + ".jpg", false},
+		{"app/alicex/" + id + ".jpg", false},
+		{"other/alice/" + id + ".jpg", false},
+	}
+	for _, c := range cases {
+		if got := ownsUpload("app", "alice", c.key); got != c.want {
+			t.Errorf("ownsUpload(%q) = %v, want %v", c.key, got, c.want)
+		}
+	}
+}
+
+func TestCompleteUploadRejects(t *testing.T) {
+	ctx := context.Background()
+
+	svc, blob, _ := newTestMediaService(t, nil)
+	key := upload(t, svc, blob, "photo.png", []byte("just some text, not an image"))
+	if _, err := svc.CompleteUpload(ctx, "com.yoku.apen", "user", key, &models.MediaUpload{MediaType: models.Image}); err != models.ErrorWrongParams {
+		t.Errorf("text as image: err = %v, want ErrorWrongParams", err)
+	}
+	if _, err := blob.Stat(ctx, key); err != models.ErrorNotFound {
+		t.Errorf("rejected upload should be deleted, Stat err = %v", err)
+	}
+
+	key = upload(t, svc, blob, "notes.txt", []byte("hello"))
+	if _, err := svc.CompleteUpload(ctx, "com.yoku.apen", "someone-else", key, &models.MediaUpload{MediaType: models.File}); err != models.ErrorNotAllowed {
+		t.Errorf("another user's key: err = %v, want ErrorNotAllowed", err)
+	}
+
+	svc, blob, _ = newTestMediaService(t, &models.AppConfig{MaxUploadBytes: map[models.MediaType]int64{models.Image: 100}})
+	key = upload(t, svc, blob, "photo.jpg", jpegWithGPS(t, 40, 30))
+	if _, err := svc.CompleteUpload(ctx, "com.yoku.apen", "user", key, &models.MediaUpload{MediaType: models.Image}); err != models.ErrorWrongParams {
+		t.Errorf("over the app's limit: err = %v, want ErrorWrongParams", err)
+	}
+}
+
+func TestBlurhashSolidColor(t *testing.T) {
+	gray := image.NewRGBA(image.Rect(0, 0, 640, 480))
+	for y := 0; y < 480; y++ {
+		for x := 0; x < 640; x++ {
+			gray.Set(x, y, color.RGBA{128, 128, 128, 255})
+		}
+	}
+	// size flag 'L' (4x3), quantised AC maximum 0 and DC #808080; the AC
+	// components themselves carry the sampling grid's rounding
+	got := blurhash(gray)
+	if len(got) != 28 || !strings.HasPrefix(got, "L0Eyb[") {
+		t.Errorf("blurhash(gray) = %q, want a 28-char hash starting with L0Eyb[", got)
+	}
+}
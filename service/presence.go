@@ -0,0 +1,168 @@
+package service
+
+import (
+	"context"
+	"time"
+
+	"github.com/A-pen-app/hire-sdk/models"
+	"github.com/A-pen-app/hire-sdk/store"
+	"github.com/A-pen-app/logging"
+)
+
+const (
+	// TypingTTL is how long a SetTyping call shows the user as typing.
+	// Clients keep calling it while the user types.
+	TypingTTL = 5 * time.Second
+	// OnlineWindow is how recently a user must have been active to be shown
+	// as online.
+	OnlineWindow = 2 * time.Minute
+)
+
+type presenceService struct {
+	a store.App
+	c store.Chat
+	p store.Presence
+}
+
+func NewPresence(a store.App, c store.Chat, p store.Presence) Presence {
+	return &presenceService{a: a, c: c, p: p}
+}
+
+// SetTyping shows the user as typing in the chat for TypingTTL, which also
+// counts as being active.
+func (s *presenceService) SetTyping(ctx context.Context, bundleID, userID, chatID string) error {
+	app, _, err := s.chat(ctx, bundleID, userID, chatID)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	expiresAt := now.Add(TypingTTL)
+	return s.p.Publish(ctx, &models.PresenceEvent{
+		AppID:     app.ID,
+		Type:      models.PresenceTyping,
+		UserID:    userID,
+		ChatID:    chatID,
+		At:        now,
+		ExpiresAt: &expiresAt,
+	})
+}
+
+// Touch records that the user is active now. Only users with a chat in the
+// app have anyone to be shown to; others get models.ErrorNotAllowed.
+func (s *presenceService) Touch(ctx context.Context, bundleID, userID string) error {
+	app, err := s.a.GetByBundleID(ctx, bundleID)
+	if err != nil {
+		logging.Errorw(ctx, "failed to get app by bundle ID", "err", err, "bundleID", bundleID)
+		return err
+	}
+
+	ok, err := s.c.HasChats(ctx, app.ID, userID)
+	if err != nil {
+		logging.Errorw(ctx, "failed to check chats", "err", err, "appID", app.ID, "userID", userID)
+		return err
+	}
+	if !ok {
+		return models.ErrorNotAllowed
+	}
+
+	return s.p.Publish(ctx, &models.PresenceEvent{
+		AppID:  app.ID,
+		Type:   models.PresenceActive,
+		UserID: userID,
+		At:     time.Now(),
+	})
+}
+
+// Subscribe returns the presence events of the other party of the chat:
+// their activity and their typing in this chat, until ctx is done.
+func (s *presenceService) Subscribe(ctx context.Context, bundleID, userID, chatID string) (<-chan *models.PresenceEvent, error) {
+	app, chat, err := s.chat(ctx, bundleID, userID, chatID)
+	if err != nil {
+		return nil, err
+	}
+
+	events, err := s.p.Subscribe(ctx, app.ID, []string{chat.ReceiverID})
+	if err != nil {
+		logging.Errorw(ctx, "subscribe to presence failed", "err", err, "chatID", chatID, "userID", userID)
+		return nil, err
+	}
+
+	filtered := make(chan *models.PresenceEvent)
+	go func() {
+		defer close(filtered)
+		for event := range events {
+			if event.Type == models.PresenceTyping && event.ChatID != chatID {
+				// typing elsewhere still shows they are around
+				event = &models.PresenceEvent{AppID: event.AppID, Type: models.PresenceActive, UserID: event.UserID, At: event.At}
+			}
+			select {
+			case filtered <- event:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return filtered, nil
+}
+
+// chat returns the app and the user's side of the chat, failing if they are
+// not in it.
+func (s *presenceService) chat(ctx context.Context, bundleID, userID, chatID string) (*models.App, *models.ChatRoom, error) {
+	app, err := s.a.GetByBundleID(ctx, bundleID)
+	if err != nil {
+		logging.Errorw(ctx, "failed to get app by bundle ID", "err", err, "bundleID", bundleID)
+		return nil, nil, err
+	}
+
+	// check ownership
+	chat, err := s.c.Get(ctx, app.ID, chatID, userID)
+	if err != nil {
+		logging.Errorw(ctx, "failed to verify chat ownership", "err", err, "appID", app.ID, "chatID", chatID, "userID", userID)
+		return nil, nil, err
+	}
+	return app, chat, nil
+}
+
+// attachPresence sets the presence of the other party on each chat's
+// Receiver, creating it with just the ID when the caller has not filled it
+// in. It costs one lookup for activity and one for typing per page.
+func attachPresence(ctx context.Context, p store.Presence, appID string, chats []*models.ChatRoom, now time.Time) error {
+	if len(chats) == 0 {
+		return nil
+	}
+	userIDs := make([]string, 0, len(chats))
+	chatIDs := make([]string, 0, len(chats))
+	for _, chat := range chats {
+		userIDs = append(userIDs, chat.ReceiverID)
+		chatIDs = append(chatIDs, chat.ChatID)
+	}
+
+	lastActive, err := p.LastActive(ctx, appID, userIDs)
+	if err != nil {
+		return err
+	}
+	typing, err := p.Typing(ctx, appID, chatIDs, now)
+	if err != nil {
+		return err
+	}
+
+	for _, chat := range chats {
+		presence := &models.Presence{}
+		if at, ok := lastActive[chat.ReceiverID]; ok {
+			presence.LastActiveAt = &at
+			presence.IsOnline = now.Sub(at) < OnlineWindow
+		}
+		for _, userID := range typing[chat.ChatID] {
+			if userID == chat.ReceiverID {
+				presence.IsTyping = true
+				presence.IsOnline = true
+			}
+		}
+		if chat.Receiver == nil {
+			chat.Receiver = &models.DisplayUser{ID: chat.ReceiverID}
+		}
+		chat.Receiver.Presence = presence
+	}
+	return nil
+}
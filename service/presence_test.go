@@ -0,0 +1,67 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/A-pen-app/hire-sdk/models"
+	"github.com/A-pen-app/hire-sdk/store"
+)
+
+func TestPresence(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	apps := fakeApps{"com.yoku.apen": {ID: "app", BundleID: "com.yoku.apen"}}
+	thread := &fakeThread{chatID: "chat"}
+	p := store.NewMemoryPresence()
+	s := NewPresence(apps, thread, p)
+
+	events, err := s.Subscribe(ctx, "com.yoku.apen", "alice", "chat")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.SetTyping(ctx, "com.yoku.apen", "alice", "chat"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.SetTyping(ctx, "com.yoku.apen", "bob", "chat"); err != nil {
+		t.Fatal(err)
+	}
+	// bob typing elsewhere only tells alice he is around
+	until := time.Now().Add(TypingTTL)
+	if err := p.Publish(ctx, &models.PresenceEvent{AppID: "app", Type: models.PresenceTyping, UserID: "bob", ChatID: "other", At: time.Now(), ExpiresAt: &until}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Touch(ctx, "com.yoku.apen", "bob"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Touch(ctx, "com.yoku.apen", "mallory"); err != models.ErrorNotAllowed {
+		t.Errorf("touch by a user without chats: err = %v, want %v", err, models.ErrorNotAllowed)
+	}
+	for _, want := range []*models.PresenceEvent{
+		{Type: models.PresenceTyping, UserID: "bob", ChatID: "chat"},
+		{Type: models.PresenceActive, UserID: "bob"},
+		{Type: models.PresenceActive, UserID: "bob"},
+	} {
+		select {
+		case event := <-events:
+			if event.Type != want.Type || event.UserID != want.UserID || event.ChatID != want.ChatID {
+				t.Errorf("event = %+v, want %+v", event, want)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("no event, want %+v", want)
+		}
+	}
+
+	chat := NewChat(thread, nil, apps, nil, nil, nil, nil, nil, WithPresence(p))
+	room, err := chat.Get(ctx, "com.yoku.apen", "chat", "alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if room.Receiver == nil || room.Receiver.ID != "bob" || room.Receiver.Presence == nil {
+		t.Fatalf("receiver = %+v, want bob with presence", room.Receiver)
+	}
+	if presence := room.Receiver.Presence; !presence.IsOnline || !presence.IsTyping || presence.LastActiveAt == nil {
+		t.Errorf("presence = %+v, want bob online and typing", presence)
+	}
+}
@@ -0,0 +1,257 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"io"
+	"time"
+
+	"github.com/A-pen-app/hire-sdk/models"
+	"github.com/A-pen-app/hire-sdk/store"
+	"github.com/A-pen-app/logging"
+)
+
+// exportPageSize is how many sent messages an export reads at a time.
+const exportPageSize = 500
+
+type privacyService struct {
+	a  store.App
+	r  store.Resume
+	bc store.BusinessCard
+	c  store.Chat
+	s  store.Subscription
+	am store.Agreement
+	m  store.Media
+	p  store.Privacy
+
+	media Media
+}
+
+// NewPrivacy returns the service handling data subject requests. ms signs
+// the download URLs of exported media kept in the blob store; it may be nil
+// when the app has none.
+func NewPrivacy(a store.App, r store.Resume, bc store.BusinessCard, c store.Chat, s store.Subscription, am store.Agreement, m store.Media, p store.Privacy, ms Media) Privacy {
+	return &privacyService{a: a, r: r, bc: bc, c: c, s: s, am: am, m: m, p: p, media: ms}
+}
+
+// ExportUserData writes everything held about the user as a JSON
+// models.UserDataExport to w.
+func (s *privacyService) ExportUserData(ctx context.Context, bundleID, userID string, w io.Writer) error {
+	app, err := s.a.GetByBundleID(ctx, bundleID)
+	if err != nil {
+		logging.Errorw(ctx, "failed to get app by bundle ID", "err", err, "bundleID", bundleID)
+		return err
+	}
+
+	export, err := s.export(ctx, app.ID, userID)
+	if err != nil {
+		return err
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(export); err != nil {
+		logging.Errorw(ctx, "failed to write user data export", "err", err, "appID", app.ID, "userID", userID)
+		return err
+	}
+	return nil
+}
+
+// EraseUser erases the user's personal data from the app when they delete
+// their account; see store.Privacy.Erase for what is kept. Subscription and
+// consent records stay as the app's billing and compliance evidence.
+func (s *privacyService) EraseUser(ctx context.Context, bundleID, userID string) (*models.ErasureReport, error) {
+	app, err := s.a.GetByBundleID(ctx, bundleID)
+	if err != nil {
+		logging.Errorw(ctx, "failed to get app by bundle ID", "err", err, "bundleID", bundleID)
+		return nil, err
+	}
+
+	return s.p.Erase(ctx, app.ID, userID)
+}
+
+func (s *privacyService) export(ctx context.Context, appID, userID string) (*models.UserDataExport, error) {
+	export := &models.UserDataExport{
+		FormatVersion:         models.UserDataExportVersion,
+		AppID:                 appID,
+		UserID:                userID,
+		ExportedAt:            time.Now(),
+		ResumeSnapshots:       []*models.ExportedResumeSnapshot{},
+		ResumeRelations:       []*models.ExportedResumeRelation{},
+		BusinessCardSnapshots: []*models.ExportedBusinessCardSnapshot{},
+		Chats:                 []*models.ExportedChat{},
+		Messages:              []*models.ExportedMessage{},
+		Media:                 []*models.ExportedMedia{},
+	}
+
+	resume, err := s.r.Get(ctx, appID, userID)
+	if err != nil && err != sql.ErrNoRows {
+		return nil, err
+	}
+	if resume != nil {
+		export.Resume = &models.ExportedResume{Content: resume.Content, CreatedAt: resume.CreatedAt, UpdatedAt: resume.UpdatedAt}
+	}
+	resumeSnapshots, err := s.r.ListUserSnapshots(ctx, appID, userID)
+	if err != nil {
+		return nil, err
+	}
+	for _, snapshot := range resumeSnapshots {
+		export.ResumeSnapshots = append(export.ResumeSnapshots, &models.ExportedResumeSnapshot{
+			ID:        snapshot.ID,
+			Content:   snapshot.Content,
+			CreatedAt: snapshot.CreatedAt,
+		})
+	}
+	relations, err := s.r.ListRelations(ctx, appID, models.ByApplicant(userID))
+	if err != nil {
+		return nil, err
+	}
+	for _, relation := range relations {
+		export.ResumeRelations = append(export.ResumeRelations, &models.ExportedResumeRelation{
+			SnapshotID: relation.SnapshotID,
+			PostID:     relation.PostID,
+			ChatID:     relation.ChatID,
+			Status:     relation.Status,
+			IsRead:     relation.IsRead,
+			CreatedAt:  relation.CreatedAt,
+		})
+	}
+
+	card, err := s.bc.Get(ctx, appID, userID)
+	if err != nil && err != sql.ErrNoRows {
+		logging.Errorw(ctx, "failed to get business card", "err", err, "appID", appID, "userID", userID)
+		return nil, err
+	}
+	if card != nil {
+		export.BusinessCard = &models.ExportedBusinessCard{Content: card.Content, CreatedAt: card.CreatedAt, UpdatedAt: card.UpdatedAt}
+	}
+	cardSnapshots, err := s.bc.ListUserSnapshots(ctx, appID, userID)
+	if err != nil {
+		return nil, err
+	}
+	for _, snapshot := range cardSnapshots {
+		export.BusinessCardSnapshots = append(export.BusinessCardSnapshots, &models.ExportedBusinessCardSnapshot{
+			ID:        snapshot.ID,
+			Content:   snapshot.Content,
+			CreatedAt: snapshot.CreatedAt,
+		})
+	}
+
+	chats, err := s.c.ListUserThreads(ctx, appID, userID)
+	if err != nil {
+		return nil, err
+	}
+	for _, chat := range chats {
+		export.Chats = append(export.Chats, &models.ExportedChat{
+			ChatID:      chat.ChatID,
+			PeerID:      chat.ReceiverID,
+			PostID:      chat.PostID,
+			Status:      chat.Status,
+			HireContact: chat.HireContact,
+			CreatedAt:   chat.CreatedAt,
+		})
+	}
+
+	mediaIDs := []string{}
+	seen := map[string]bool{}
+	var after *models.MessageCursor
+	for {
+		msgs, err := s.c.ListSentMessages(ctx, appID, userID, after, exportPageSize)
+		if err != nil {
+			return nil, err
+		}
+		for _, msg := range msgs {
+			export.Messages = append(export.Messages, &models.ExportedMessage{
+				ID:               msg.ID,
+				ChatID:           msg.ChatID,
+				Type:             msg.Type.String(),
+				Status:           msg.Status,
+				Body:             msg.Body,
+				MediaIDs:         msg.MediaIDs,
+				ReplyToMessageID: msg.ReplyToMessageID,
+				ReferenceID:      msg.RefID,
+				CreatedAt:        msg.CreatedAt,
+			})
+			for _, id := range msg.MediaIDs {
+				if !seen[id] {
+					seen[id] = true
+					mediaIDs = append(mediaIDs, id)
+				}
+			}
+		}
+		if len(msgs) < exportPageSize {
+			break
+		}
+		last := msgs[len(msgs)-1]
+		after = &models.MessageCursor{CreatedAt: last.CreatedAt, ID: last.ID}
+	}
+	if export.Reactions, err = s.p.ListReactions(ctx, appID, userID); err != nil {
+		return nil, err
+	}
+	if export.ScheduledMessages, err = s.p.ListScheduledMessages(ctx, appID, userID); err != nil {
+		return nil, err
+	}
+	for _, msg := range export.ScheduledMessages {
+		for _, id := range msg.MediaIDs {
+			if !seen[id] {
+				seen[id] = true
+				mediaIDs = append(mediaIDs, id)
+			}
+		}
+	}
+	if export.MessageTemplates, err = s.p.ListOwnedTemplates(ctx, appID, userID); err != nil {
+		return nil, err
+	}
+	if export.Media, err = s.exportMedia(ctx, mediaIDs); err != nil {
+		return nil, err
+	}
+
+	subscription, err := s.s.Get(ctx, appID, userID)
+	if err != nil && err != sql.ErrNoRows {
+		return nil, err
+	}
+	export.Subscription = subscription
+	if export.SubscriptionEvents, err = s.s.ListEvents(ctx, appID, userID); err != nil {
+		return nil, err
+	}
+	if export.Consents, err = s.am.History(ctx, appID, userID); err != nil {
+		return nil, err
+	}
+
+	return export, nil
+}
+
+// exportMedia references the media of the user's sent and scheduled
+// messages, with signed download URLs for blob-backed ones. Media that no
+// longer exists is left out.
+func (s *privacyService) exportMedia(ctx context.Context, mediaIDs []string) ([]*models.ExportedMedia, error) {
+	exported := []*models.ExportedMedia{}
+	if len(mediaIDs) == 0 {
+		return exported, nil
+	}
+	medias, missing, err := s.m.Get(ctx, mediaIDs)
+	if err != nil {
+		return nil, err
+	}
+	if len(missing) > 0 {
+		logging.Errorw(ctx, "exported messages reference missing media", "missing", missing)
+	}
+	if s.media != nil {
+		if err := s.media.Sign(ctx, medias); err != nil {
+			return nil, err
+		}
+	}
+	for _, media := range medias {
+		exported = append(exported, &models.ExportedMedia{
+			ID:          media.ID,
+			Type:        media.Type,
+			URL:         media.URL,
+			ContentType: media.ContentType,
+			SizeBytes:   media.SizeBytes,
+			ExpiredAt:   media.ExpiredAt,
+			CreatedAt:   media.CreatedAt,
+		})
+	}
+	return exported, nil
+}
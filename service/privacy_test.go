@@ -0,0 +1,156 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/A-pen-app/hire-sdk/models"
+	"github.com/A-pen-app/hire-sdk/store"
+)
+
+// The export fakes embed their store interface and implement only what an
+// export reads; anything else panics.
+
+type exportResumes struct {
+	store.Resume
+}
+
+func (exportResumes) Get(ctx context.Context, appID, userID string) (*models.Resume, error) {
+	name := "Alice"
+	return &models.Resume{Content: &models.ResumeContent{RealName: &name}}, nil
+}
+
+func (exportResumes) ListUserSnapshots(ctx context.Context, appID, userID string) ([]*models.ResumeSnapshot, error) {
+	return []*models.ResumeSnapshot{{ID: "resume-snapshot"}}, nil
+}
+
+func (exportResumes) ListRelations(ctx context.Context, appID string, opts ...models.ListRelationOptionFunc) ([]*models.ResumeRelation, error) {
+	opt := models.ListRelationOption{}
+	for _, f := range opts {
+		f(&opt)
+	}
+	if opt.UserID == nil {
+		return nil, fmt.Errorf("relations listed without the applicant")
+	}
+	snapshotID := "resume-snapshot"
+	return []*models.ResumeRelation{{SnapshotID: &snapshotID, PostID: "post"}}, nil
+}
+
+type exportCards struct {
+	store.BusinessCard
+}
+
+func (exportCards) Get(ctx context.Context, appID, userID string) (*models.BusinessCard, error) {
+	return nil, sql.ErrNoRows
+}
+
+func (exportCards) ListUserSnapshots(ctx context.Context, appID, userID string) ([]*models.BusinessCardSnapshot, error) {
+	return nil, nil
+}
+
+// exportChats serves n sent messages, each with the same image.
+type exportChats struct {
+	store.Chat
+	n int
+}
+
+func (exportChats) ListUserThreads(ctx context.Context, appID, userID string) ([]*models.ChatRoom, error) {
+	return []*models.ChatRoom{{ChatID: "chat", ReceiverID: "bob"}}, nil
+}
+
+func (c exportChats) ListSentMessages(ctx context.Context, appID, userID string, after *models.MessageCursor, count int) ([]*models.Message, error) {
+	start := 0
+	if after != nil {
+		fmt.Sscanf(after.ID, "msg-%d", &start)
+		start++
+	}
+	msgs := []*models.Message{}
+	for i := start; i < c.n && len(msgs) < count; i++ {
+		msgs = append(msgs, &models.Message{
+			ID:        fmt.Sprintf("msg-%d", i),
+			Type:      models.MsgImage,
+			MediaIDs:  []string{"img"},
+			CreatedAt: time.Unix(int64(i), 0),
+		})
+	}
+	return msgs, nil
+}
+
+type exportSubscriptions struct {
+	store.Subscription
+}
+
+func (exportSubscriptions) Get(ctx context.Context, appID, userID string) (*models.UserSubscription, error) {
+	return nil, sql.ErrNoRows
+}
+
+func (exportSubscriptions) ListEvents(ctx context.Context, appID, userID string) ([]*models.SubscriptionEvent, error) {
+	return []*models.SubscriptionEvent{}, nil
+}
+
+// exportPrivacy lists a reaction, a scheduled message with a file and a
+// template of the user's.
+type exportPrivacy struct {
+	store.Privacy
+}
+
+func (exportPrivacy) ListReactions(ctx context.Context, appID, userID string) ([]*models.ExportedReaction, error) {
+	return []*models.ExportedReaction{{MessageID: "msg-0", Emoji: "👍"}}, nil
+}
+
+func (exportPrivacy) ListScheduledMessages(ctx context.Context, appID, userID string) ([]*models.ScheduledMessage, error) {
+	return []*models.ScheduledMessage{{ID: "scheduled", Type: models.MsgFile, MediaIDs: []string{"file"}, Status: models.ScheduledPending}}, nil
+}
+
+func (exportPrivacy) ListOwnedTemplates(ctx context.Context, appID, userID string) ([]*models.MessageTemplate, error) {
+	return []*models.MessageTemplate{{ID: "template", OwnerID: &userID, Name: "thanks"}}, nil
+}
+
+func TestExportUserData(t *testing.T) {
+	key := "app/alice/photo.jpg"
+	media := &fakeMedia{medias: map[string]*models.Media{
+		"img":  {ID: "img", Type: models.Image, StorageKey: &key},
+		"file": {ID: "file", Type: models.File},
+	}}
+	blob := store.NewLocalBlob(t.TempDir(), "http://localhost/blob", []byte("secret"))
+	apps := fakeApps{"com.yoku.apen": {ID: "app", BundleID: "com.yoku.apen"}}
+	s := NewPrivacy(apps, exportResumes{}, exportCards{}, exportChats{n: exportPageSize + 3}, exportSubscriptions{},
+		&fakeAgreementStore{}, media, exportPrivacy{}, NewMedia(apps, media, blob, MediaConfig{}))
+
+	out := bytes.Buffer{}
+	if err := s.ExportUserData(context.Background(), "com.yoku.apen", "alice", &out); err != nil {
+		t.Fatalf("ExportUserData: %v", err)
+	}
+	if !json.Valid(out.Bytes()) {
+		t.Fatal("export isn't JSON")
+	}
+
+	export, err := s.(*privacyService).export(context.Background(), "app", "alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if export.UserID != "alice" || export.Resume == nil || *export.Resume.Content.RealName != "Alice" {
+		t.Errorf("unexpected user or resume: %s %+v", export.UserID, export.Resume)
+	}
+	if len(export.ResumeRelations) != 1 || len(export.Chats) != 1 || export.Chats[0].PeerID != "bob" {
+		t.Errorf("unexpected relations %d or chats %+v", len(export.ResumeRelations), export.Chats)
+	}
+	if export.BusinessCard != nil || export.Subscription != nil {
+		t.Error("missing business card and subscription should export as null")
+	}
+	if len(export.Messages) != exportPageSize+3 || export.Messages[exportPageSize].ID != fmt.Sprintf("msg-%d", exportPageSize) {
+		t.Errorf("exported %d messages across pages, want %d", len(export.Messages), exportPageSize+3)
+	}
+	if len(export.Reactions) != 1 || len(export.ScheduledMessages) != 1 || len(export.MessageTemplates) != 1 {
+		t.Errorf("exported %d reactions, %d scheduled messages and %d templates, want one each", len(export.Reactions), len(export.ScheduledMessages), len(export.MessageTemplates))
+	}
+	if len(export.Media) != 2 || export.Media[0].ID != "img" || export.Media[0].URL == "" || export.Media[1].ID != "file" {
+		t.Errorf("want the image once with a signed URL and the scheduled file, got %+v", export.Media)
+	}
+}
@@ -0,0 +1,432 @@
+package service
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/A-pen-app/hire-sdk/models"
+)
+
+// ReceiptVerifier turns a raw store notification into a verified
+// transaction. Every verification failure wraps models.ErrorInvalidReceipt.
+type ReceiptVerifier interface {
+	Verify(ctx context.Context, receipt *models.Receipt) (*models.StoreTransaction, error)
+}
+
+// KeySet resolves the public key a token was signed with.
+type KeySet interface {
+	Key(ctx context.Context, kid string) (crypto.PublicKey, error)
+}
+
+// StaticKeySet is a KeySet backed by a fixed kid → key map, e.g. a parsed
+// snapshot of https://www.googleapis.com/oauth2/v3/certs.
+type StaticKeySet map[string]crypto.PublicKey
+
+func (ks StaticKeySet) Key(ctx context.Context, kid string) (crypto.PublicKey, error) {
+	key, ok := ks[kid]
+	if !ok {
+		return nil, fmt.Errorf("%w: unknown key id %q", models.ErrorInvalidReceipt, kid)
+	}
+	return key, nil
+}
+
+// PlaySubscriptionFetcher looks up a subscription purchase through the Google
+// Play Developer API. RTDN messages only carry a purchase token, so the
+// expiry has to come from here.
+type PlaySubscriptionFetcher interface {
+	GetSubscription(ctx context.Context, packageName, subscriptionID, purchaseToken string) (*models.StoreTransaction, error)
+}
+
+type ReceiptVerifierConfig struct {
+	// AppleRoots holds the Apple root certificates the x5c chain of a signed
+	// App Store notification must lead to.
+	AppleRoots *x509.CertPool
+
+	// GoogleKeys verifies the OIDC token Pub/Sub attaches to RTDN pushes, and
+	// GoogleAudience is the audience configured on the push subscription.
+	GoogleKeys     KeySet
+	GoogleAudience string
+	PlayFetcher    PlaySubscriptionFetcher
+
+	// Now defaults to time.Now; tests can pin it.
+	Now func() time.Time
+}
+
+type receiptVerifier struct {
+	cfg ReceiptVerifierConfig
+}
+
+// NewReceiptVerifier returns a ReceiptVerifier for the platforms cfg is
+// configured for; receipts from other platforms fail with
+// models.ErrorUnsupported.
+func NewReceiptVerifier(cfg ReceiptVerifierConfig) ReceiptVerifier {
+	if cfg.Now == nil {
+		cfg.Now = time.Now
+	}
+	return &receiptVerifier{cfg: cfg}
+}
+
+func (v *receiptVerifier) Verify(ctx context.Context, receipt *models.Receipt) (*models.StoreTransaction, error) {
+	if receipt == nil {
+		return nil, models.ErrorWrongParams
+	}
+	switch receipt.Platform {
+	case models.StoreAppStore:
+		if v.cfg.AppleRoots == nil {
+			return nil, models.ErrorUnsupported
+		}
+		return v.verifyAppStore(receipt.Payload)
+	case models.StorePlayStore:
+		if v.cfg.GoogleKeys == nil || v.cfg.PlayFetcher == nil {
+			return nil, models.ErrorUnsupported
+		}
+		return v.verifyPlayStore(ctx, receipt)
+	default:
+		return nil, models.ErrorUnsupported
+	}
+}
+
+func invalidReceipt(format string, args ...interface{}) error {
+	return fmt.Errorf("%w: %s", models.ErrorInvalidReceipt, fmt.Sprintf(format, args...))
+}
+
+type jwsHeader struct {
+	Alg string   `json:"alg"`
+	Kid string   `json:"kid"`
+	X5c []string `json:"x5c"`
+}
+
+// splitJWS decodes a compact JWS into its header, raw payload, signing input
+// and signature.
+func splitJWS(token string) (*jwsHeader, []byte, []byte, []byte, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, nil, nil, nil, invalidReceipt("malformed JWS")
+	}
+	rawHeader, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return nil, nil, nil, nil, invalidReceipt("malformed JWS header")
+	}
+	header := jwsHeader{}
+	if err := json.Unmarshal(rawHeader, &header); err != nil {
+		return nil, nil, nil, nil, invalidReceipt("malformed JWS header")
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, nil, nil, nil, invalidReceipt("malformed JWS payload")
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, nil, nil, nil, invalidReceipt("malformed JWS signature")
+	}
+	return &header, payload, []byte(parts[0] + "." + parts[1]), signature, nil
+}
+
+// Apple marks the leaf certificates it signs App Store payloads with, and
+// the intermediate that issues them, with these extensions.
+var (
+	appleReceiptSigningOID   = asn1.ObjectIdentifier{1, 2, 840, 113635, 100, 6, 11, 1}
+	appleIntermediateCertOID = asn1.ObjectIdentifier{1, 2, 840, 113635, 100, 6, 2, 1}
+)
+
+func hasExtension(cert *x509.Certificate, oid asn1.ObjectIdentifier) bool {
+	for _, ext := range cert.Extensions {
+		if ext.Id.Equal(oid) {
+			return true
+		}
+	}
+	return false
+}
+
+// verifyAppleJWS checks an ES256 JWS whose x5c chain must verify against the
+// configured Apple roots through Apple's marked intermediate and leaf, and
+// returns its payload. The chain is verified as of the payload's signedDate,
+// so a notification keeps verifying after its certificates expire.
+func (v *receiptVerifier) verifyAppleJWS(token string) ([]byte, error) {
+	header, payload, signingInput, signature, err := splitJWS(token)
+	if err != nil {
+		return nil, err
+	}
+	if header.Alg != "ES256" {
+		return nil, invalidReceipt("unexpected alg %q", header.Alg)
+	}
+	if len(header.X5c) == 0 {
+		return nil, invalidReceipt("missing x5c chain")
+	}
+
+	certs := make([]*x509.Certificate, len(header.X5c))
+	for i, encoded := range header.X5c {
+		der, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return nil, invalidReceipt("malformed x5c certificate")
+		}
+		if certs[i], err = x509.ParseCertificate(der); err != nil {
+			return nil, invalidReceipt("malformed x5c certificate")
+		}
+	}
+	if !hasExtension(certs[0], appleReceiptSigningOID) {
+		return nil, invalidReceipt("leaf certificate is not an App Store signing certificate")
+	}
+
+	// the payload is only trusted once the signature checks out below; until
+	// then its date only picks the time the chain is verified at
+	signed := struct {
+		SignedDate int64 `json:"signedDate"`
+	}{}
+	if err := json.Unmarshal(payload, &signed); err != nil || signed.SignedDate <= 0 {
+		return nil, invalidReceipt("missing signedDate")
+	}
+
+	intermediates := x509.NewCertPool()
+	for _, cert := range certs[1:] {
+		intermediates.AddCert(cert)
+	}
+	chains, err := certs[0].Verify(x509.VerifyOptions{
+		Roots:         v.cfg.AppleRoots,
+		Intermediates: intermediates,
+		CurrentTime:   time.UnixMilli(signed.SignedDate),
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+	})
+	if err != nil {
+		return nil, invalidReceipt("untrusted certificate chain: %v", err)
+	}
+	marked := false
+	for _, chain := range chains {
+		if len(chain) > 2 && hasExtension(chain[1], appleIntermediateCertOID) {
+			marked = true
+			break
+		}
+	}
+	if !marked {
+		return nil, invalidReceipt("certificate chain lacks Apple's intermediate")
+	}
+
+	key, ok := certs[0].PublicKey.(*ecdsa.PublicKey)
+	if !ok || len(signature) != 64 {
+		return nil, invalidReceipt("bad ES256 signature")
+	}
+	digest := sha256.Sum256(signingInput)
+	r, s := new(big.Int).SetBytes(signature[:32]), new(big.Int).SetBytes(signature[32:])
+	if !ecdsa.Verify(key, digest[:], r, s) {
+		return nil, invalidReceipt("bad ES256 signature")
+	}
+	return payload, nil
+}
+
+type appStoreNotification struct {
+	NotificationType string `json:"notificationType"`
+	Subtype          string `json:"subtype"`
+	NotificationUUID string `json:"notificationUUID"`
+	Data             struct {
+		BundleID              string `json:"bundleId"`
+		SignedTransactionInfo string `json:"signedTransactionInfo"`
+	} `json:"data"`
+}
+
+type appStoreTransaction struct {
+	TransactionID         string `json:"transactionId"`
+	OriginalTransactionID string `json:"originalTransactionId"`
+	BundleID              string `json:"bundleId"`
+	ProductID             string `json:"productId"`
+	ExpiresDate           *int64 `json:"expiresDate"`
+	RevocationDate        *int64 `json:"revocationDate"`
+}
+
+func (v *receiptVerifier) verifyAppStore(body []byte) (*models.StoreTransaction, error) {
+	envelope := struct {
+		SignedPayload string `json:"signedPayload"`
+	}{}
+	if err := json.Unmarshal(body, &envelope); err != nil || envelope.SignedPayload == "" {
+		return nil, invalidReceipt("missing signedPayload")
+	}
+
+	payload, err := v.verifyAppleJWS(envelope.SignedPayload)
+	if err != nil {
+		return nil, err
+	}
+	notification := appStoreNotification{}
+	if err := json.Unmarshal(payload, &notification); err != nil {
+		return nil, invalidReceipt("malformed notification payload")
+	}
+	if notification.Data.SignedTransactionInfo == "" {
+		return nil, models.ErrorUnsupported
+	}
+
+	payload, err = v.verifyAppleJWS(notification.Data.SignedTransactionInfo)
+	if err != nil {
+		return nil, err
+	}
+	info := appStoreTransaction{}
+	if err := json.Unmarshal(payload, &info); err != nil {
+		return nil, invalidReceipt("malformed transaction info")
+	}
+	if info.OriginalTransactionID == "" || info.TransactionID == "" {
+		return nil, invalidReceipt("transaction info without IDs")
+	}
+	if info.BundleID != notification.Data.BundleID {
+		return nil, invalidReceipt("bundle ID mismatch")
+	}
+
+	notificationType := notification.NotificationType
+	if notification.Subtype != "" {
+		notificationType += "." + notification.Subtype
+	}
+	return &models.StoreTransaction{
+		Platform:              models.StoreAppStore,
+		NotificationID:        notification.NotificationUUID,
+		NotificationType:      notificationType,
+		BundleID:              info.BundleID,
+		ProductID:             info.ProductID,
+		TransactionID:         info.TransactionID,
+		OriginalTransactionID: info.OriginalTransactionID,
+		ExpiresAt:             fromMillis(info.ExpiresDate),
+		RevokedAt:             fromMillis(info.RevocationDate),
+	}, nil
+}
+
+type pubSubPush struct {
+	Message struct {
+		Data      string `json:"data"`
+		MessageID string `json:"messageId"`
+	} `json:"message"`
+}
+
+type playNotification struct {
+	PackageName              string `json:"packageName"`
+	EventTimeMillis          string `json:"eventTimeMillis"`
+	SubscriptionNotification *struct {
+		NotificationType int    `json:"notificationType"`
+		PurchaseToken    string `json:"purchaseToken"`
+		SubscriptionID   string `json:"subscriptionId"`
+	} `json:"subscriptionNotification"`
+}
+
+// playNotificationTypes names the RTDN SubscriptionNotification types.
+var playNotificationTypes = map[int]string{
+	1:  "SUBSCRIPTION_RECOVERED",
+	2:  "SUBSCRIPTION_RENEWED",
+	3:  "SUBSCRIPTION_CANCELED",
+	4:  "SUBSCRIPTION_PURCHASED",
+	5:  "SUBSCRIPTION_ON_HOLD",
+	6:  "SUBSCRIPTION_IN_GRACE_PERIOD",
+	7:  "SUBSCRIPTION_RESTARTED",
+	8:  "SUBSCRIPTION_PRICE_CHANGE_CONFIRMED",
+	9:  "SUBSCRIPTION_DEFERRED",
+	10: "SUBSCRIPTION_PAUSED",
+	11: "SUBSCRIPTION_PAUSE_SCHEDULE_CHANGED",
+	12: "SUBSCRIPTION_REVOKED",
+	13: "SUBSCRIPTION_EXPIRED",
+}
+
+const playNotificationRevoked = 12
+
+// verifyPushToken checks the RS256 OIDC token Pub/Sub signs its pushes with.
+func (v *receiptVerifier) verifyPushToken(ctx context.Context, authorization string) error {
+	token, ok := strings.CutPrefix(authorization, "Bearer ")
+	if !ok {
+		return invalidReceipt("missing bearer token")
+	}
+	header, payload, signingInput, signature, err := splitJWS(token)
+	if err != nil {
+		return err
+	}
+	if header.Alg != "RS256" {
+		return invalidReceipt("unexpected alg %q", header.Alg)
+	}
+	key, err := v.cfg.GoogleKeys.Key(ctx, header.Kid)
+	if err != nil {
+		return err
+	}
+	rsaKey, ok := key.(*rsa.PublicKey)
+	if !ok {
+		return invalidReceipt("key %q is not an RSA key", header.Kid)
+	}
+	digest := sha256.Sum256(signingInput)
+	if err := rsa.VerifyPKCS1v15(rsaKey, crypto.SHA256, digest[:], signature); err != nil {
+		return invalidReceipt("bad RS256 signature")
+	}
+
+	claims := struct {
+		Iss string `json:"iss"`
+		Aud string `json:"aud"`
+		Exp int64  `json:"exp"`
+	}{}
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return invalidReceipt("malformed token claims")
+	}
+	if claims.Iss != "https://accounts.google.com" && claims.Iss != "accounts.google.com" {
+		return invalidReceipt("unexpected issuer %q", claims.Iss)
+	}
+	if claims.Aud != v.cfg.GoogleAudience {
+		return invalidReceipt("unexpected audience %q", claims.Aud)
+	}
+	if !v.cfg.Now().Before(time.Unix(claims.Exp, 0)) {
+		return invalidReceipt("token expired")
+	}
+	return nil
+}
+
+func (v *receiptVerifier) verifyPlayStore(ctx context.Context, receipt *models.Receipt) (*models.StoreTransaction, error) {
+	if err := v.verifyPushToken(ctx, receipt.Authorization); err != nil {
+		return nil, err
+	}
+
+	push := pubSubPush{}
+	if err := json.Unmarshal(receipt.Payload, &push); err != nil {
+		return nil, invalidReceipt("malformed push message")
+	}
+	data, err := base64.StdEncoding.DecodeString(push.Message.Data)
+	if err != nil {
+		return nil, invalidReceipt("malformed push data")
+	}
+	notification := playNotification{}
+	if err := json.Unmarshal(data, &notification); err != nil {
+		return nil, invalidReceipt("malformed developer notification")
+	}
+	sub := notification.SubscriptionNotification
+	if sub == nil {
+		// test, one-time product and voided purchase notifications
+		return nil, models.ErrorUnsupported
+	}
+
+	txn, err := v.cfg.PlayFetcher.GetSubscription(ctx, notification.PackageName, sub.SubscriptionID, sub.PurchaseToken)
+	if err != nil {
+		return nil, err
+	}
+	if txn.OriginalTransactionID == "" || txn.TransactionID == "" {
+		return nil, invalidReceipt("purchase without IDs")
+	}
+	txn.Platform = models.StorePlayStore
+	txn.NotificationID = push.Message.MessageID
+	txn.NotificationType = playNotificationTypes[sub.NotificationType]
+	txn.BundleID = notification.PackageName
+	if txn.ProductID == "" {
+		txn.ProductID = sub.SubscriptionID
+	}
+	if sub.NotificationType == playNotificationRevoked && txn.RevokedAt == nil {
+		if ms, err := strconv.ParseInt(notification.EventTimeMillis, 10, 64); err == nil {
+			txn.RevokedAt = fromMillis(&ms)
+		}
+	}
+	return txn, nil
+}
+
+func fromMillis(ms *int64) *time.Time {
+	if ms == nil {
+		return nil
+	}
+	t := time.UnixMilli(*ms).UTC()
+	return &t
+}
@@ -0,0 +1,308 @@
+package service
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/A-pen-app/hire-sdk/models"
+)
+
+var receiptNow = time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+
+func b64url(v interface{}) string {
+	raw, _ := json.Marshal(v)
+	return base64.RawURLEncoding.EncodeToString(raw)
+}
+
+// appleSigner mimics the App Store: an ECDSA leaf certificate issued by an
+// intermediate under a locally generated root, both carrying Apple's marker
+// extensions unless told otherwise. Payloads are signed at signedAt.
+type appleSigner struct {
+	roots    *x509.CertPool
+	chain    [][]byte
+	key      *ecdsa.PrivateKey
+	signedAt time.Time
+}
+
+type appleSignerOptions struct {
+	noLeafMarker, noIntermediateMarker bool
+}
+
+func newAppleSigner(t *testing.T) *appleSigner {
+	return newAppleSignerWith(t, appleSignerOptions{})
+}
+
+func newAppleSignerWith(t *testing.T, opts appleSignerOptions) *appleSigner {
+	t.Helper()
+	marker := func(oid asn1.ObjectIdentifier, skip bool) []pkix.Extension {
+		if skip {
+			return nil
+		}
+		return []pkix.Extension{{Id: oid, Value: []byte{0x05, 0x00}}}
+	}
+
+	rootKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	rootTmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Test Root"},
+		NotBefore:             receiptNow.Add(-time.Hour),
+		NotAfter:              receiptNow.Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	rootDER, err := x509.CreateCertificate(rand.Reader, rootTmpl, rootTmpl, &rootKey.PublicKey, rootKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	root, _ := x509.ParseCertificate(rootDER)
+
+	intermediateKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	intermediateTmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(2),
+		Subject:               pkix.Name{CommonName: "Test Intermediate"},
+		NotBefore:             receiptNow.Add(-time.Hour),
+		NotAfter:              receiptNow.Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		ExtraExtensions:       marker(appleIntermediateCertOID, opts.noIntermediateMarker),
+	}
+	intermediateDER, err := x509.CreateCertificate(rand.Reader, intermediateTmpl, root, &intermediateKey.PublicKey, rootKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	intermediate, _ := x509.ParseCertificate(intermediateDER)
+
+	leafKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	leafTmpl := &x509.Certificate{
+		SerialNumber:    big.NewInt(3),
+		Subject:         pkix.Name{CommonName: "Test Leaf"},
+		NotBefore:       receiptNow.Add(-time.Hour),
+		NotAfter:        receiptNow.Add(time.Hour),
+		KeyUsage:        x509.KeyUsageDigitalSignature,
+		ExtraExtensions: marker(appleReceiptSigningOID, opts.noLeafMarker),
+	}
+	leafDER, err := x509.CreateCertificate(rand.Reader, leafTmpl, intermediate, &leafKey.PublicKey, intermediateKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	roots := x509.NewCertPool()
+	roots.AddCert(root)
+	return &appleSigner{roots: roots, chain: [][]byte{leafDER, intermediateDER, rootDER}, key: leafKey, signedAt: receiptNow}
+}
+
+func (a *appleSigner) sign(t *testing.T, payload map[string]interface{}) string {
+	t.Helper()
+	payload["signedDate"] = a.signedAt.UnixMilli()
+	x5c := make([]string, len(a.chain))
+	for i, der := range a.chain {
+		x5c[i] = base64.StdEncoding.EncodeToString(der)
+	}
+	input := b64url(map[string]interface{}{
+		"alg": "ES256",
+		"x5c": x5c,
+	}) + "." + b64url(payload)
+	digest := sha256.Sum256([]byte(input))
+	r, s, err := ecdsa.Sign(rand.Reader, a.key, digest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	sig := make([]byte, 64)
+	r.FillBytes(sig[:32])
+	s.FillBytes(sig[32:])
+	return input + "." + base64.RawURLEncoding.EncodeToString(sig)
+}
+
+func (a *appleSigner) notification(t *testing.T, expires int64) []byte {
+	t.Helper()
+	info := a.sign(t, map[string]interface{}{
+		"transactionId":         "2000",
+		"originalTransactionId": "1000",
+		"bundleId":              "com.yoku.apen",
+		"productId":             "monthly",
+		"expiresDate":           expires,
+	})
+	body, _ := json.Marshal(map[string]string{
+		"signedPayload": a.sign(t, map[string]interface{}{
+			"notificationType": "DID_RENEW",
+			"notificationUUID": "uuid-1",
+			"data": map[string]string{
+				"bundleId":              "com.yoku.apen",
+				"signedTransactionInfo": info,
+			},
+		}),
+	})
+	return body
+}
+
+func TestVerifyAppStore(t *testing.T) {
+	signer := newAppleSigner(t)
+	v := NewReceiptVerifier(ReceiptVerifierConfig{AppleRoots: signer.roots, Now: func() time.Time { return receiptNow }})
+	expires := receiptNow.Add(30 * 24 * time.Hour).UnixMilli()
+
+	txn, err := v.Verify(context.Background(), &models.Receipt{Platform: models.StoreAppStore, Payload: signer.notification(t, expires)})
+	if err != nil {
+		t.Fatalf("Verify: %v", err)
+	}
+	if txn.NotificationID != "uuid-1" || txn.NotificationType != "DID_RENEW" || txn.BundleID != "com.yoku.apen" ||
+		txn.OriginalTransactionID != "1000" || txn.TransactionID != "2000" || txn.ProductID != "monthly" {
+		t.Errorf("unexpected transaction %+v", txn)
+	}
+	if txn.ExpiresAt == nil || txn.ExpiresAt.UnixMilli() != expires {
+		t.Errorf("ExpiresAt = %v, want %d", txn.ExpiresAt, expires)
+	}
+	if status, _ := txn.StatusAt(receiptNow); status != models.SubscriptionSubscribed {
+		t.Errorf("StatusAt = %d, want subscribed", status)
+	}
+
+	// a payload re-signed by anyone else must be rejected
+	other := newAppleSigner(t)
+	if _, err := v.Verify(context.Background(), &models.Receipt{Platform: models.StoreAppStore, Payload: other.notification(t, expires)}); !errors.Is(err, models.ErrorInvalidReceipt) {
+		t.Errorf("untrusted root: err = %v, want ErrorInvalidReceipt", err)
+	}
+
+	// certificates that expired since the payload was signed still verify
+	later := NewReceiptVerifier(ReceiptVerifierConfig{AppleRoots: signer.roots, Now: func() time.Time { return receiptNow.AddDate(1, 0, 0) }})
+	if _, err := later.Verify(context.Background(), &models.Receipt{Platform: models.StoreAppStore, Payload: signer.notification(t, expires)}); err != nil {
+		t.Errorf("verified a year later: %v", err)
+	}
+	signer.signedAt = receiptNow.Add(2 * time.Hour)
+	if _, err := v.Verify(context.Background(), &models.Receipt{Platform: models.StoreAppStore, Payload: signer.notification(t, expires)}); !errors.Is(err, models.ErrorInvalidReceipt) {
+		t.Errorf("signed after the certificates expired: err = %v, want ErrorInvalidReceipt", err)
+	}
+	signer.signedAt = receiptNow
+
+	// chains without Apple's markers must be rejected
+	for name, opts := range map[string]appleSignerOptions{
+		"unmarked leaf":         {noLeafMarker: true},
+		"unmarked intermediate": {noIntermediateMarker: true},
+	} {
+		unmarked := newAppleSignerWith(t, opts)
+		v := NewReceiptVerifier(ReceiptVerifierConfig{AppleRoots: unmarked.roots, Now: func() time.Time { return receiptNow }})
+		if _, err := v.Verify(context.Background(), &models.Receipt{Platform: models.StoreAppStore, Payload: unmarked.notification(t, expires)}); !errors.Is(err, models.ErrorInvalidReceipt) {
+			t.Errorf("%s: err = %v, want ErrorInvalidReceipt", name, err)
+		}
+	}
+
+	// tamper with the signed payload without re-signing
+	body := map[string]string{}
+	_ = json.Unmarshal(signer.notification(t, expires), &body)
+	token := []byte(body["signedPayload"])
+	token[len(token)-2] ^= 'A' ^ 'B'
+	tampered, _ := json.Marshal(map[string]string{"signedPayload": string(token)})
+	if _, err := v.Verify(context.Background(), &models.Receipt{Platform: models.StoreAppStore, Payload: tampered}); !errors.Is(err, models.ErrorInvalidReceipt) {
+		t.Errorf("tampered signature: err = %v, want ErrorInvalidReceipt", err)
+	}
+}
+
+type stubPlayFetcher struct {
+	txn *models.StoreTransaction
+}
+
+func (f *stubPlayFetcher) GetSubscription(ctx context.Context, packageName, subscriptionID, purchaseToken string) (*models.StoreTransaction, error) {
+	txn := *f.txn
+	return &txn, nil
+}
+
+func signRS256(t *testing.T, key *rsa.PrivateKey, claims interface{}) string {
+	t.Helper()
+	input := b64url(map[string]string{"alg": "RS256", "kid": "k1"}) + "." + b64url(claims)
+	digest := sha256.Sum256([]byte(input))
+	sig, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return input + "." + base64.RawURLEncoding.EncodeToString(sig)
+}
+
+func TestVerifyPlayStore(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expires := receiptNow.Add(30 * 24 * time.Hour)
+	v := NewReceiptVerifier(ReceiptVerifierConfig{
+		GoogleKeys:     StaticKeySet{"k1": &key.PublicKey},
+		GoogleAudience: "https://hire.example.com/rtdn",
+		PlayFetcher: &stubPlayFetcher{txn: &models.StoreTransaction{
+			TransactionID:         "GPA.1-1",
+			OriginalTransactionID: "GPA.1",
+			ExpiresAt:             &expires,
+		}},
+		Now: func() time.Time { return receiptNow },
+	})
+
+	data, _ := json.Marshal(map[string]interface{}{
+		"packageName":     "com.yoku.apen",
+		"eventTimeMillis": "1772366400000",
+		"subscriptionNotification": map[string]interface{}{
+			"notificationType": 12,
+			"purchaseToken":    "token",
+			"subscriptionId":   "monthly",
+		},
+	})
+	payload, _ := json.Marshal(map[string]interface{}{
+		"message": map[string]string{"data": base64.StdEncoding.EncodeToString(data), "messageId": "m-1"},
+	})
+	claims := map[string]interface{}{
+		"iss": "https://accounts.google.com",
+		"aud": "https://hire.example.com/rtdn",
+		"exp": receiptNow.Add(time.Hour).Unix(),
+	}
+
+	txn, err := v.Verify(context.Background(), &models.Receipt{
+		Platform:      models.StorePlayStore,
+		Payload:       payload,
+		Authorization: "Bearer " + signRS256(t, key, claims),
+	})
+	if err != nil {
+		t.Fatalf("Verify: %v", err)
+	}
+	if txn.NotificationID != "m-1" || txn.NotificationType != "SUBSCRIPTION_REVOKED" || txn.BundleID != "com.yoku.apen" || txn.ProductID != "monthly" {
+		t.Errorf("unexpected transaction %+v", txn)
+	}
+	if status, _ := txn.StatusAt(receiptNow); txn.RevokedAt == nil || status != models.SubscriptionNone {
+		t.Errorf("revoked purchase should grant nothing, got status %d, revoked at %v", status, txn.RevokedAt)
+	}
+
+	bad := map[string]map[string]interface{}{
+		"wrong audience": {"iss": claims["iss"], "aud": "https://elsewhere", "exp": claims["exp"]},
+		"wrong issuer":   {"iss": "https://evil.example.com", "aud": claims["aud"], "exp": claims["exp"]},
+		"expired":        {"iss": claims["iss"], "aud": claims["aud"], "exp": receiptNow.Add(-time.Minute).Unix()},
+	}
+	for name, c := range bad {
+		_, err := v.Verify(context.Background(), &models.Receipt{
+			Platform:      models.StorePlayStore,
+			Payload:       payload,
+			Authorization: "Bearer " + signRS256(t, key, c),
+		})
+		if !errors.Is(err, models.ErrorInvalidReceipt) {
+			t.Errorf("%s: err = %v, want ErrorInvalidReceipt", name, err)
+		}
+	}
+
+	otherKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	if _, err := v.Verify(context.Background(), &models.Receipt{
+		Platform:      models.StorePlayStore,
+		Payload:       payload,
+		Authorization: "Bearer " + signRS256(t, otherKey, claims),
+	}); !errors.Is(err, models.ErrorInvalidReceipt) {
+		t.Errorf("foreign key: err = %v, want ErrorInvalidReceipt", err)
+	}
+}
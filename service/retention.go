@@ -0,0 +1,116 @@
+package service
+
+import (
+	"context"
+	"time"
+
+	"github.com/A-pen-app/hire-sdk/models"
+	"github.com/A-pen-app/hire-sdk/store"
+	"github.com/A-pen-app/logging"
+)
+
+// retentionBatchSize bounds how many rows one purge statement deletes.
+const retentionBatchSize = 500
+
+type retentionService struct {
+	a  store.App
+	rt store.Retention
+}
+
+func NewRetention(a store.App, rt store.Retention) Retention {
+	return &retentionService{a: a, rt: rt}
+}
+
+// Run applies the app's retention policy as of now. Every batch commits on
+// its own and the rules only ever match what is still left to purge, so a
+// run cut short (e.g. by ctx) resumes where it stopped when run again; the
+// report counts what was purged until then. A dry run counts what the purge
+// would remove right now without deleting anything; snapshots that only
+// become purgeable once their chat's messages are purged show up in the
+// next dry run.
+func (s *retentionService) Run(ctx context.Context, bundleID string, now time.Time, dryRun bool) (*models.RetentionReport, error) {
+	app, err := s.a.GetByBundleID(ctx, bundleID)
+	if err != nil {
+		logging.Errorw(ctx, "failed to get app by bundle ID", "err", err, "bundleID", bundleID)
+		return nil, err
+	}
+
+	report := &models.RetentionReport{AppID: app.ID, DryRun: dryRun, RanAt: now}
+	policy := app.Config.RetentionPolicy()
+
+	// messages go first, so the snapshots of the chats they empty are
+	// purged in the same run
+	if cutoff, ok := policy.MessageCutoff(now); ok {
+		if report.Messages, err = s.apply(ctx, dryRun, app.ID, cutoff, s.rt.CountMessages, s.rt.PurgeMessages); err != nil {
+			return report, err
+		}
+	}
+	if cutoff, ok := policy.SnapshotCutoff(now); ok {
+		if report.ResumeSnapshots, err = s.apply(ctx, dryRun, app.ID, cutoff, s.rt.CountResumeSnapshots, s.rt.PurgeResumeSnapshots); err != nil {
+			return report, err
+		}
+		if report.BusinessCardSnapshots, err = s.apply(ctx, dryRun, app.ID, cutoff, s.rt.CountBusinessCardSnapshots, s.rt.PurgeBusinessCardSnapshots); err != nil {
+			return report, err
+		}
+	}
+	return report, nil
+}
+
+// apply counts a rule on a dry run, and otherwise purges it in batches until
+// nothing is left.
+func (s *retentionService) apply(
+	ctx context.Context,
+	dryRun bool,
+	appID string,
+	cutoff time.Time,
+	count func(ctx context.Context, appID string, cutoff time.Time) (int, error),
+	purge func(ctx context.Context, appID string, cutoff time.Time, limit int) (int, error),
+) (int, error) {
+	if dryRun {
+		return count(ctx, appID, cutoff)
+	}
+	total := 0
+	for {
+		n, err := purge(ctx, appID, cutoff, retentionBatchSize)
+		if err != nil {
+			logging.Errorw(ctx, "retention purge failed", "err", err, "appID", appID, "purged", total)
+			return total, err
+		}
+		total += n
+		if n < retentionBatchSize {
+			return total, nil
+		}
+		if err := ctx.Err(); err != nil {
+			return total, err
+		}
+	}
+}
+
+// PlaceLegalHold exempts the user's data from retention purges until the
+// hold is released.
+func (s *retentionService) PlaceLegalHold(ctx context.Context, bundleID, userID, reason string) error {
+	app, err := s.a.GetByBundleID(ctx, bundleID)
+	if err != nil {
+		logging.Errorw(ctx, "failed to get app by bundle ID", "err", err, "bundleID", bundleID)
+		return err
+	}
+	return s.rt.PlaceLegalHold(ctx, app.ID, userID, reason)
+}
+
+func (s *retentionService) ReleaseLegalHold(ctx context.Context, bundleID, userID string) error {
+	app, err := s.a.GetByBundleID(ctx, bundleID)
+	if err != nil {
+		logging.Errorw(ctx, "failed to get app by bundle ID", "err", err, "bundleID", bundleID)
+		return err
+	}
+	return s.rt.ReleaseLegalHold(ctx, app.ID, userID)
+}
+
+func (s *retentionService) ListLegalHolds(ctx context.Context, bundleID string) ([]*models.LegalHold, error) {
+	app, err := s.a.GetByBundleID(ctx, bundleID)
+	if err != nil {
+		logging.Errorw(ctx, "failed to get app by bundle ID", "err", err, "bundleID", bundleID)
+		return nil, err
+	}
+	return s.rt.ListLegalHolds(ctx, app.ID)
+}
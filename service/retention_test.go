@@ -0,0 +1,89 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/A-pen-app/hire-sdk/models"
+	"github.com/A-pen-app/hire-sdk/store"
+)
+
+// fakeRetention holds a number of purgeable rows per rule and records the
+// cutoffs it was asked about.
+type fakeRetention struct {
+	store.Retention
+	messages, resumes, cards int
+	cutoffs                  []time.Time
+}
+
+func (f *fakeRetention) take(left *int, cutoff time.Time, limit int) int {
+	f.cutoffs = append(f.cutoffs, cutoff)
+	n := min(*left, limit)
+	*left -= n
+	return n
+}
+
+func (f *fakeRetention) CountMessages(ctx context.Context, appID string, before time.Time) (int, error) {
+	return f.messages, nil
+}
+
+func (f *fakeRetention) PurgeMessages(ctx context.Context, appID string, before time.Time, limit int) (int, error) {
+	return f.take(&f.messages, before, limit), nil
+}
+
+func (f *fakeRetention) CountResumeSnapshots(ctx context.Context, appID string, before time.Time) (int, error) {
+	return f.resumes, nil
+}
+
+func (f *fakeRetention) PurgeResumeSnapshots(ctx context.Context, appID string, before time.Time, limit int) (int, error) {
+	return f.take(&f.resumes, before, limit), nil
+}
+
+func (f *fakeRetention) CountBusinessCardSnapshots(ctx context.Context, appID string, before time.Time) (int, error) {
+	return f.cards, nil
+}
+
+func (f *fakeRetention) PurgeBusinessCardSnapshots(ctx context.Context, appID string, before time.Time, limit int) (int, error) {
+	return f.take(&f.cards, before, limit), nil
+}
+
+func TestRetentionRun(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2026, 3, 31, 0, 0, 0, 0, time.UTC)
+	policy := &models.RetentionPolicy{MessageMonths: 6, SnapshotMonths: 12}
+	apps := fakeApps{
+		"com.yoku.apen": {ID: "app", BundleID: "com.yoku.apen", Config: &models.AppConfig{Retention: policy}},
+		"com.yoku.keep": {ID: "keep", BundleID: "com.yoku.keep"},
+	}
+	rt := &fakeRetention{messages: 2*retentionBatchSize + 1, resumes: 3, cards: 1}
+	s := NewRetention(apps, rt)
+
+	report, err := s.Run(ctx, "com.yoku.apen", now, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Messages != 2*retentionBatchSize+1 || report.ResumeSnapshots != 3 || rt.messages != 2*retentionBatchSize+1 {
+		t.Errorf("dry run: report %+v, %d messages left", report, rt.messages)
+	}
+
+	report, err = s.Run(ctx, "com.yoku.apen", now, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Messages != 2*retentionBatchSize+1 || report.ResumeSnapshots != 3 || report.BusinessCardSnapshots != 1 {
+		t.Errorf("run: report %+v", report)
+	}
+	if rt.messages != 0 || rt.resumes != 0 || rt.cards != 0 {
+		t.Errorf("run left rows behind: %+v", rt)
+	}
+	if len(rt.cutoffs) != 5 || !rt.cutoffs[0].Equal(time.Date(2025, 10, 1, 0, 0, 0, 0, time.UTC)) || !rt.cutoffs[3].Equal(now.AddDate(-1, 0, 0)) {
+		t.Errorf("unexpected cutoffs %v", rt.cutoffs)
+	}
+
+	rt = &fakeRetention{messages: 10}
+	report, err = NewRetention(apps, rt).Run(ctx, "com.yoku.keep", now, false)
+	if err != nil || report.Messages != 0 || rt.messages != 10 {
+		t.Errorf("app without a policy purged %d messages (err %v)", report.Messages, err)
+	}
+}
@@ -0,0 +1,192 @@
+package service
+
+import (
+	"context"
+	"time"
+
+	"github.com/A-pen-app/hire-sdk/models"
+	"github.com/A-pen-app/hire-sdk/store"
+	"github.com/A-pen-app/logging"
+)
+
+// scheduleBatchSize bounds how many due messages one claim takes.
+const scheduleBatchSize = 100
+
+// WithScheduledMessages lets users schedule messages to be sent later,
+// kept in sm. Without it scheduling fails with models.ErrorUnsupported.
+func WithScheduledMessages(sm store.ScheduledMessage) ChatOption {
+	return func(s *chatService) {
+		s.scheduled = sm
+	}
+}
+
+// ScheduleMessage checks the message as SendMessage would and keeps it to be
+// sent at sendAt by DispatchScheduledMessages, which checks it again then.
+func (s *chatService) ScheduleMessage(ctx context.Context, bundleID, userID, chatID string, sendAt time.Time, options ...models.SendOptionFunc) (*models.ScheduledMessage, error) {
+	if s.scheduled == nil {
+		return nil, models.ErrorUnsupported
+	}
+	if !sendAt.After(time.Now()) {
+		return nil, models.ErrorWrongParams
+	}
+	params, err := buildSendOption(ctx, options)
+	if err != nil {
+		return nil, err
+	}
+
+	app, err := s.a.GetByBundleID(ctx, bundleID)
+	if err != nil {
+		logging.Errorw(ctx, "failed to get app by bundle ID", "err", err, "bundleID", bundleID)
+		return nil, err
+	}
+	if _, err := s.checkSendable(ctx, app, bundleID, userID, chatID, params); err != nil {
+		return nil, err
+	}
+
+	id, err := s.scheduled.Create(ctx, app.ID, userID, chatID, sendAt, params)
+	if err != nil {
+		return nil, err
+	}
+	return s.scheduled.Get(ctx, app.ID, id)
+}
+
+// EditScheduledMessage replaces the send time and content of the user's
+// scheduled message. Once it is being sent or has been, it can no longer be
+// edited (models.ErrorNotAllowed).
+func (s *chatService) EditScheduledMessage(ctx context.Context, bundleID, userID, scheduledID string, sendAt time.Time, options ...models.SendOptionFunc) (*models.ScheduledMessage, error) {
+	if s.scheduled == nil {
+		return nil, models.ErrorUnsupported
+	}
+	if !sendAt.After(time.Now()) {
+		return nil, models.ErrorWrongParams
+	}
+	params, err := buildSendOption(ctx, options)
+	if err != nil {
+		return nil, err
+	}
+
+	app, scheduled, err := s.getScheduled(ctx, bundleID, userID, scheduledID)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := s.checkSendable(ctx, app, bundleID, userID, scheduled.ChatID, params); err != nil {
+		return nil, err
+	}
+
+	if err := s.scheduled.Update(ctx, app.ID, scheduledID, sendAt, params); err != nil {
+		return nil, err
+	}
+	return s.scheduled.Get(ctx, app.ID, scheduledID)
+}
+
+// CancelScheduledMessage cancels the user's scheduled message, unless it is
+// already being sent or has been (models.ErrorNotAllowed).
+func (s *chatService) CancelScheduledMessage(ctx context.Context, bundleID, userID, scheduledID string) error {
+	if s.scheduled == nil {
+		return models.ErrorUnsupported
+	}
+	app, _, err := s.getScheduled(ctx, bundleID, userID, scheduledID)
+	if err != nil {
+		return err
+	}
+	return s.scheduled.Cancel(ctx, app.ID, scheduledID)
+}
+
+// ListScheduledMessages returns the user's scheduled messages in the chat
+// that have not been sent or canceled, failed ones included.
+func (s *chatService) ListScheduledMessages(ctx context.Context, bundleID, userID, chatID string) ([]*models.ScheduledMessage, error) {
+	if s.scheduled == nil {
+		return nil, models.ErrorUnsupported
+	}
+	app, err := s.a.GetByBundleID(ctx, bundleID)
+	if err != nil {
+		logging.Errorw(ctx, "failed to get app by bundle ID", "err", err, "bundleID", bundleID)
+		return nil, err
+	}
+
+	// check ownership
+	if _, err := s.c.Get(ctx, app.ID, chatID, userID); err != nil {
+		logging.Errorw(ctx, "failed to verify chat ownership", "err", err, "appID", app.ID, "chatID", chatID, "userID", userID)
+		return nil, err
+	}
+	return s.scheduled.List(ctx, app.ID, userID, chatID)
+}
+
+// DispatchScheduledMessages sends the app's scheduled messages due at now.
+// Each is checked again as SendMessage would, since the sender may have lost
+// access or their media may have expired meanwhile; those that fail are
+// marked FAILED with the reason and counted, not retried. Dispatchers may
+// run on several nodes at once: each message is claimed by one of them.
+func (s *chatService) DispatchScheduledMessages(ctx context.Context, bundleID string, now time.Time) (*models.DispatchReport, error) {
+	if s.scheduled == nil {
+		return nil, models.ErrorUnsupported
+	}
+	app, err := s.a.GetByBundleID(ctx, bundleID)
+	if err != nil {
+		logging.Errorw(ctx, "failed to get app by bundle ID", "err", err, "bundleID", bundleID)
+		return nil, err
+	}
+
+	report := &models.DispatchReport{AppID: app.ID, RanAt: now}
+	for {
+		due, err := s.scheduled.ClaimDue(ctx, app.ID, now, scheduleBatchSize)
+		if err != nil {
+			return report, err
+		}
+		// a message whose mark fails stays SENDING until its claim lapses,
+		// then is claimed again and sent under the same message ID, which
+		// adds nothing; the rest of the batch goes on
+		for _, scheduled := range due {
+			msgID, err := s.sendScheduled(ctx, app, bundleID, scheduled)
+			if err != nil {
+				logging.Errorw(ctx, "send scheduled message failed", "err", err, "id", scheduled.ID, "chatID", scheduled.ChatID)
+				if err := s.scheduled.MarkFailed(ctx, scheduled.ID, err.Error()); err != nil {
+					logging.Errorw(ctx, "mark scheduled message failed failed", "err", err, "id", scheduled.ID)
+				}
+				report.Failed++
+				continue
+			}
+			if err := s.scheduled.MarkSent(ctx, scheduled.ID, msgID); err != nil {
+				logging.Errorw(ctx, "mark scheduled message sent failed", "err", err, "id", scheduled.ID, "messageID", msgID)
+			}
+			report.Sent++
+		}
+		if len(due) < scheduleBatchSize {
+			return report, nil
+		}
+	}
+}
+
+// sendScheduled sends the scheduled message as scheduled.SentMessageID, so
+// sending it again, e.g. after its claim lapsed mid-send, adds nothing.
+func (s *chatService) sendScheduled(ctx context.Context, app *models.App, bundleID string, scheduled *models.ScheduledMessage) (string, error) {
+	params := scheduled.SendOption()
+	chat, err := s.checkSendable(ctx, app, bundleID, scheduled.SenderID, scheduled.ChatID, params)
+	if err != nil {
+		return "", err
+	}
+	msgID := scheduled.SentMessageID()
+	if _, err := s.c.AddMessageOnce(ctx, msgID, scheduled.SenderID, scheduled.ChatID, chat.ReceiverID, params.Type, params.Body, params.MediaIDs, params.ReplyToMessageID); err != nil {
+		return "", err
+	}
+	return msgID, nil
+}
+
+// getScheduled returns the user's scheduled message, failing with
+// models.ErrorNotFound for anyone else's.
+func (s *chatService) getScheduled(ctx context.Context, bundleID, userID, scheduledID string) (*models.App, *models.ScheduledMessage, error) {
+	app, err := s.a.GetByBundleID(ctx, bundleID)
+	if err != nil {
+		logging.Errorw(ctx, "failed to get app by bundle ID", "err", err, "bundleID", bundleID)
+		return nil, nil, err
+	}
+
+	scheduled, err := s.scheduled.Get(ctx, app.ID, scheduledID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if scheduled.SenderID != userID {
+		return nil, nil, models.ErrorNotFound
+	}
+	return app, scheduled, nil
+}
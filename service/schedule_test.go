@@ -0,0 +1,225 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/A-pen-app/hire-sdk/models"
+)
+
+// fakeSchedule is an in-memory store.ScheduledMessage.
+type fakeSchedule struct {
+	msgs []*models.ScheduledMessage
+	// markErr fails MarkSent and MarkFailed
+	markErr error
+}
+
+func (f *fakeSchedule) Create(ctx context.Context, appID, userID, chatID string, sendAt time.Time, params *models.SendOption) (string, error) {
+	id := fmt.Sprintf("s%d", len(f.msgs))
+	f.msgs = append(f.msgs, &models.ScheduledMessage{ID: id, AppID: appID, ChatID: chatID, SenderID: userID, SendAt: sendAt, Type: params.Type, Body: params.Body, Status: models.ScheduledPending})
+	return id, nil
+}
+
+func (f *fakeSchedule) Get(ctx context.Context, appID, id string) (*models.ScheduledMessage, error) {
+	for _, msg := range f.msgs {
+		if msg.ID == id && msg.AppID == appID {
+			copied := *msg
+			return &copied, nil
+		}
+	}
+	return nil, models.ErrorNotFound
+}
+
+func (f *fakeSchedule) List(ctx context.Context, appID, userID, chatID string) ([]*models.ScheduledMessage, error) {
+	msgs := []*models.ScheduledMessage{}
+	for _, msg := range f.msgs {
+		if msg.SenderID == userID && msg.ChatID == chatID && msg.Status != models.ScheduledSent && msg.Status != models.ScheduledCanceled {
+			msgs = append(msgs, msg)
+		}
+	}
+	return msgs, nil
+}
+
+func (f *fakeSchedule) pending(id string) (*models.ScheduledMessage, error) {
+	for _, msg := range f.msgs {
+		if msg.ID == id && msg.Status == models.ScheduledPending {
+			return msg, nil
+		}
+	}
+	return nil, models.ErrorNotAllowed
+}
+
+func (f *fakeSchedule) Update(ctx context.Context, appID, id string, sendAt time.Time, params *models.SendOption) error {
+	msg, err := f.pending(id)
+	if err != nil {
+		return err
+	}
+	msg.SendAt, msg.Type, msg.Body = sendAt, params.Type, params.Body
+	return nil
+}
+
+func (f *fakeSchedule) Cancel(ctx context.Context, appID, id string) error {
+	msg, err := f.pending(id)
+	if err != nil {
+		return err
+	}
+	msg.Status = models.ScheduledCanceled
+	return nil
+}
+
+func (f *fakeSchedule) ClaimDue(ctx context.Context, appID string, now time.Time, limit int) ([]*models.ScheduledMessage, error) {
+	due := []*models.ScheduledMessage{}
+	for _, msg := range f.msgs {
+		if msg.Status == models.ScheduledPending && !msg.SendAt.After(now) && len(due) < limit {
+			msg.Status = models.ScheduledSending
+			copied := *msg
+			due = append(due, &copied)
+		}
+	}
+	return due, nil
+}
+
+func (f *fakeSchedule) MarkSent(ctx context.Context, id, messageID string) error {
+	if f.markErr != nil {
+		return f.markErr
+	}
+	for _, msg := range f.msgs {
+		if msg.ID == id {
+			msg.Status, msg.MessageID = models.ScheduledSent, &messageID
+		}
+	}
+	return nil
+}
+
+func (f *fakeSchedule) MarkFailed(ctx context.Context, id, reason string) error {
+	if f.markErr != nil {
+		return f.markErr
+	}
+	for _, msg := range f.msgs {
+		if msg.ID == id {
+			msg.Status, msg.Error = models.ScheduledFailed, &reason
+		}
+	}
+	return nil
+}
+
+// sendingThread is a fakeThread that records the messages added to it.
+type sendingThread struct {
+	*fakeThread
+	added []string
+	ids   map[string]bool
+}
+
+func (f *sendingThread) AddMessageOnce(ctx context.Context, messageID, userID, chatID, receiverID string, typ models.MessageType, body *string, mediaIDs []string, replyToMessageID *string) (bool, error) {
+	if f.ids[messageID] {
+		return false, nil
+	}
+	if f.ids == nil {
+		f.ids = map[string]bool{}
+	}
+	f.ids[messageID] = true
+	f.added = append(f.added, fmt.Sprintf("%s->%s: %s", userID, receiverID, *body))
+	return true, nil
+}
+
+func (f *sendingThread) AddMessage(ctx context.Context, userID, chatID, receiverID string, typ models.MessageType, body *string, mediaIDs []string, replyToMessageID *string, referenceID *string) (string, error) {
+	f.added = append(f.added, fmt.Sprintf("%s->%s: %s", userID, receiverID, *body))
+	return fmt.Sprintf("msg-%d", len(f.added)), nil
+}
+
+func TestScheduledMessages(t *testing.T) {
+	ctx := context.Background()
+	apps := fakeApps{"com.yoku.apen": {ID: "app", BundleID: "com.yoku.apen"}}
+	thread := &sendingThread{fakeThread: &fakeThread{chatID: "chat"}}
+	schedule := &fakeSchedule{}
+	s := NewChat(thread, nil, apps, nil, nil, nil, nil, nil, WithScheduledMessages(schedule))
+	now := time.Now()
+
+	if _, err := s.ScheduleMessage(ctx, "com.yoku.apen", "alice", "chat", now.Add(-time.Minute), models.WithText("too late")); err != models.ErrorWrongParams {
+		t.Errorf("scheduling in the past: err = %v, want %v", err, models.ErrorWrongParams)
+	}
+
+	reminder, err := s.ScheduleMessage(ctx, "com.yoku.apen", "alice", "chat", now.Add(time.Hour), models.WithText("interview at 3"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	later, err := s.ScheduleMessage(ctx, "com.yoku.apen", "alice", "chat", now.Add(2*time.Hour), models.WithText("see you"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	canceled, err := s.ScheduleMessage(ctx, "com.yoku.apen", "alice", "chat", now.Add(time.Hour), models.WithText("never mind"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	edited, err := s.EditScheduledMessage(ctx, "com.yoku.apen", "alice", reminder.ID, now.Add(30*time.Minute), models.WithText("interview at 2"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *edited.Body != "interview at 2" || !edited.SendAt.Equal(now.Add(30*time.Minute)) {
+		t.Errorf("edited = %+v", edited)
+	}
+	if _, err := s.EditScheduledMessage(ctx, "com.yoku.apen", "bob", reminder.ID, now.Add(time.Hour), models.WithText("hijacked")); err != models.ErrorNotFound {
+		t.Errorf("editing someone else's: err = %v, want %v", err, models.ErrorNotFound)
+	}
+	if err := s.CancelScheduledMessage(ctx, "com.yoku.apen", "alice", canceled.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	report, err := s.DispatchScheduledMessages(ctx, "com.yoku.apen", now.Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Sent != 1 || report.Failed != 0 {
+		t.Errorf("report = %+v, want 1 sent", report)
+	}
+	if len(thread.added) != 1 || thread.added[0] != "alice->bob: interview at 2" {
+		t.Errorf("added = %v", thread.added)
+	}
+
+	if err := s.CancelScheduledMessage(ctx, "com.yoku.apen", "alice", reminder.ID); err != models.ErrorNotAllowed {
+		t.Errorf("canceling a sent message: err = %v, want %v", err, models.ErrorNotAllowed)
+	}
+	pending, err := s.ListScheduledMessages(ctx, "com.yoku.apen", "alice", "chat")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pending) != 1 || pending[0].ID != later.ID {
+		t.Errorf("pending = %v, want only %s", pending, later.ID)
+	}
+}
+
+func TestDispatchScheduledMessagesOnce(t *testing.T) {
+	ctx := context.Background()
+	apps := fakeApps{"com.yoku.apen": {ID: "app", BundleID: "com.yoku.apen"}}
+	thread := &sendingThread{fakeThread: &fakeThread{chatID: "chat"}}
+	schedule := &fakeSchedule{markErr: errors.New("connection reset")}
+	s := NewChat(thread, nil, apps, nil, nil, nil, nil, nil, WithScheduledMessages(schedule)).(*chatService)
+	now := time.Now()
+
+	for _, body := range []string{"first", "second"} {
+		if _, err := s.ScheduleMessage(ctx, "com.yoku.apen", "alice", "chat", now.Add(time.Minute), models.WithText(body)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// failing marks do not stop the batch
+	report, err := s.DispatchScheduledMessages(ctx, "com.yoku.apen", now.Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Sent != 2 {
+		t.Errorf("report = %+v, want 2 sent", report)
+	}
+
+	// a dispatcher that claimed the first again after its lease lapsed
+	if _, err := s.sendScheduled(ctx, apps["com.yoku.apen"], "com.yoku.apen", schedule.msgs[0]); err != nil {
+		t.Fatal(err)
+	}
+	if len(thread.added) != 2 || thread.added[0] != "alice->bob: first" || thread.added[1] != "alice->bob: second" {
+		t.Errorf("added = %v, want each message once", thread.added)
+	}
+}
@@ -2,6 +2,7 @@ package service
 
 import (
 	"context"
+	"io"
 	"time"
 
 	"github.com/A-pen-app/hire-sdk/models"
@@ -20,23 +21,76 @@ type Chat interface {
 	Get(ctx context.Context, bundleID, chatID, userID string) (*models.ChatRoom, error)
 	GetChats(ctx context.Context, bundleID, userID string, next string, count int, options ...models.GetOptionFunc) ([]*models.ChatRoom, string, error)
 	GetChatMessages(ctx context.Context, bundleID, userID, chatID string, next string, count int) ([]*models.Message, string, error)
+	GetMessagesAround(ctx context.Context, bundleID, userID, chatID, messageID string, before, after int) (*models.MessageWindow, error)
+	GetNewerMessages(ctx context.Context, bundleID, userID, chatID string, next string, count int) ([]*models.Message, string, error)
 	FetchNewMessages(ctx context.Context, bundleID, userID, chatID string, lastMessageID string) ([]*models.Message, error)
+	Read(ctx context.Context, bundleID, userID, chatID string) error
 	SendMessage(ctx context.Context, bundleID, userID, chatID string, options ...models.SendOptionFunc) (*models.Message, error)
+	SendTemplate(ctx context.Context, bundleID, userID, chatID, templateID string) (*models.Message, error)
+	ScheduleMessage(ctx context.Context, bundleID, userID, chatID string, sendAt time.Time, options ...models.SendOptionFunc) (*models.ScheduledMessage, error)
+	EditScheduledMessage(ctx context.Context, bundleID, userID, scheduledID string, sendAt time.Time, options ...models.SendOptionFunc) (*models.ScheduledMessage, error)
+	CancelScheduledMessage(ctx context.Context, bundleID, userID, scheduledID string) error
+	ListScheduledMessages(ctx context.Context, bundleID, userID, chatID string) ([]*models.ScheduledMessage, error)
+	DispatchScheduledMessages(ctx context.Context, bundleID string, now time.Time) (*models.DispatchReport, error)
 	UnsendMessage(ctx context.Context, bundleID, userID, messageID string) error
+	React(ctx context.Context, bundleID, userID, messageID, emoji string) error
+	Unreact(ctx context.Context, bundleID, userID, messageID, emoji string) error
+	Unlock(ctx context.Context, bundleID, recruiterID, chatID string) error
 	GetBusinessCardOnly(ctx context.Context, bundleID string, before time.Duration) ([]*models.BusinessCardChat, error)
 }
 
+type Media interface {
+	NewUploadIntent(ctx context.Context, bundleID, userID, filename string) (*models.UploadIntent, error)
+	CompleteUpload(ctx context.Context, bundleID, userID, key string, upload *models.MediaUpload) (string, error)
+	Sign(ctx context.Context, medias []*models.Media) error
+}
+
 type BusinessCardService interface {
 	Get(ctx context.Context, bundleID, userID string) (*models.BusinessCardContent, error)
 	Update(ctx context.Context, bundleID, userID string, card *models.BusinessCardContent) (*models.BusinessCardContent, error)
 }
 
 type Agreement interface {
-	Agree(ctx context.Context, bundleID, userID, version string) error
-	Get(ctx context.Context, bundleID, userID string) (*models.AgreementRecord, error)
+	Agree(ctx context.Context, bundleID, userID string, docType models.DocumentType, version string, evidence *models.ConsentEvidence) error
+	Revoke(ctx context.Context, bundleID, userID string, docType models.DocumentType, evidence *models.ConsentEvidence) error
+	History(ctx context.Context, bundleID, userID string) ([]*models.ConsentEvent, error)
+	Get(ctx context.Context, bundleID, userID string, docType models.DocumentType) (*models.AgreementRecord, error)
+	Pending(ctx context.Context, bundleID, userID string, types ...models.DocumentType) ([]*models.AgreementRecord, error)
 }
 
 type Subscription interface {
 	Get(ctx context.Context, bundleID, userID string) (*models.UserSubscription, error)
 	Update(ctx context.Context, bundleID, userID string, status models.SubscriptionStatus, expiresAt *time.Time) error
+	History(ctx context.Context, bundleID, userID string) ([]*models.SubscriptionEvent, error)
+	ExpireDue(ctx context.Context, now time.Time) (int, error)
+	ApplyReceipt(ctx context.Context, bundleID, userID string, receipt *models.Receipt) (*models.UserSubscription, error)
+	ListPlans(ctx context.Context, bundleID string) ([]*models.Plan, error)
+	SetPlan(ctx context.Context, bundleID, userID, planID string) error
+	Entitlements(ctx context.Context, bundleID, userID string) (models.Entitlements, error)
+	CheckEntitlement(ctx context.Context, bundleID, userID string, e models.Entitlement, used int) (bool, error)
+}
+
+type Privacy interface {
+	ExportUserData(ctx context.Context, bundleID, userID string, w io.Writer) error
+	EraseUser(ctx context.Context, bundleID, userID string) (*models.ErasureReport, error)
+}
+
+type Retention interface {
+	Run(ctx context.Context, bundleID string, now time.Time, dryRun bool) (*models.RetentionReport, error)
+	PlaceLegalHold(ctx context.Context, bundleID, userID, reason string) error
+	ReleaseLegalHold(ctx context.Context, bundleID, userID string) error
+	ListLegalHolds(ctx context.Context, bundleID string) ([]*models.LegalHold, error)
+}
+
+type Template interface {
+	Create(ctx context.Context, bundleID string, ownerID *string, name, body string) (*models.MessageTemplate, error)
+	List(ctx context.Context, bundleID, userID string) ([]*models.MessageTemplate, error)
+	Update(ctx context.Context, bundleID string, ownerID *string, templateID, name, body string) (*models.MessageTemplate, error)
+	Delete(ctx context.Context, bundleID string, ownerID *string, templateID string) error
+}
+
+type Presence interface {
+	SetTyping(ctx context.Context, bundleID, userID, chatID string) error
+	Touch(ctx context.Context, bundleID, userID string) error
+	Subscribe(ctx context.Context, bundleID, userID, chatID string) (<-chan *models.PresenceEvent, error)
 }
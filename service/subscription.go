@@ -14,10 +14,14 @@ import (
 type subscriptionService struct {
 	a store.App
 	s store.Subscription
+	p store.Plan
+	v ReceiptVerifier
 }
 
-func NewSubscription(a store.App, s store.Subscription) Subscription {
-	return &subscriptionService{a: a, s: s}
+// NewSubscription returns the subscription service. v may be nil, in which
+// case ApplyReceipt returns models.ErrorUnsupported.
+func NewSubscription(a store.App, s store.Subscription, p store.Plan, v ReceiptVerifier) Subscription {
+	return &subscriptionService{a: a, s: s, p: p, v: v}
 }
 
 func (s *subscriptionService) Get(ctx context.Context, bundleID, userID string) (*models.UserSubscription, error) {
@@ -35,15 +39,12 @@ func (s *subscriptionService) Get(ctx context.Context, bundleID, userID string)
 		return nil, err
 	}
 
-	if subscription.Status.HasOneOf(models.SubscriptionSubscribed) {
-		if subscription.ExpiresAt == nil {
-			logging.Errorw(ctx, "subscription expires at is nil", "app_id", app.ID, "user_id", userID)
-			return nil, errors.New("subscription expires at is nil")
-		}
-
-		if subscription.ExpiresAt.Before(time.Now()) {
-			subscription.Status = (subscription.Status &^ models.SubscriptionSubscribed) | models.SubscriptionNone
-		}
+	if subscription.Status.HasOneOf(models.SubscriptionSubscribed) && subscription.ExpiresAt == nil {
+		logging.Errorw(ctx, "subscription expires at is nil", "app_id", app.ID, "user_id", userID)
+		return nil, errors.New("subscription expires at is nil")
+	}
+	if err := s.fill(ctx, subscription); err != nil {
+		return nil, err
 	}
 
 	return subscription, nil
@@ -74,3 +75,211 @@ func (s *subscriptionService) Update(ctx context.Context, bundleID, userID strin
 
 	return s.s.Update(ctx, app.ID, userID, status, expiredAt)
 }
+
+// ApplyReceipt verifies a store notification and updates userID's
+// subscription from the transaction it carries, instead of trusting a
+// caller-supplied status. Redelivered notifications are no-ops, and a
+// notification older than the subscription already on record (stores don't
+// guarantee ordering) never shortens it.
+func (s *subscriptionService) ApplyReceipt(ctx context.Context, bundleID, userID string, receipt *models.Receipt) (*models.UserSubscription, error) {
+	if s.v == nil {
+		return nil, models.ErrorUnsupported
+	}
+
+	app, err := s.a.GetByBundleID(ctx, bundleID)
+	if err != nil {
+		logging.Errorw(ctx, "get app by bundle id failed", "err", err, "bundle_id", bundleID)
+		return nil, err
+	}
+
+	txn, err := s.v.Verify(ctx, receipt)
+	if err != nil {
+		if !errors.Is(err, models.ErrorUnsupported) {
+			logging.Errorw(ctx, "verify receipt failed", "err", err, "app_id", app.ID, "user_id", userID)
+		}
+		return nil, err
+	}
+	if txn.BundleID != app.BundleID {
+		logging.Errorw(ctx, "receipt is for another app", "app_id", app.ID, "bundle_id", txn.BundleID)
+		return nil, models.ErrorNotAllowed
+	}
+
+	// move the user onto the plan the product belongs to; products without
+	// a plan keep whatever plan the user had
+	var planID *string
+	if txn.ProductID != "" {
+		plan, err := s.p.GetByProductID(ctx, app.ID, txn.ProductID)
+		if err != nil && err != sql.ErrNoRows {
+			logging.Errorw(ctx, "get plan by product id failed", "err", err, "app_id", app.ID, "product_id", txn.ProductID)
+			return nil, err
+		}
+		if plan != nil {
+			planID = &plan.ID
+		}
+	}
+
+	if _, err := s.s.ApplyTransaction(ctx, app.ID, userID, txn, planID); err != nil {
+		logging.Errorw(ctx, "apply store transaction failed", "err", err, "app_id", app.ID, "user_id", userID, "original_transaction_id", txn.OriginalTransactionID)
+		return nil, err
+	}
+	return s.current(ctx, app.ID, userID)
+}
+
+func (s *subscriptionService) current(ctx context.Context, appID, userID string) (*models.UserSubscription, error) {
+	subscription, err := s.s.Get(ctx, appID, userID)
+	if err != nil {
+		if err != sql.ErrNoRows {
+			logging.Errorw(ctx, "get subscription failed", "err", err, "app_id", appID, "user_id", userID)
+		}
+		return nil, err
+	}
+	if err := s.fill(ctx, subscription); err != nil {
+		return nil, err
+	}
+	return subscription, nil
+}
+
+// fill resolves the subscription's status and entitlements as of now.
+func (s *subscriptionService) fill(ctx context.Context, subscription *models.UserSubscription) error {
+	now := time.Now()
+	plan, err := planOf(ctx, s.p, subscription)
+	if err != nil {
+		return err
+	}
+	subscription.Entitlements = subscription.EntitlementsAt(now, plan)
+	subscription.Status = subscription.StatusAt(now)
+	return nil
+}
+
+func (s *subscriptionService) ListPlans(ctx context.Context, bundleID string) ([]*models.Plan, error) {
+	app, err := s.a.GetByBundleID(ctx, bundleID)
+	if err != nil {
+		logging.Errorw(ctx, "get app by bundle id failed", "err", err, "bundle_id", bundleID)
+		return nil, err
+	}
+
+	return s.p.List(ctx, app.ID)
+}
+
+// SetPlan moves an existing subscription onto planID. It returns
+// sql.ErrNoRows when the user has no subscription or the app has no such
+// plan.
+func (s *subscriptionService) SetPlan(ctx context.Context, bundleID, userID, planID string) error {
+	app, err := s.a.GetByBundleID(ctx, bundleID)
+	if err != nil {
+		logging.Errorw(ctx, "get app by bundle id failed", "err", err, "bundle_id", bundleID)
+		return err
+	}
+
+	plan, err := s.p.Get(ctx, app.ID, planID)
+	if err != nil {
+		return err
+	}
+	return s.s.SetPlan(ctx, app.ID, userID, &plan.ID)
+}
+
+func (s *subscriptionService) Entitlements(ctx context.Context, bundleID, userID string) (models.Entitlements, error) {
+	app, err := s.a.GetByBundleID(ctx, bundleID)
+	if err != nil {
+		logging.Errorw(ctx, "get app by bundle id failed", "err", err, "bundle_id", bundleID)
+		return nil, err
+	}
+
+	return entitlementsOf(ctx, s.s, s.p, app.ID, userID)
+}
+
+// CheckEntitlement reports whether userID may use one more of e. used is the
+// caller's own count, e.g. the number of posts the user has open. Usage the
+// SDK meters itself (EntitlementMonthlyChatUnlocks in the current period) is
+// added to it.
+func (s *subscriptionService) CheckEntitlement(ctx context.Context, bundleID, userID string, e models.Entitlement, used int) (bool, error) {
+	app, err := s.a.GetByBundleID(ctx, bundleID)
+	if err != nil {
+		logging.Errorw(ctx, "get app by bundle id failed", "err", err, "bundle_id", bundleID)
+		return false, err
+	}
+
+	entitlements, err := entitlementsOf(ctx, s.s, s.p, app.ID, userID)
+	if err != nil {
+		return false, err
+	}
+	if e == models.EntitlementMonthlyChatUnlocks {
+		metered, err := s.p.Usage(ctx, app.ID, userID, e, models.EntitlementPeriod(time.Now()))
+		if err != nil {
+			return false, err
+		}
+		used += metered
+	}
+	return entitlements.Allows(e, used), nil
+}
+
+func (s *subscriptionService) History(ctx context.Context, bundleID, userID string) ([]*models.SubscriptionEvent, error) {
+	app, err := s.a.GetByBundleID(ctx, bundleID)
+	if err != nil {
+		logging.Errorw(ctx, "get app by bundle id failed", "err", err, "bundle_id", bundleID)
+		return nil, err
+	}
+
+	return s.s.ListEvents(ctx, app.ID, userID)
+}
+
+// ExpireDue is the batch job behind the expiry sweeper: it moves every
+// subscription that expired at or before now to SubscriptionNone, across all
+// apps, and returns how many were expired. Reads never depend on it having
+// run (see entitlementsOf); it only keeps the stored rows and the history
+// honest.
+func (s *subscriptionService) ExpireDue(ctx context.Context, now time.Time) (int, error) {
+	total := 0
+	for {
+		n, err := s.s.ExpireDue(ctx, now, expireBatchSize)
+		if err != nil {
+			logging.Errorw(ctx, "expire due subscriptions failed", "err", err, "expired", total)
+			return total, err
+		}
+		total += n
+		if n < expireBatchSize {
+			return total, nil
+		}
+		if err := ctx.Err(); err != nil {
+			return total, err
+		}
+	}
+}
+
+// expireBatchSize bounds how many rows one ExpireDue statement locks.
+const expireBatchSize = 500
+
+// entitlementsOf returns what userID's subscription grants right now. Every
+// service decides what a subscriber may do through this function, so a
+// stored row the sweeper hasn't expired yet already grants nothing.
+func entitlementsOf(ctx context.Context, st store.Subscription, p store.Plan, appID, userID string) (models.Entitlements, error) {
+	subscription, err := st.Get(ctx, appID, userID)
+	if err == sql.ErrNoRows {
+		return models.Entitlements{}, nil
+	} else if err != nil {
+		logging.Errorw(ctx, "failed to get subscription", "err", err, "appID", appID, "userID", userID)
+		return nil, err
+	}
+	plan, err := planOf(ctx, p, subscription)
+	if err != nil {
+		return nil, err
+	}
+	return subscription.EntitlementsAt(time.Now(), plan), nil
+}
+
+// planOf returns the plan the subscription is on, nil if it has none. A
+// plan that has since been deleted counts as none, rather than failing
+// everything its subscribers do.
+func planOf(ctx context.Context, p store.Plan, subscription *models.UserSubscription) (*models.Plan, error) {
+	if subscription.PlanID == nil {
+		return nil, nil
+	}
+	plan, err := p.Get(ctx, subscription.AppID, *subscription.PlanID)
+	if err == sql.ErrNoRows || err == models.ErrorNotFound {
+		return nil, nil
+	} else if err != nil {
+		logging.Errorw(ctx, "failed to get plan", "err", err, "appID", subscription.AppID, "planID", *subscription.PlanID)
+		return nil, err
+	}
+	return plan, nil
+}
@@ -0,0 +1,43 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/A-pen-app/hire-sdk/models"
+	"github.com/A-pen-app/hire-sdk/store"
+)
+
+// planSubscriptions is a store.Subscription where every user is subscribed
+// to planID.
+type planSubscriptions struct {
+	store.Subscription
+	planID string
+}
+
+func (f planSubscriptions) Get(ctx context.Context, appID, userID string) (*models.UserSubscription, error) {
+	expiresAt := time.Now().Add(time.Hour)
+	return &models.UserSubscription{AppID: appID, UserID: userID, Status: models.SubscriptionSubscribed, ExpiresAt: &expiresAt, PlanID: &f.planID}, nil
+}
+
+// noPlans is a store.Plan whose plans have all been deleted.
+type noPlans struct {
+	store.Plan
+}
+
+func (noPlans) Get(ctx context.Context, appID, planID string) (*models.Plan, error) {
+	return nil, sql.ErrNoRows
+}
+
+func TestEntitlementsOfDeletedPlan(t *testing.T) {
+	entitlements, err := entitlementsOf(context.Background(), planSubscriptions{planID: "gone"}, noPlans{}, "app", "alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// as if the subscription had no plan
+	if !entitlements.Allows(models.EntitlementChatAccess, 0) {
+		t.Errorf("entitlements = %v, want chat access", entitlements)
+	}
+}
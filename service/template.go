@@ -0,0 +1,208 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/A-pen-app/hire-sdk/models"
+	"github.com/A-pen-app/hire-sdk/store"
+	"github.com/A-pen-app/logging"
+)
+
+// PostTitles looks up the titles of hire posts, which are kept outside this
+// SDK, for the post_title template variable.
+type PostTitles interface {
+	PostTitle(ctx context.Context, appID, postID string) (string, error)
+}
+
+// WithTemplates lets users send the message templates kept in tm through
+// SendTemplate, looking post titles up in posts. posts may be nil, in which
+// case templates using post_title cannot be sent. Without this option
+// SendTemplate fails with models.ErrorUnsupported.
+func WithTemplates(tm store.Template, posts PostTitles) ChatOption {
+	return func(s *chatService) {
+		s.templates = tm
+		s.posts = posts
+	}
+}
+
+// SendTemplate sends the template to the chat as a text message, with its
+// variables filled in from the chat's post and the applicant's resume as the
+// user may see it. A variable without a value, e.g. a name masked until the
+// chat is unlocked, fails with a *models.TemplateVarsMissingError.
+func (s *chatService) SendTemplate(ctx context.Context, bundleID, userID, chatID, templateID string) (*models.Message, error) {
+	if s.templates == nil {
+		return nil, models.ErrorUnsupported
+	}
+	app, err := s.a.GetByBundleID(ctx, bundleID)
+	if err != nil {
+		logging.Errorw(ctx, "failed to get app by bundle ID", "err", err, "bundleID", bundleID)
+		return nil, err
+	}
+
+	tmpl, err := s.templates.Get(ctx, app.ID, templateID)
+	if err != nil {
+		return nil, err
+	}
+	if tmpl.OwnerID != nil && *tmpl.OwnerID != userID {
+		return nil, models.ErrorNotFound
+	}
+
+	// check ownership
+	chat, err := s.c.Get(ctx, app.ID, chatID, userID)
+	if err != nil {
+		logging.Errorw(ctx, "failed to verify chat ownership", "err", err, "appID", app.ID, "chatID", chatID, "userID", userID)
+		return nil, err
+	}
+	vars, err := s.templateVars(ctx, app, chat, userID, tmpl.Variables())
+	if err != nil {
+		return nil, err
+	}
+	body, err := tmpl.Render(vars)
+	if err != nil {
+		return nil, err
+	}
+	return s.SendMessage(ctx, bundleID, userID, chatID, models.WithText(body))
+}
+
+// templateVars returns the values of the named template variables in the
+// chat. Variables without a value are left out.
+func (s *chatService) templateVars(ctx context.Context, app *models.App, chat *models.ChatRoom, userID string, names []string) (map[string]string, error) {
+	vars := map[string]string{}
+	if chat.PostID == nil {
+		return vars, nil
+	}
+	needs := map[string]bool{}
+	for _, name := range names {
+		needs[name] = true
+	}
+
+	if needs[models.TemplateVarPostTitle] && s.posts != nil {
+		title, err := s.posts.PostTitle(ctx, app.ID, *chat.PostID)
+		if err != nil {
+			logging.Errorw(ctx, "failed to get post title", "err", err, "appID", app.ID, "postID", *chat.PostID)
+			return nil, err
+		}
+		vars[models.TemplateVarPostTitle] = title
+	}
+
+	if !needs[models.TemplateVarRealName] && !needs[models.TemplateVarContactTimes] {
+		return vars, nil
+	}
+	relation, err := s.r.GetRelation(ctx, models.ByChat(chat.ChatID))
+	if err == sql.ErrNoRows {
+		return vars, nil
+	} else if err != nil {
+		logging.Errorw(ctx, "failed to get resume relation", "err", err, "chatID", chat.ChatID)
+		return nil, err
+	}
+	if relation.SnapshotID == nil {
+		// purged by retention
+		return vars, nil
+	}
+	status, err := s.accessStatus(ctx, app, chat, userID)
+	if err != nil {
+		return nil, err
+	}
+	snapshot, err := s.r.GetSnapshot(ctx, *relation.SnapshotID)
+	if err != nil {
+		logging.Errorw(ctx, "failed to get resume snapshot", "err", err, "snapshotID", *relation.SnapshotID)
+		return nil, err
+	}
+
+	content := app.Config.MaskResume(snapshot.Content, toResumeStatus(status))
+	if content == nil {
+		return vars, nil
+	}
+	if content.RealName != nil {
+		vars[models.TemplateVarRealName] = *content.RealName
+	}
+	vars[models.TemplateVarContactTimes] = models.FormatContactTimes(content.ContactTimes)
+	return vars, nil
+}
+
+type templateService struct {
+	a store.App
+	t store.Template
+}
+
+func NewTemplate(a store.App, t store.Template) Template {
+	return &templateService{a: a, t: t}
+}
+
+// Create adds a template owned by ownerID, or shared by the whole app when
+// ownerID is nil.
+func (s *templateService) Create(ctx context.Context, bundleID string, ownerID *string, name, body string) (*models.MessageTemplate, error) {
+	if err := (&models.MessageTemplate{Name: name, Body: body}).Validate(); err != nil {
+		return nil, err
+	}
+	app, err := s.a.GetByBundleID(ctx, bundleID)
+	if err != nil {
+		logging.Errorw(ctx, "failed to get app by bundle ID", "err", err, "bundleID", bundleID)
+		return nil, err
+	}
+
+	id, err := s.t.Create(ctx, app.ID, ownerID, name, body)
+	if err != nil {
+		return nil, err
+	}
+	return s.t.Get(ctx, app.ID, id)
+}
+
+// List returns the templates the user can send: those shared by the app
+// followed by their own.
+func (s *templateService) List(ctx context.Context, bundleID, userID string) ([]*models.MessageTemplate, error) {
+	app, err := s.a.GetByBundleID(ctx, bundleID)
+	if err != nil {
+		logging.Errorw(ctx, "failed to get app by bundle ID", "err", err, "bundleID", bundleID)
+		return nil, err
+	}
+	return s.t.List(ctx, app.ID, userID)
+}
+
+// Update replaces the name and body of the template owned by ownerID, or of
+// the app's shared template when ownerID is nil.
+func (s *templateService) Update(ctx context.Context, bundleID string, ownerID *string, templateID, name, body string) (*models.MessageTemplate, error) {
+	if err := (&models.MessageTemplate{Name: name, Body: body}).Validate(); err != nil {
+		return nil, err
+	}
+	app, err := s.owned(ctx, bundleID, ownerID, templateID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.t.Update(ctx, app.ID, templateID, name, body); err != nil {
+		return nil, err
+	}
+	return s.t.Get(ctx, app.ID, templateID)
+}
+
+// Delete removes the template owned by ownerID, or the app's shared template
+// when ownerID is nil.
+func (s *templateService) Delete(ctx context.Context, bundleID string, ownerID *string, templateID string) error {
+	app, err := s.owned(ctx, bundleID, ownerID, templateID)
+	if err != nil {
+		return err
+	}
+	return s.t.Delete(ctx, app.ID, templateID)
+}
+
+// owned checks the template belongs to ownerID, failing with
+// models.ErrorNotFound otherwise, so users cannot touch each other's
+// templates nor the app's shared ones.
+func (s *templateService) owned(ctx context.Context, bundleID string, ownerID *string, templateID string) (*models.App, error) {
+	app, err := s.a.GetByBundleID(ctx, bundleID)
+	if err != nil {
+		logging.Errorw(ctx, "failed to get app by bundle ID", "err", err, "bundleID", bundleID)
+		return nil, err
+	}
+
+	tmpl, err := s.t.Get(ctx, app.ID, templateID)
+	if err != nil {
+		return nil, err
+	}
+	if (tmpl.OwnerID == nil) != (ownerID == nil) || (ownerID != nil && *tmpl.OwnerID != *ownerID) {
+		return nil, models.ErrorNotFound
+	}
+	return app, nil
+}
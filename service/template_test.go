@@ -0,0 +1,182 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/A-pen-app/hire-sdk/models"
+	"github.com/A-pen-app/hire-sdk/store"
+)
+
+// fakeTemplates is an in-memory store.Template.
+type fakeTemplates struct {
+	templates []*models.MessageTemplate
+}
+
+func (f *fakeTemplates) Create(ctx context.Context, appID string, ownerID *string, name, body string) (string, error) {
+	id := fmt.Sprintf("t%d", len(f.templates))
+	f.templates = append(f.templates, &models.MessageTemplate{ID: id, AppID: appID, OwnerID: ownerID, Name: name, Body: body})
+	return id, nil
+}
+
+func (f *fakeTemplates) Get(ctx context.Context, appID, id string) (*models.MessageTemplate, error) {
+	for _, tmpl := range f.templates {
+		if tmpl.ID == id && tmpl.AppID == appID {
+			copied := *tmpl
+			return &copied, nil
+		}
+	}
+	return nil, models.ErrorNotFound
+}
+
+func (f *fakeTemplates) List(ctx context.Context, appID, userID string) ([]*models.MessageTemplate, error) {
+	templates := []*models.MessageTemplate{}
+	for _, tmpl := range f.templates {
+		if tmpl.AppID == appID && (tmpl.OwnerID == nil || *tmpl.OwnerID == userID) {
+			templates = append(templates, tmpl)
+		}
+	}
+	return templates, nil
+}
+
+func (f *fakeTemplates) Update(ctx context.Context, appID, id, name, body string) error {
+	for _, tmpl := range f.templates {
+		if tmpl.ID == id && tmpl.AppID == appID {
+			tmpl.Name, tmpl.Body = name, body
+			return nil
+		}
+	}
+	return models.ErrorNotFound
+}
+
+func (f *fakeTemplates) Delete(ctx context.Context, appID, id string) error {
+	for i, tmpl := range f.templates {
+		if tmpl.ID == id && tmpl.AppID == appID {
+			f.templates = append(f.templates[:i], f.templates[i+1:]...)
+			return nil
+		}
+	}
+	return models.ErrorNotFound
+}
+
+// postThread is a fakeThread about a post, unlocked, that keeps the messages
+// added to it.
+type postThread struct {
+	*fakeThread
+}
+
+func (f postThread) Get(ctx context.Context, appID, chatID, userID string) (*models.ChatRoom, error) {
+	chat, err := f.fakeThread.Get(ctx, appID, chatID, userID)
+	if err != nil {
+		return nil, err
+	}
+	postID := "post"
+	chat.PostID, chat.AccessStatus = &postID, models.AccessStatusUnlocked
+	return chat, nil
+}
+
+func (f postThread) AddMessage(ctx context.Context, userID, chatID, receiverID string, typ models.MessageType, body *string, mediaIDs []string, replyToMessageID *string, referenceID *string) (string, error) {
+	id := fmt.Sprintf("msg-%d", len(f.msgs))
+	f.msgs = append(f.msgs, &models.Message{ID: id, SenderID: userID, Type: typ, Body: body})
+	return id, nil
+}
+
+// bobsResume is bob's resume, applied to every chat.
+type bobsResume struct {
+	store.Resume
+}
+
+func (bobsResume) GetRelation(ctx context.Context, opts ...models.GetRelationOptionFunc) (*models.ResumeRelation, error) {
+	snapshotID := "rs"
+	return &models.ResumeRelation{UserID: "bob", SnapshotID: &snapshotID}, nil
+}
+
+func (bobsResume) GetSnapshot(ctx context.Context, snapshotID string) (*models.ResumeSnapshot, error) {
+	name := "王小明"
+	return &models.ResumeSnapshot{ID: snapshotID, Content: &models.ResumeContent{
+		RealName:     &name,
+		ContactTimes: []models.ContactTime{{DayOfWeek: "星期一", StartTime: "09:00", EndTime: "12:00"}},
+	}}, nil
+}
+
+// purgedResume is bob's resume after retention purged its snapshot.
+type purgedResume struct {
+	store.Resume
+}
+
+func (purgedResume) GetRelation(ctx context.Context, opts ...models.GetRelationOptionFunc) (*models.ResumeRelation, error) {
+	return &models.ResumeRelation{UserID: "bob"}, nil
+}
+
+type postTitles map[string]string
+
+func (p postTitles) PostTitle(ctx context.Context, appID, postID string) (string, error) {
+	return p[postID], nil
+}
+
+func TestSendTemplate(t *testing.T) {
+	ctx := context.Background()
+	apps := fakeApps{"com.yoku.apen": {ID: "app", BundleID: "com.yoku.apen"}}
+	templates := &fakeTemplates{}
+	tm := NewTemplate(apps, templates)
+	alice := "alice"
+
+	shared, err := tm.Create(ctx, "com.yoku.apen", nil, "thanks", "{{real_name}} 您好，感謝應徵{{post_title}}，方便於{{contact_times}}致電嗎？")
+	if err != nil {
+		t.Fatal(err)
+	}
+	own, err := tm.Create(ctx, "com.yoku.apen", &alice, "interview", "{{real_name}}，面試改到週五")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tm.Create(ctx, "com.yoku.apen", &alice, "salary", "{{salary}}"); err != models.ErrorWrongParams {
+		t.Errorf("unknown variable: err = %v, want %v", err, models.ErrorWrongParams)
+	}
+	if _, err := tm.Update(ctx, "com.yoku.apen", &alice, shared.ID, "mine now", "hi"); err != models.ErrorNotFound {
+		t.Errorf("editing the app's template: err = %v, want %v", err, models.ErrorNotFound)
+	}
+	if list, err := tm.List(ctx, "com.yoku.apen", "bob"); err != nil || len(list) != 1 || list[0].ID != shared.ID {
+		t.Errorf("bob's templates = %v, %v; want only the shared one", list, err)
+	}
+
+	thread := postThread{&fakeThread{chatID: "chat"}}
+	s := NewChat(thread, bobsResume{}, apps, nil, nil, nil, nil, nil, WithTemplates(templates, postTitles{"post": "住院醫師"}))
+
+	msg, err := s.SendTemplate(ctx, "com.yoku.apen", "alice", "chat", shared.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "王小明 您好，感謝應徵住院醫師，方便於星期一 09:00-12:00致電嗎？"; msg.Body == nil || *msg.Body != want {
+		t.Errorf("body = %v, want %q", msg.Body, want)
+	}
+	if _, err := s.SendTemplate(ctx, "com.yoku.apen", "bob", "chat", own.ID); err != models.ErrorNotFound {
+		t.Errorf("sending alice's template as bob: err = %v, want %v", err, models.ErrorNotFound)
+	}
+
+	// without post titles the shared template cannot be filled in
+	s = NewChat(thread, bobsResume{}, apps, nil, nil, nil, nil, nil, WithTemplates(templates, nil))
+	_, err = s.SendTemplate(ctx, "com.yoku.apen", "alice", "chat", shared.ID)
+	var missing *models.TemplateVarsMissingError
+	if !errors.As(err, &missing) || len(missing.Vars) != 1 || missing.Vars[0] != models.TemplateVarPostTitle {
+		t.Errorf("err = %v, want post_title missing", err)
+	}
+	if len(thread.msgs) != 1 {
+		t.Errorf("sent %d messages, want 1", len(thread.msgs))
+	}
+
+	// a purged resume leaves its variables unfilled rather than failing
+	s = NewChat(thread, purgedResume{}, apps, nil, nil, nil, nil, nil, WithTemplates(templates, postTitles{"post": "住院醫師"}))
+	_, err = s.SendTemplate(ctx, "com.yoku.apen", "alice", "chat", shared.ID)
+	if !errors.As(err, &missing) || len(missing.Vars) != 2 {
+		t.Errorf("err = %v, want real_name and contact_times missing", err)
+	}
+
+	if err := tm.Delete(ctx, "com.yoku.apen", &alice, own.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.SendTemplate(ctx, "com.yoku.apen", "alice", "chat", own.ID); err != models.ErrorNotFound {
+		t.Errorf("sending a deleted template: err = %v, want %v", err, models.ErrorNotFound)
+	}
+}
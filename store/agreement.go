@@ -17,15 +17,32 @@ func NewAgreement(db *sqlx.DB) Agreement {
 	return &agreementStore{db: db}
 }
 
-func (as *agreementStore) Agree(ctx context.Context, appID, userID, version string) error {
+// Agree records a consent to version of docType together with its
+// evidence.
+func (as *agreementStore) Agree(ctx context.Context, appID, userID string, docType models.DocumentType, version string, evidence *models.ConsentEvidence) error {
+	if evidence == nil {
+		evidence = &models.ConsentEvidence{}
+	}
 	query := `
 	INSERT INTO public.agreement (
 		app_id,
 		user_id,
+		document_type,
 		version_agreed,
+		action,
+		ip,
+		user_agent,
+		locale,
+		document_hash,
 		agreed_at
 	)
 	VALUES (
+		?,
+		?,
+		?,
+		?,
+		?,
+		?,
 		?,
 		?,
 		?,
@@ -34,51 +51,266 @@ func (as *agreementStore) Agree(ctx context.Context, appID, userID, version stri
 	`
 
 	query = as.db.Rebind(query)
-	_, err := as.db.Exec(query,
+	_, err := as.db.ExecContext(ctx, query,
 		appID,
 		userID,
+		docType,
 		version,
+		models.ConsentAgree,
+		evidence.IP,
+		evidence.UserAgent,
+		evidence.Locale,
+		evidence.DocumentHash,
 		// now()
 	)
 	if err != nil {
-		logging.Errorw(ctx, "insert new agreement record failed", "err", err, "user_id", userID, "version", version)
+		logging.Errorw(ctx, "insert new agreement record failed", "err", err, "user_id", userID, "document_type", docType, "version", version)
 		return err
 	}
 	return nil
 }
 
-func (as *agreementStore) Get(ctx context.Context, appID, userID string) (*models.AgreementRecord, error) {
-
-	r := models.AgreementRecord{}
+// Revoke records the withdrawal of the user's consent to docType. It returns
+// models.ErrorNotFound when the user has no consent in effect.
+func (as *agreementStore) Revoke(ctx context.Context, appID, userID string, docType models.DocumentType, evidence *models.ConsentEvidence) error {
+	if evidence == nil {
+		evidence = &models.ConsentEvidence{}
+	}
+	query := `
+	INSERT INTO public.agreement (
+		app_id,
+		user_id,
+		document_type,
+		version_agreed,
+		action,
+		ip,
+		user_agent,
+		locale,
+		document_hash,
+		agreed_at
+	)
+	SELECT app_id, user_id, document_type, version_agreed, ?, ?, ?, ?, document_hash, now()
+	FROM (
+		SELECT *
+		FROM public.agreement
+		WHERE app_id=? AND user_id=? AND document_type=?
+		ORDER BY agreed_at DESC
+		LIMIT 1
+	) latest
+	WHERE latest.action=?
+	`
+	query = as.db.Rebind(query)
+	result, err := as.db.ExecContext(ctx, query,
+		models.ConsentWithdraw,
+		evidence.IP,
+		evidence.UserAgent,
+		evidence.Locale,
+		appID,
+		userID,
+		docType,
+		models.ConsentAgree,
+	)
+	if err != nil {
+		logging.Errorw(ctx, "insert agreement withdrawal failed", "err", err, "app_id", appID, "user_id", userID, "document_type", docType)
+		return err
+	}
+	if n, err := result.RowsAffected(); err != nil {
+		logging.Errorw(ctx, "get affected rows failed", "err", err)
+		return err
+	} else if n == 0 {
+		return models.ErrorNotFound
+	}
+	return nil
+}
 
+// History returns every consent event of the user, oldest first.
+func (as *agreementStore) History(ctx context.Context, appID, userID string) ([]*models.ConsentEvent, error) {
 	query := `
-	SELECT eula FROM public.version WHERE id=1
+	SELECT
+		document_type,
+		version_agreed,
+		action,
+		agreed_at,
+		ip,
+		user_agent,
+		locale,
+		document_hash
+	FROM public.agreement
+	WHERE app_id=? AND user_id=?
+	ORDER BY agreed_at ASC
 	`
+	query = as.db.Rebind(query)
 
-	if err := as.db.QueryRowx(query).StructScan(&r); err != nil {
-		logging.Errorw(ctx, "get latest eula version failed", "err", err)
+	events := []*models.ConsentEvent{}
+	if err := as.db.SelectContext(ctx, &events, query, appID, userID); err != nil {
+		logging.Errorw(ctx, "list consent history failed", "err", err, "app_id", appID, "user_id", userID)
 		return nil, err
 	}
+	return events, nil
+}
 
-	query = `
+// Get returns the user's latest agreement to docType against the version in
+// force; a withdrawn agreement leaves VersionAgreed nil. It returns sql.ErrNoRows when the app has no such document.
+func (as *agreementStore) Get(ctx context.Context, appID, userID string, docType models.DocumentType) (*models.AgreementRecord, error) {
+	docs, err := as.LatestDocuments(ctx, appID)
+	if err != nil {
+		return nil, err
+	}
+	var latest *models.AgreementDocument
+	for _, doc := range docs {
+		if doc.Type == docType {
+			latest = doc
+		}
+	}
+	if latest == nil {
+		return nil, sql.ErrNoRows
+	}
+
+	r := models.AgreementRecord{
+		DocumentType:  docType,
+		VersionLatest: latest.Version,
+		Latest:        latest,
+	}
+
+	query := `
 	SELECT
 		version_agreed,
 		agreed_at
-	FROM public.agreement
-	WHERE app_id=? AND user_id=?
-	ORDER BY agreed_at DESC
-	LIMIT 1
+	FROM (
+		SELECT version_agreed, agreed_at, action
+		FROM public.agreement
+		WHERE app_id=? AND user_id=? AND document_type=?
+		ORDER BY agreed_at DESC
+		LIMIT 1
+	) latest
+	WHERE action=?
 	`
 	query = as.db.Rebind(query)
-	if err := as.db.QueryRowx(query, appID, userID).StructScan(&r); err != nil {
+	if err := as.db.QueryRowxContext(ctx, query, appID, userID, docType, models.ConsentAgree).StructScan(&r); err != nil {
 		if err == sql.ErrNoRows {
 			r.VersionAgreed = nil
 			r.AgreedAt = nil
 			return &r, nil
 		}
-		logging.Errorw(ctx, "get user agreement record failed", "err", err, "app_id", appID, "user_id", userID)
+		logging.Errorw(ctx, "get user agreement record failed", "err", err, "app_id", appID, "user_id", userID, "document_type", docType)
 		return nil, err
 	}
 
 	return &r, nil
 }
+
+// ListAgreed returns the user's latest agreement per document type, leaving
+// out withdrawn ones.
+func (as *agreementStore) ListAgreed(ctx context.Context, appID, userID string) (map[models.DocumentType]*models.AgreementRecord, error) {
+	query := `
+	SELECT
+		document_type,
+		version_agreed,
+		agreed_at
+	FROM (
+		SELECT DISTINCT ON (document_type)
+			document_type,
+			version_agreed,
+			agreed_at,
+			action
+		FROM public.agreement
+		WHERE app_id=? AND user_id=?
+		ORDER BY document_type, agreed_at DESC
+	) latest
+	WHERE action=?
+	`
+	query = as.db.Rebind(query)
+
+	records := []*models.AgreementRecord{}
+	if err := as.db.SelectContext(ctx, &records, query, appID, userID, models.ConsentAgree); err != nil {
+		logging.Errorw(ctx, "list user agreement records failed", "err", err, "app_id", appID, "user_id", userID)
+		return nil, err
+	}
+	agreed := make(map[models.DocumentType]*models.AgreementRecord, len(records))
+	for _, r := range records {
+		agreed[r.DocumentType] = r
+	}
+	return agreed, nil
+}
+
+// LatestDocuments returns the version in force of every document type the
+// app has published. Without published terms, the global EULA version in
+// public.version stands in for DocumentTerms.
+func (as *agreementStore) LatestDocuments(ctx context.Context, appID string) ([]*models.AgreementDocument, error) {
+	query := `
+	SELECT DISTINCT ON (type)
+		app_id,
+		type,
+		version,
+		effective_at,
+		urls,
+		hash
+	FROM public.agreement_document
+	WHERE app_id=? AND effective_at<=now()
+	ORDER BY type, effective_at DESC
+	`
+	query = as.db.Rebind(query)
+
+	docs := []*models.AgreementDocument{}
+	if err := as.db.SelectContext(ctx, &docs, query, appID); err != nil {
+		logging.Errorw(ctx, "list latest agreement documents failed", "err", err, "app_id", appID)
+		return nil, err
+	}
+	for _, doc := range docs {
+		if doc.Type == models.DocumentTerms {
+			return docs, nil
+		}
+	}
+
+	versionLatest := ""
+	query = `
+	SELECT eula AS version_latest FROM public.version WHERE id=1
+	`
+	if err := as.db.QueryRowxContext(ctx, query).Scan(&versionLatest); err != nil {
+		if err == sql.ErrNoRows {
+			return docs, nil
+		}
+		logging.Errorw(ctx, "get latest eula version failed", "err", err)
+		return nil, err
+	}
+	return append(docs, &models.AgreementDocument{
+		AppID:   appID,
+		Type:    models.DocumentTerms,
+		Version: versionLatest,
+	}), nil
+}
+
+// PublishDocument adds a document version, or updates the effective date,
+// URLs and hash of one that was already published.
+func (as *agreementStore) PublishDocument(ctx context.Context, doc *models.AgreementDocument) error {
+	query := `
+	INSERT INTO public.agreement_document (
+		app_id,
+		type,
+		version,
+		effective_at,
+		urls,
+		hash,
+		created_at
+	)
+	VALUES (?, ?, ?, ?, ?, ?, now())
+	ON CONFLICT (app_id, type, version)
+	DO UPDATE SET
+		effective_at = EXCLUDED.effective_at,
+		urls = EXCLUDED.urls,
+		hash = EXCLUDED.hash
+	`
+	query = as.db.Rebind(query)
+	if _, err := as.db.ExecContext(ctx, query,
+		doc.AppID,
+		doc.Type,
+		doc.Version,
+		doc.EffectiveAt,
+		doc.URLs,
+		doc.Hash,
+	); err != nil {
+		logging.Errorw(ctx, "publish agreement document failed", "err", err, "app_id", doc.AppID, "type", doc.Type, "version", doc.Version)
+		return err
+	}
+	return nil
+}
@@ -2,6 +2,8 @@ package store
 
 import (
 	"context"
+	"sync"
+	"time"
 
 	"github.com/A-pen-app/hire-sdk/models"
 	"github.com/A-pen-app/logging"
@@ -20,9 +22,11 @@ func NewApp(db *sqlx.DB) App {
 func (a *appStore) GetByBundleID(ctx context.Context, bundleID string) (*models.App, error) {
 	var app models.App
 	query := `
-	SELECT id, name, bundle_id
-	FROM public.app
-	WHERE bundle_id = ?
+	SELECT A.id, A.name, A.bundle_id, AC.config
+	FROM public.app AS A
+	LEFT JOIN public.app_config AS AC
+	ON AC.app_id=A.id
+	WHERE A.bundle_id = ?
 	`
 	query = a.db.Rebind(query)
 
@@ -34,3 +38,94 @@ func (a *appStore) GetByBundleID(ctx context.Context, bundleID string) (*models.
 
 	return &app, nil
 }
+
+// appCacheSize bounds how many bundle IDs the app cache holds. When it is
+// full, expired entries are dropped first, then the ones expiring soonest.
+const appCacheSize = 1024
+
+type cachedAppEntry struct {
+	app       models.App
+	expiresAt time.Time
+}
+
+type cachedApp struct {
+	a   App
+	ttl time.Duration
+	now func() time.Time
+
+	mu      sync.RWMutex
+	entries map[string]cachedAppEntry
+}
+
+// NewCachedApp wraps a store.App so every bundle ID is resolved at most once
+// per ttl. Failed lookups are never cached. Every caller gets its own copy
+// of the app and its config. Call Invalidate after changing an
+// app or its config so the next lookup sees the change.
+func NewCachedApp(a App, ttl time.Duration) AppCache {
+	return &cachedApp{
+		a:       a,
+		ttl:     ttl,
+		now:     time.Now,
+		entries: map[string]cachedAppEntry{},
+	}
+}
+
+func (c *cachedApp) GetByBundleID(ctx context.Context, bundleID string) (*models.App, error) {
+	now := c.now()
+
+	c.mu.RLock()
+	entry, ok := c.entries[bundleID]
+	c.mu.RUnlock()
+	if ok && now.Before(entry.expiresAt) {
+		return copyApp(&entry.app), nil
+	}
+
+	app, err := c.a.GetByBundleID(ctx, bundleID)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	if _, ok := c.entries[bundleID]; !ok && len(c.entries) >= appCacheSize {
+		c.evict(now)
+	}
+	c.entries[bundleID] = cachedAppEntry{app: *copyApp(app), expiresAt: now.Add(c.ttl)}
+	c.mu.Unlock()
+
+	return app, nil
+}
+
+// evict makes room for one more entry. c.mu must be held.
+func (c *cachedApp) evict(now time.Time) {
+	soonest := ""
+	for bundleID, entry := range c.entries {
+		if !now.Before(entry.expiresAt) {
+			delete(c.entries, bundleID)
+		} else if soonest == "" || entry.expiresAt.Before(c.entries[soonest].expiresAt) {
+			soonest = bundleID
+		}
+	}
+	if len(c.entries) >= appCacheSize {
+		delete(c.entries, soonest)
+	}
+}
+
+// copyApp returns a copy of app that shares nothing with it, so callers
+// can't change what the cache holds.
+func copyApp(app *models.App) *models.App {
+	cp := *app
+	cp.Config = app.Config.Clone()
+	return &cp
+}
+
+func (c *cachedApp) Invalidate(bundleID string) {
+	c.mu.Lock()
+	delete(c.entries, bundleID)
+	c.mu.Unlock()
+}
+
+func (c *cachedApp) InvalidateAll() {
+	c.mu.Lock()
+	c.entries = map[string]cachedAppEntry{}
+	c.mu.Unlock()
+}
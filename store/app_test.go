@@ -0,0 +1,77 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/A-pen-app/hire-sdk/models"
+)
+
+// countingApps is a store.App that counts its lookups.
+type countingApps struct {
+	lookups int
+}
+
+func (f *countingApps) GetByBundleID(ctx context.Context, bundleID string) (*models.App, error) {
+	f.lookups++
+	maxLen := 100
+	return &models.App{ID: "app-" + bundleID, BundleID: bundleID, Config: &models.AppConfig{
+		MaxMessageLength:    &maxLen,
+		AllowedMessageTypes: []models.MessageType{models.MsgText},
+	}}, nil
+}
+
+func TestCachedAppReturnsCopies(t *testing.T) {
+	ctx := context.Background()
+	apps := &countingApps{}
+	c := NewCachedApp(apps, time.Minute)
+
+	first, err := c.GetByBundleID(ctx, "com.yoku.apen")
+	if err != nil {
+		t.Fatal(err)
+	}
+	*first.Config.MaxMessageLength = 1
+	first.Config.AllowedMessageTypes[0] = models.MsgImage
+
+	second, err := c.GetByBundleID(ctx, "com.yoku.apen")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if apps.lookups != 1 {
+		t.Errorf("%d lookups, want 1", apps.lookups)
+	}
+	if *second.Config.MaxMessageLength != 100 || second.Config.AllowedMessageTypes[0] != models.MsgText {
+		t.Errorf("a caller's change reached the cache: %+v", second.Config)
+	}
+}
+
+func TestCachedAppIsBounded(t *testing.T) {
+	ctx := context.Background()
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	c := NewCachedApp(&countingApps{}, time.Minute).(*cachedApp)
+
+	for i := 0; i < appCacheSize; i++ {
+		c.now = func() time.Time { return start.Add(time.Duration(i) * time.Millisecond) }
+		if _, err := c.GetByBundleID(ctx, fmt.Sprint(i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// the oldest entry makes room for a new one
+	if _, err := c.GetByBundleID(ctx, "new"); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := c.entries["0"]; ok || len(c.entries) != appCacheSize {
+		t.Errorf("%d entries, first one kept: %v; want %d without it", len(c.entries), ok, appCacheSize)
+	}
+
+	// once they have expired, all of them go at once
+	c.now = func() time.Time { return start.Add(time.Hour) }
+	if _, err := c.GetByBundleID(ctx, "newer"); err != nil {
+		t.Fatal(err)
+	}
+	if len(c.entries) != 1 {
+		t.Errorf("%d entries after expiry, want 1", len(c.entries))
+	}
+}
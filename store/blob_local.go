@@ -0,0 +1,180 @@
+package store
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/A-pen-app/hire-sdk/models"
+	"github.com/A-pen-app/logging"
+)
+
+type localBlob struct {
+	dir     string
+	baseURL string
+	secret  []byte
+}
+
+// NewLocalBlob returns a Blob that keeps objects under dir. Its signed URLs
+// point at baseURL, where NewLocalBlobHandler with the same dir and secret
+// must be mounted to serve them.
+func NewLocalBlob(dir, baseURL string, secret []byte) Blob {
+	return &localBlob{
+		dir:     dir,
+		baseURL: strings.TrimRight(baseURL, "/"),
+		secret:  secret,
+	}
+}
+
+// validBlobKey rejects keys that are empty, absolute or escape the root.
+func validBlobKey(key string) bool {
+	return key != "" && !strings.HasPrefix(key, "/") && path.Clean(key) == key && !strings.HasPrefix(key, "../") && key != ".."
+}
+
+func (b *localBlob) path(key string) (string, error) {
+	if !validBlobKey(key) {
+		return "", models.ErrorWrongParams
+	}
+	return filepath.Join(b.dir, filepath.FromSlash(key)), nil
+}
+
+func (b *localBlob) Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) error {
+	p, err := b.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+		logging.Errorw(ctx, "create blob directory failed", "err", err, "key", key)
+		return err
+	}
+
+	// write to a temporary file first so readers never see a partial object
+	tmp, err := os.CreateTemp(filepath.Dir(p), ".upload-*")
+	if err != nil {
+		logging.Errorw(ctx, "create blob failed", "err", err, "key", key)
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := io.Copy(tmp, r); err != nil {
+		tmp.Close()
+		logging.Errorw(ctx, "write blob failed", "err", err, "key", key)
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		logging.Errorw(ctx, "write blob failed", "err", err, "key", key)
+		return err
+	}
+	if err := os.Rename(tmp.Name(), p); err != nil {
+		logging.Errorw(ctx, "move blob failed", "err", err, "key", key)
+		return err
+	}
+	return nil
+}
+
+func (b *localBlob) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	p, err := b.path(key)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(p)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, models.ErrorNotFound
+	} else if err != nil {
+		logging.Errorw(ctx, "open blob failed", "err", err, "key", key)
+		return nil, err
+	}
+	return f, nil
+}
+
+func (b *localBlob) Stat(ctx context.Context, key string) (int64, error) {
+	p, err := b.path(key)
+	if err != nil {
+		return 0, err
+	}
+	info, err := os.Stat(p)
+	if errors.Is(err, fs.ErrNotExist) {
+		return 0, models.ErrorNotFound
+	} else if err != nil {
+		logging.Errorw(ctx, "stat blob failed", "err", err, "key", key)
+		return 0, err
+	}
+	return info.Size(), nil
+}
+
+func (b *localBlob) Delete(ctx context.Context, key string) error {
+	p, err := b.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(p); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		logging.Errorw(ctx, "delete blob failed", "err", err, "key", key)
+		return err
+	}
+	return nil
+}
+
+func (b *localBlob) SignedURL(ctx context.Context, method, key string, ttl time.Duration) (string, error) {
+	if !validBlobKey(key) || (method != http.MethodGet && method != http.MethodPut) {
+		return "", models.ErrorWrongParams
+	}
+	expires := strconv.FormatInt(time.Now().Add(ttl).Unix(), 10)
+	q := url.Values{}
+	q.Set("method", method)
+	q.Set("expires", expires)
+	q.Set("signature", localBlobSignature(b.secret, method, key, expires))
+	return b.baseURL + "/" + key + "?" + q.Encode(), nil
+}
+
+func localBlobSignature(secret []byte, method, key, expires string) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(method + "\n" + key + "\n" + expires))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// NewLocalBlobHandler serves the signed URLs of a NewLocalBlob with the same
+// dir and secret. Mount it with http.StripPrefix so request paths are the
+// object keys. maxSize bounds PUT bodies.
+func NewLocalBlobHandler(dir string, secret []byte, maxSize int64) http.Handler {
+	b := &localBlob{dir: dir, secret: secret}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := strings.TrimPrefix(r.URL.Path, "/")
+		q := r.URL.Query()
+		expires, err := strconv.ParseInt(q.Get("expires"), 10, 64)
+		if err != nil || q.Get("method") != r.Method || !validBlobKey(key) ||
+			!hmac.Equal([]byte(q.Get("signature")), []byte(localBlobSignature(secret, r.Method, key, q.Get("expires")))) {
+			http.Error(w, "invalid signature", http.StatusForbidden)
+			return
+		}
+		if time.Now().Unix() > expires {
+			http.Error(w, "url expired", http.StatusForbidden)
+			return
+		}
+
+		switch r.Method {
+		case http.MethodGet:
+			p, _ := b.path(key)
+			http.ServeFile(w, r, p)
+		case http.MethodPut:
+			body := http.MaxBytesReader(w, r.Body, maxSize)
+			if err := b.Put(r.Context(), key, body, r.ContentLength, r.Header.Get("Content-Type")); err != nil {
+				http.Error(w, "upload failed", http.StatusBadRequest)
+				return
+			}
+			w.WriteHeader(http.StatusCreated)
+		default:
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		}
+	})
+}
@@ -0,0 +1,247 @@
+package store
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/A-pen-app/hire-sdk/models"
+	"github.com/A-pen-app/logging"
+)
+
+// S3BlobConfig configures a Blob on an S3-compatible service (AWS S3,
+// MinIO, GCS interoperability, R2, ...).
+type S3BlobConfig struct {
+	// Endpoint is the service URL without the bucket, e.g.
+	// https://s3.ap-northeast-1.amazonaws.com or http://localhost:9000.
+	Endpoint        string
+	Region          string
+	Bucket          string
+	AccessKeyID     string
+	SecretAccessKey string
+
+	// PathStyle addresses objects as {endpoint}/{bucket}/{key} instead of
+	// {bucket}.{endpoint host}/{key}. Most self-hosted services need it.
+	PathStyle bool
+
+	// Client defaults to http.DefaultClient; Now defaults to time.Now.
+	Client *http.Client
+	Now    func() time.Time
+}
+
+type s3Blob struct {
+	cfg      S3BlobConfig
+	endpoint *url.URL
+}
+
+// NewS3Blob returns a Blob backed by an S3-compatible bucket. Requests are
+// authenticated with AWS Signature Version 4 presigned URLs, so the same
+// signer serves both the SDK's own requests and SignedURL.
+func NewS3Blob(cfg S3BlobConfig) (Blob, error) {
+	endpoint, err := url.Parse(cfg.Endpoint)
+	if err != nil || endpoint.Host == "" {
+		return nil, models.ErrorWrongParams
+	}
+	if cfg.Client == nil {
+		cfg.Client = http.DefaultClient
+	}
+	if cfg.Now == nil {
+		cfg.Now = time.Now
+	}
+	return &s3Blob{cfg: cfg, endpoint: endpoint}, nil
+}
+
+// s3RequestTTL bounds how long a presigned URL the SDK uses itself stays valid.
+const s3RequestTTL = 15 * time.Minute
+
+func (b *s3Blob) do(ctx context.Context, method, key string, body io.Reader, size int64, contentType string) (*http.Response, error) {
+	signed, err := b.SignedURL(ctx, method, key, s3RequestTTL)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, method, signed, body)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.ContentLength = size
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	return b.cfg.Client.Do(req)
+}
+
+// s3Error turns a non-2xx response into an error, mapping 404 to
+// models.ErrorNotFound.
+func s3Error(resp *http.Response) error {
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return nil
+	}
+	if resp.StatusCode == http.StatusNotFound {
+		return models.ErrorNotFound
+	}
+	msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+	return fmt.Errorf("s3: %s: %s", resp.Status, strings.TrimSpace(string(msg)))
+}
+
+func (b *s3Blob) Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) error {
+	if size < 0 {
+		// S3 doesn't accept chunked uploads without a length
+		return models.ErrorWrongParams
+	}
+	resp, err := b.do(ctx, http.MethodPut, key, r, size, contentType)
+	if err != nil {
+		logging.Errorw(ctx, "put blob failed", "err", err, "key", key)
+		return err
+	}
+	defer resp.Body.Close()
+	if err := s3Error(resp); err != nil {
+		logging.Errorw(ctx, "put blob failed", "err", err, "key", key)
+		return err
+	}
+	return nil
+}
+
+func (b *s3Blob) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	resp, err := b.do(ctx, http.MethodGet, key, nil, 0, "")
+	if err != nil {
+		logging.Errorw(ctx, "get blob failed", "err", err, "key", key)
+		return nil, err
+	}
+	if err := s3Error(resp); err != nil {
+		resp.Body.Close()
+		if err != models.ErrorNotFound {
+			logging.Errorw(ctx, "get blob failed", "err", err, "key", key)
+		}
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+func (b *s3Blob) Stat(ctx context.Context, key string) (int64, error) {
+	resp, err := b.do(ctx, http.MethodHead, key, nil, 0, "")
+	if err != nil {
+		logging.Errorw(ctx, "stat blob failed", "err", err, "key", key)
+		return 0, err
+	}
+	defer resp.Body.Close()
+	if err := s3Error(resp); err != nil {
+		if err != models.ErrorNotFound {
+			logging.Errorw(ctx, "stat blob failed", "err", err, "key", key)
+		}
+		return 0, err
+	}
+	return resp.ContentLength, nil
+}
+
+func (b *s3Blob) Delete(ctx context.Context, key string) error {
+	resp, err := b.do(ctx, http.MethodDelete, key, nil, 0, "")
+	if err != nil {
+		logging.Errorw(ctx, "delete blob failed", "err", err, "key", key)
+		return err
+	}
+	defer resp.Body.Close()
+	if err := s3Error(resp); err != nil && err != models.ErrorNotFound {
+		logging.Errorw(ctx, "delete blob failed", "err", err, "key", key)
+		return err
+	}
+	return nil
+}
+
+// SignedURL presigns method on key with AWS Signature Version 4 (query
+// string authentication, UNSIGNED-PAYLOAD).
+func (b *s3Blob) SignedURL(ctx context.Context, method, key string, ttl time.Duration) (string, error) {
+	if !validBlobKey(key) {
+		return "", models.ErrorWrongParams
+	}
+	now := b.cfg.Now().UTC()
+	date := now.Format("20060102")
+	scope := date + "/" + b.cfg.Region + "/s3/aws4_request"
+
+	host := b.endpoint.Host
+	uri := strings.TrimRight(b.endpoint.Path, "/")
+	if b.cfg.PathStyle {
+		uri += "/" + s3Escape(b.cfg.Bucket, false)
+	} else {
+		host = b.cfg.Bucket + "." + host
+	}
+	uri += "/" + s3Escape(key, false)
+
+	query := map[string]string{
+		"X-Amz-Algorithm":     "AWS4-HMAC-SHA256",
+		"X-Amz-Credential":    b.cfg.AccessKeyID + "/" + scope,
+		"X-Amz-Date":          now.Format("20060102T150405Z"),
+		"X-Amz-Expires":       strconv.Itoa(int(ttl / time.Second)),
+		"X-Amz-SignedHeaders": "host",
+	}
+	names := make([]string, 0, len(query))
+	for name := range query {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	pairs := make([]string, len(names))
+	for i, name := range names {
+		pairs[i] = s3Escape(name, true) + "=" + s3Escape(query[name], true)
+	}
+	canonicalQuery := strings.Join(pairs, "&")
+
+	canonicalRequest := strings.Join([]string{
+		method,
+		uri,
+		canonicalQuery,
+		"host:" + host,
+		"",
+		"host",
+		"UNSIGNED-PAYLOAD",
+	}, "\n")
+	hashed := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := strings.Join([]string{
+		"AWS4-HMAC-SHA256",
+		query["X-Amz-Date"],
+		scope,
+		hex.EncodeToString(hashed[:]),
+	}, "\n")
+
+	signingKey := hmacSHA256([]byte("AWS4"+b.cfg.SecretAccessKey), date)
+	signingKey = hmacSHA256(signingKey, b.cfg.Region)
+	signingKey = hmacSHA256(signingKey, "s3")
+	signingKey = hmacSHA256(signingKey, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(signingKey, stringToSign))
+
+	return b.endpoint.Scheme + "://" + host + uri + "?" + canonicalQuery + "&X-Amz-Signature=" + signature, nil
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// s3Escape percent-encodes s the way SigV4 canonicalizes it: everything but
+// unreserved characters, and '/' too unless it separates path segments.
+func s3Escape(s string, encodeSlash bool) string {
+	var sb strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case 'A' <= c && c <= 'Z', 'a' <= c && c <= 'z', '0' <= c && c <= '9',
+			c == '-', c == '_', c == '.', c == '~':
+			sb.WriteByte(c)
+		case c == '/' && !encodeSlash:
+			sb.WriteByte(c)
+		default:
+			fmt.Fprintf(&sb, "%%%02X", c)
+		}
+	}
+	return sb.String()
+}
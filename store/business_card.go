@@ -200,6 +200,33 @@ func (s *businessCard) ListSnapshots(ctx context.Context, snapshotIDs []string)
 	return snapshots, nil
 }
 
+// ListUserSnapshots returns every snapshot of the user's business card,
+// including those taken before the user saved a card, which are only tied to
+// the user through the business card messages they sent. Oldest first.
+func (s *businessCard) ListUserSnapshots(ctx context.Context, appID, userID string) ([]*models.BusinessCardSnapshot, error) {
+	query := `
+	SELECT id, business_card_id, content, created_at
+	FROM public.business_card_snapshot
+	WHERE business_card_id IN (
+		SELECT id FROM public.business_card WHERE app_id = ? AND user_id = ?
+	) OR id IN (
+		SELECT M.reference_id
+		FROM public.message M
+		JOIN public.chat C ON M.chat_id = C.id
+		WHERE C.app_id = ? AND M.sender_id = ? AND M.type = ?
+	)
+	ORDER BY created_at ASC
+	`
+	query = s.db.Rebind(query)
+
+	snapshots := []*models.BusinessCardSnapshot{}
+	if err := s.db.SelectContext(ctx, &snapshots, query, appID, userID, appID, userID, models.MsgBusinessCard); err != nil {
+		logging.Errorw(ctx, "failed to list user business card snapshots", "err", err, "appID", appID, "userID", userID)
+		return nil, err
+	}
+	return snapshots, nil
+}
+
 func (s *businessCard) GetSnapshotOwners(ctx context.Context, snapshotIDs []string) (map[string]string, error) {
 	if len(snapshotIDs) == 0 {
 		return map[string]string{}, nil
@@ -3,7 +3,6 @@ package store
 import (
 	"context"
 	"database/sql"
-	"strconv"
 	"strings"
 	"time"
 
@@ -62,11 +61,14 @@ func (s *chatStore) Get(ctx context.Context, appID, chatID, userID string) (*mod
 
 }
 
-func (s *chatStore) Read(ctx context.Context, userID, chatID string) error {
+// Read marks the chat as read by the user up to now, which it returns. The
+// time is kept as last_seen_at on the other party's thread, so their own
+// messages can be shown as read.
+func (s *chatStore) Read(ctx context.Context, userID, chatID string) (time.Time, error) {
 	tx, err := s.db.BeginTx(ctx, nil)
 	if err != nil {
 		logging.Errorw(ctx, "begin tx failed", "err", err)
-		return err
+		return time.Time{}, err
 	}
 	defer tx.Rollback()
 
@@ -75,11 +77,13 @@ func (s *chatStore) Read(ctx context.Context, userID, chatID string) error {
 	UPDATE public.chat_thread
 	SET last_seen_at=now()
 	WHERE chat_id=? AND receiver_id=?
+	RETURNING last_seen_at
 	`
 	query = s.db.Rebind(query)
-	if _, err := tx.Exec(query, chatID, userID); err != nil {
+	var readAt time.Time
+	if err := tx.QueryRow(query, chatID, userID).Scan(&readAt); err != nil {
 		logging.Errorw(ctx, "read chat thread failed", "err", err, "chatID", chatID, "userID", userID)
-		return err
+		return time.Time{}, err
 	}
 
 	// step 2: update unread count in sender chat thread
@@ -95,15 +99,15 @@ func (s *chatStore) Read(ctx context.Context, userID, chatID string) error {
 	unreadCountInChat := 0
 	if err := tx.QueryRow(query, chatID, userID, chatID, userID).Scan(&unreadCountInChat); err != nil {
 		logging.Errorw(ctx, "update unread_count failed", "err", err, "chatID", chatID, "userID", userID)
-		return err
+		return time.Time{}, err
 	}
 
 	if err := tx.Commit(); err != nil {
 		logging.Errorw(ctx, "commit tx failed", "err", err)
-		return err
+		return time.Time{}, err
 	}
 
-	return nil
+	return readAt, nil
 }
 
 func (s *chatStore) Annotate(ctx context.Context, chatID, userID string, status models.ChatAnnotation) error {
@@ -136,12 +140,10 @@ func (s *chatStore) Pin(ctx context.Context, chatID, userID string, isPinned boo
 	return nil
 }
 
-func (s *chatStore) GetChats(ctx context.Context, appID, userID string, next string, count int, status models.ChatAnnotation, unreadOnly bool, isOfficialRole bool) ([]*models.ChatRoom, error) {
+// GetChats returns up to count of the user's chats after the cursor (nil for
+// the first page), pinned ones first, then by latest activity.
+func (s *chatStore) GetChats(ctx context.Context, appID, userID string, after *models.ChatCursor, count int, status models.ChatAnnotation, unreadOnly bool, isOfficialRole bool) ([]*models.ChatRoom, error) {
 	chats := []*models.ChatRoom{}
-	if next == "" {
-		// +2 seconds to prevent the last chat is created at almost the same time with getting chats
-		next = strconv.FormatInt(time.Now().Unix()+2, 10)
-	}
 	query := `
 	SELECT
 		CT.chat_id,
@@ -167,15 +169,17 @@ func (s *chatStore) GetChats(ctx context.Context, appID, userID string, next str
 	conditions := []string{
 		"C.app_id=?",
 		"CT.sender_id=?",
-		"C.updated_at<TO_TIMESTAMP(?)",
 		"CT.status!=?",
 	}
 	values := []interface{}{
 		appID,
 		userID,
-		next,
 		models.Deleted,
 	}
+	if after != nil {
+		conditions = append(conditions, "(CT.is_pinned<? OR (CT.is_pinned=? AND (C.updated_at, C.id)<(?, ?)))")
+		values = append(values, after.IsPinned, after.IsPinned, after.UpdatedAt, after.ID)
+	}
 
 	if isOfficialRole {
 		conditions = append(conditions, "((C.post_id IS NULL AND CT.control_flag = ?) OR (C.post_id IS NOT NULL AND CT.control_flag IN (?, ?)))")
@@ -192,7 +196,7 @@ func (s *chatStore) GetChats(ctx context.Context, appID, userID string, next str
 		conditions = append(conditions, "CT.unread_count>0")
 	}
 
-	query = query + strings.Join(conditions, " AND ") + " ORDER BY CT.is_pinned DESC, C.updated_at DESC LIMIT ?"
+	query = query + strings.Join(conditions, " AND ") + " ORDER BY CT.is_pinned DESC, C.updated_at DESC, C.id DESC LIMIT ?"
 	values = append(values, count)
 
 	query = s.db.Rebind(query)
@@ -203,6 +207,64 @@ func (s *chatStore) GetChats(ctx context.Context, appID, userID string, next str
 	return chats, nil
 }
 
+// HasChats reports whether the user has a chat in the app they can see,
+// like GetChats does for official roles, without listing any.
+func (s *chatStore) HasChats(ctx context.Context, appID, userID string) (bool, error) {
+	query := `
+	SELECT EXISTS (
+		SELECT 1
+		FROM public.chat_thread AS CT
+		JOIN public.chat AS C
+		ON CT.chat_id=C.id
+		WHERE C.app_id=? AND CT.sender_id=? AND CT.status!=?
+		AND ((C.post_id IS NULL AND CT.control_flag = ?) OR (C.post_id IS NOT NULL AND CT.control_flag IN (?, ?)))
+	)
+	`
+	query = s.db.Rebind(query)
+	exists := false
+	if err := s.db.QueryRowxContext(ctx, query, appID, userID, models.Deleted, models.Pass, models.Pass, models.NeverGotMessages).Scan(&exists); err != nil {
+		logging.Errorw(ctx, "check user chats failed", "err", err, "appID", appID, "userID", userID)
+		return false, err
+	}
+	return exists, nil
+}
+
+// ListUserThreads returns every chat thread of the user, including deleted
+// and hidden ones, oldest first.
+func (s *chatStore) ListUserThreads(ctx context.Context, appID, userID string) ([]*models.ChatRoom, error) {
+	chats := []*models.ChatRoom{}
+	query := `
+	SELECT
+		CT.chat_id,
+		CT.sender_id,
+		CT.receiver_id,
+		C.app_id,
+		C.last_message_id,
+		CT.unread_count,
+		CT.last_seen_at,
+		C.updated_at,
+		CT.status,
+		CT.control_flag,
+		C.created_at,
+		C.post_id,
+		CT.is_pinned,
+		C.business_card_snapshot_id,
+		C.access_status,
+		CT.hire_contact
+	FROM public.chat_thread AS CT
+	JOIN public.chat AS C
+	ON CT.chat_id=C.id
+	WHERE C.app_id=? AND CT.sender_id=?
+	ORDER BY C.created_at ASC
+	`
+	query = s.db.Rebind(query)
+	if err := s.db.SelectContext(ctx, &chats, query, appID, userID); err != nil {
+		logging.Errorw(ctx, "list user chat threads failed", "err", err, "appID", appID, "userID", userID)
+		return nil, err
+	}
+	return chats, nil
+}
+
 func (s *chatStore) GetChatID(ctx context.Context, appID, senderID, receiverID string, postID *string, opts ...models.GetChatIDOptionFunc) (string, bool, error) {
 	opt := models.GetChatIDOption{}
 	for _, f := range opts {
@@ -245,6 +307,9 @@ func (s *chatStore) GetChatID(ctx context.Context, appID, senderID, receiverID s
 		chatID = uuid.New().String()
 
 		accessStatus := models.AccessStatusLocked
+		if opt.DefaultAccessStatus != nil {
+			accessStatus = *opt.DefaultAccessStatus
+		}
 		if opt.AccessStatus != nil {
 			accessStatus = *opt.AccessStatus
 		}
@@ -409,15 +474,30 @@ func (s *chatStore) AddMessages(ctx context.Context, userID, chatID, receiverID
 }
 
 func (s *chatStore) AddMessage(ctx context.Context, userID, chatID, receiverID string, typ models.MessageType, body *string, mediaIDs []string, replyToMessageID *string, referenceID *string) (string, error) {
+	msgID := uuid.New().String()
+	if _, err := s.addMessage(ctx, msgID, false, userID, chatID, receiverID, typ, body, mediaIDs, replyToMessageID, referenceID); err != nil {
+		return "", err
+	}
+	return msgID, nil
+}
+
+// AddMessageOnce adds the message under the given ID unless a message with
+// that ID already exists, in which case nothing changes and false is
+// returned. Callers that may retry a send derive messageID from what they
+// are sending, so the retry cannot deliver it twice.
+func (s *chatStore) AddMessageOnce(ctx context.Context, messageID, userID, chatID, receiverID string, typ models.MessageType, body *string, mediaIDs []string, replyToMessageID *string) (bool, error) {
+	return s.addMessage(ctx, messageID, true, userID, chatID, receiverID, typ, body, mediaIDs, replyToMessageID, nil)
+}
+
+func (s *chatStore) addMessage(ctx context.Context, msgID string, once bool, userID, chatID, receiverID string, typ models.MessageType, body *string, mediaIDs []string, replyToMessageID *string, referenceID *string) (bool, error) {
 	tx, err := s.db.BeginTx(ctx, nil)
 	if err != nil {
 		logging.Errorw(ctx, "begin tx failed", "err", err)
-		return "", err
+		return false, err
 	}
 	defer tx.Rollback()
 
 	// step 1: add new message
-	msgID := uuid.New().String()
 	query := `
 	INSERT INTO public.message (
 		id,
@@ -443,8 +523,11 @@ func (s *chatStore) AddMessage(ctx context.Context, userID, chatID, receiverID s
 		?,
 		?
 	)`
+	if once {
+		query += ` ON CONFLICT (id) DO NOTHING`
+	}
 	query = s.db.Rebind(query)
-	_, err = tx.Exec(query,
+	res, err := tx.Exec(query,
 		msgID,
 		typ,
 		body,
@@ -458,7 +541,13 @@ func (s *chatStore) AddMessage(ctx context.Context, userID, chatID, receiverID s
 	)
 	if err != nil {
 		logging.Errorw(ctx, "insert new message failed", "err", err, "chat_id", chatID)
-		return "", err
+		return false, err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return false, err
+	} else if n == 0 {
+		// already added
+		return false, nil
 	}
 
 	// step 2: update my chat table
@@ -471,7 +560,7 @@ func (s *chatStore) AddMessage(ctx context.Context, userID, chatID, receiverID s
 	_, err = tx.Exec(query, msgID, chatID)
 	if err != nil {
 		logging.Errorw(ctx, "update last message failed", "err", err, "chat_id", chatID)
-		return "", err
+		return false, err
 	}
 
 	// step 3: update other's chat thread
@@ -484,14 +573,14 @@ func (s *chatStore) AddMessage(ctx context.Context, userID, chatID, receiverID s
 	_, err = tx.Exec(query, models.NeverGotMessages, chatID, receiverID)
 	if err != nil {
 		logging.Errorw(ctx, "update unread_count failed", "err", err, "chat_id", chatID, "receiver_id", receiverID)
-		return "", err
+		return false, err
 	}
 
 	if err := tx.Commit(); err != nil {
 		logging.Errorw(ctx, "commit tx failed", "err", err)
-		return "", err
+		return false, err
 	}
-	return msgID, nil
+	return true, nil
 }
 
 func (s *chatStore) EditMessage(ctx context.Context, messageID string, newStatus models.MessageStatus) error {
@@ -506,6 +595,75 @@ func (s *chatStore) EditMessage(ctx context.Context, messageID string, newStatus
 	return nil
 }
 
+// AddReaction reacts to the message as the user. Reacting again with the
+// same emoji changes nothing.
+func (s *chatStore) AddReaction(ctx context.Context, messageID, userID, emoji string) error {
+	query := `
+	INSERT INTO public.message_reaction (message_id, user_id, emoji, created_at)
+	VALUES (?, ?, ?, now())
+	ON CONFLICT (message_id, user_id, emoji) DO NOTHING
+	`
+	query = s.db.Rebind(query)
+	if _, err := s.db.ExecContext(ctx, query, messageID, userID, emoji); err != nil {
+		logging.Errorw(ctx, "add reaction failed", "err", err, "messageID", messageID, "userID", userID)
+		return err
+	}
+	return nil
+}
+
+// RemoveReaction takes the user's reaction back, if they reacted so.
+func (s *chatStore) RemoveReaction(ctx context.Context, messageID, userID, emoji string) error {
+	query := `
+	DELETE FROM public.message_reaction
+	WHERE message_id=? AND user_id=? AND emoji=?
+	`
+	query = s.db.Rebind(query)
+	if _, err := s.db.ExecContext(ctx, query, messageID, userID, emoji); err != nil {
+		logging.Errorw(ctx, "remove reaction failed", "err", err, "messageID", messageID, "userID", userID)
+		return err
+	}
+	return nil
+}
+
+// GetReactions returns the reactions to the messages keyed by message ID,
+// each in the order its emoji was first used, with Mine set on userID's.
+func (s *chatStore) GetReactions(ctx context.Context, messageIDs []string, userID string) (map[string][]*models.Reaction, error) {
+	reactions := map[string][]*models.Reaction{}
+	if len(messageIDs) == 0 {
+		return reactions, nil
+	}
+
+	query := `
+	SELECT
+		message_id,
+		emoji,
+		COUNT(*) AS count,
+		BOOL_OR(user_id=?) AS mine
+	FROM public.message_reaction
+	WHERE message_id = ANY(?)
+	GROUP BY message_id, emoji
+	ORDER BY message_id, MIN(created_at), emoji
+	`
+	query = s.db.Rebind(query)
+	rows, err := s.db.QueryxContext(ctx, query, userID, pq.Array(messageIDs))
+	if err != nil {
+		logging.Errorw(ctx, "get reactions failed", "err", err, "messageIDs", messageIDs)
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var messageID string
+		reaction := models.Reaction{}
+		if err := rows.Scan(&messageID, &reaction.Emoji, &reaction.Count, &reaction.Mine); err != nil {
+			logging.Errorw(ctx, "scan reaction failed", "err", err)
+			return nil, err
+		}
+		reactions[messageID] = append(reactions[messageID], &reaction)
+	}
+	return reactions, rows.Err()
+}
+
 func (s *chatStore) GetMessage(ctx context.Context, messageID string) (*models.Message, error) {
 	msg := models.Message{}
 	query := `
@@ -541,6 +699,63 @@ func (s *chatStore) GetMessage(ctx context.Context, messageID string) (*models.M
 	return &msg, nil
 }
 
+// GetMessagesByIDs returns the messages with the given IDs in no particular
+// order. IDs that match no message are skipped.
+func (s *chatStore) GetMessagesByIDs(ctx context.Context, messageIDs []string) ([]*models.Message, error) {
+	if len(messageIDs) == 0 {
+		return []*models.Message{}, nil
+	}
+
+	query := `
+	SELECT
+		id,
+		type,
+		body,
+		chat_id,
+		sender_id,
+		created_at,
+		reply_to_message_id,
+		status,
+		media_ids,
+		reference_id
+	FROM public.message
+	WHERE id = ANY(?)
+	`
+	query = s.db.Rebind(query)
+	rows, err := s.db.QueryxContext(ctx, query, pq.Array(messageIDs))
+	if err != nil {
+		logging.Errorw(ctx, "get messages by IDs failed", "err", err, "messageIDs", messageIDs)
+		return nil, err
+	}
+	defer rows.Close()
+
+	msgs := []*models.Message{}
+	for rows.Next() {
+		msg := models.Message{}
+		if err := rows.Scan(
+			&msg.ID,
+			&msg.Type,
+			&msg.Body,
+			&msg.ChatID,
+			&msg.SenderID,
+			&msg.CreatedAt,
+			&msg.ReplyToMessageID,
+			&msg.Status,
+			pq.Array(&msg.MediaIDs), // workaround for postgres array type
+			&msg.RefID,
+		); err != nil {
+			logging.Errorw(ctx, "scan message failed", "err", err)
+			return nil, err
+		}
+		msgs = append(msgs, &msg)
+	}
+	if err := rows.Err(); err != nil {
+		logging.Errorw(ctx, "get messages by IDs failed", "err", err, "messageIDs", messageIDs)
+		return nil, err
+	}
+	return msgs, nil
+}
+
 func (s *chatStore) GetNewMessages(ctx context.Context, chatID string, after time.Time) ([]*models.Message, error) {
 
 	query := `
@@ -587,20 +802,20 @@ func (s *chatStore) GetNewMessages(ctx context.Context, chatID string, after tim
 			&msg.RefID,
 		); err != nil {
 			logging.Errorw(ctx, "scan message failed", "err", err, "chatID", chatID)
-			continue
+			return nil, err
 		}
 		msgs = append(msgs, &msg)
 	}
-
+	if err := rows.Err(); err != nil {
+		logging.Errorw(ctx, "get new messages failed", "err", err, "chatID", chatID)
+		return nil, err
+	}
 	return msgs, nil
 }
 
-func (s *chatStore) GetMessages(ctx context.Context, chatID string, next string, count int) ([]*models.Message, error) {
-
-	if next == "" {
-		// +2 seconds to prevent the last message is created at almost the same time with getting messages
-		next = strconv.FormatInt(time.Now().Unix()+2, 10)
-	}
+// GetMessages returns up to count messages of the chat before the cursor
+// (nil for the latest), newest first.
+func (s *chatStore) GetMessages(ctx context.Context, chatID string, before *models.MessageCursor, count int) ([]*models.Message, error) {
 	query := `
 	SELECT
 		id,
@@ -614,15 +829,17 @@ func (s *chatStore) GetMessages(ctx context.Context, chatID string, next string,
 		media_ids,
 		reference_id
 	FROM public.message
-	WHERE chat_id=? AND created_at<TO_TIMESTAMP(?)
-	ORDER BY created_at DESC
-	LIMIT ?
-	`
+	WHERE chat_id=?`
 	values := []interface{}{
 		chatID,
-		next,
-		count,
 	}
+	if before != nil {
+		query += " AND (created_at, id)<(?, ?)"
+		values = append(values, before.CreatedAt, before.ID)
+	}
+	query += " ORDER BY created_at DESC, id DESC LIMIT ?"
+	values = append(values, count)
+
 	query = s.db.Rebind(query)
 	rows, err := s.db.Queryx(query, values...)
 	if err != nil {
@@ -647,11 +864,130 @@ func (s *chatStore) GetMessages(ctx context.Context, chatID string, next string,
 			&msg.RefID,
 		); err != nil {
 			logging.Errorw(ctx, "scan message failed", "err", err, "chatID", chatID)
-			continue
+			return nil, err
+		}
+		msgs = append(msgs, &msg)
+	}
+	if err := rows.Err(); err != nil {
+		logging.Errorw(ctx, "get messages failed", "err", err, "chatID", chatID)
+		return nil, err
+	}
+	return msgs, nil
+}
+
+// GetMessagesAfter returns up to count messages of the chat after the
+// cursor, oldest first.
+func (s *chatStore) GetMessagesAfter(ctx context.Context, chatID string, after *models.MessageCursor, count int) ([]*models.Message, error) {
+	query := `
+	SELECT
+		id,
+		type,
+		body,
+		chat_id,
+		sender_id,
+		created_at,
+		reply_to_message_id,
+		status,
+		media_ids,
+		reference_id
+	FROM public.message
+	WHERE chat_id=? AND (created_at, id)>(?, ?)
+	ORDER BY created_at ASC, id ASC
+	LIMIT ?
+	`
+	query = s.db.Rebind(query)
+	rows, err := s.db.QueryxContext(ctx, query, chatID, after.CreatedAt, after.ID, count)
+	if err != nil {
+		logging.Errorw(ctx, "get messages after cursor failed", "err", err, "chatID", chatID)
+		return nil, err
+	}
+	defer rows.Close()
+
+	msgs := []*models.Message{}
+	for rows.Next() {
+		msg := models.Message{}
+		if err := rows.Scan(
+			&msg.ID,
+			&msg.Type,
+			&msg.Body,
+			&msg.ChatID,
+			&msg.SenderID,
+			&msg.CreatedAt,
+			&msg.ReplyToMessageID,
+			&msg.Status,
+			pq.Array(&msg.MediaIDs), // workaround for postgres array type
+			&msg.RefID,
+		); err != nil {
+			logging.Errorw(ctx, "scan message failed", "err", err, "chatID", chatID)
+			return nil, err
 		}
 		msgs = append(msgs, &msg)
 	}
+	if err := rows.Err(); err != nil {
+		logging.Errorw(ctx, "get messages after failed", "err", err, "chatID", chatID)
+		return nil, err
+	}
+	return msgs, nil
+}
+
+// ListSentMessages returns up to count messages the user sent in the app's
+// chats, oldest first, after the cursor (nil for the first page).
+func (s *chatStore) ListSentMessages(ctx context.Context, appID, userID string, after *models.MessageCursor, count int) ([]*models.Message, error) {
+	query := `
+	SELECT
+		M.id,
+		M.type,
+		M.body,
+		M.chat_id,
+		M.sender_id,
+		M.created_at,
+		M.reply_to_message_id,
+		M.status,
+		M.media_ids,
+		M.reference_id
+	FROM public.message M
+	JOIN public.chat C ON M.chat_id=C.id
+	WHERE C.app_id=? AND M.sender_id=?`
+	values := []interface{}{appID, userID}
+	if after != nil {
+		query += " AND (M.created_at, M.id)>(?, ?)"
+		values = append(values, after.CreatedAt, after.ID)
+	}
+	query += " ORDER BY M.created_at ASC, M.id ASC LIMIT ?"
+	values = append(values, count)
+
+	query = s.db.Rebind(query)
+	rows, err := s.db.QueryxContext(ctx, query, values...)
+	if err != nil {
+		logging.Errorw(ctx, "list sent messages failed", "err", err, "appID", appID, "userID", userID)
+		return nil, err
+	}
+	defer rows.Close()
 
+	msgs := []*models.Message{}
+	for rows.Next() {
+		msg := models.Message{}
+		if err := rows.Scan(
+			&msg.ID,
+			&msg.Type,
+			&msg.Body,
+			&msg.ChatID,
+			&msg.SenderID,
+			&msg.CreatedAt,
+			&msg.ReplyToMessageID,
+			&msg.Status,
+			pq.Array(&msg.MediaIDs), // workaround for postgres array type
+			&msg.RefID,
+		); err != nil {
+			logging.Errorw(ctx, "scan message failed", "err", err, "appID", appID, "userID", userID)
+			return nil, err
+		}
+		msgs = append(msgs, &msg)
+	}
+	if err := rows.Err(); err != nil {
+		logging.Errorw(ctx, "list sent messages failed", "err", err, "appID", appID, "userID", userID)
+		return nil, err
+	}
 	return msgs, nil
 }
 
@@ -847,3 +1183,57 @@ func (s *chatStore) GetBusinessCardChatInfos(ctx context.Context, chatIDs []stri
 	}
 	return m, nil
 }
+
+// unlockChat sets chatID and its resume relation to UNLOCKED within tx,
+// calling spend first if the chat is still LOCKED; an error from spend
+// aborts the unlock. The chat row is locked first, so concurrent unlocks of
+// the same chat serialize and only the first one spends. It returns whether
+// spend was called.
+func unlockChat(ctx context.Context, tx *sqlx.Tx, appID, chatID string, spend func() error) (bool, error) {
+	// step 1: lock the chat row
+	query := `
+	SELECT access_status FROM public.chat
+	WHERE id=? AND app_id=?
+	FOR UPDATE
+	`
+	query = tx.Rebind(query)
+	var status models.AccessStatus
+	if err := tx.QueryRowxContext(ctx, query, chatID, appID).Scan(&status); err != nil {
+		logging.Errorw(ctx, "lock chat failed", "err", err, "chat_id", chatID, "app_id", appID)
+		return false, err
+	}
+
+	spent := false
+	if status != models.AccessStatusUnlocked {
+		// step 2: pay for the unlock
+		if err := spend(); err != nil {
+			return false, err
+		}
+
+		// step 3: unlock the chat
+		query = `
+		UPDATE public.chat SET access_status=?
+		WHERE id=?
+		`
+		query = tx.Rebind(query)
+		if _, err := tx.ExecContext(ctx, query, models.AccessStatusUnlocked, chatID); err != nil {
+			logging.Errorw(ctx, "update access status failed", "err", err, "chat_id", chatID)
+			return false, err
+		}
+		spent = true
+	}
+
+	// step 4: unlock the resume relation; also repairs a relation left LOCKED
+	// on a chat that was unlocked some other way
+	query = `
+	UPDATE public.resume_relation
+	SET status=?, updated_at=now()
+	WHERE chat_id=? AND status!=?
+	`
+	query = tx.Rebind(query)
+	if _, err := tx.ExecContext(ctx, query, models.ResumeStatusUnlocked, chatID, models.ResumeStatusUnlocked); err != nil {
+		logging.Errorw(ctx, "update resume relation status failed", "err", err, "chat_id", chatID)
+		return false, err
+	}
+	return spent, nil
+}
@@ -0,0 +1,61 @@
+package store
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/A-pen-app/hire-sdk/models"
+	"github.com/google/uuid"
+)
+
+// messageDDL creates the message columns the chat queries read, on top of
+// whatever other tests created.
+var messageDDL = []string{
+	`CREATE TABLE IF NOT EXISTS public.chat (id uuid PRIMARY KEY)`,
+	`ALTER TABLE public.chat ADD COLUMN IF NOT EXISTS app_id text`,
+	`CREATE TABLE IF NOT EXISTS public.message (id uuid PRIMARY KEY)`,
+	`ALTER TABLE public.message
+		ADD COLUMN IF NOT EXISTS type int,
+		ADD COLUMN IF NOT EXISTS body text,
+		ADD COLUMN IF NOT EXISTS chat_id uuid,
+		ADD COLUMN IF NOT EXISTS sender_id text,
+		ADD COLUMN IF NOT EXISTS created_at timestamptz NOT NULL DEFAULT now(),
+		ADD COLUMN IF NOT EXISTS reply_to_message_id uuid,
+		ADD COLUMN IF NOT EXISTS status int NOT NULL DEFAULT 0,
+		ADD COLUMN IF NOT EXISTS media_ids uuid[] NOT NULL DEFAULT '{}',
+		ADD COLUMN IF NOT EXISTS reference_id text`,
+}
+
+func TestListSentMessagesPages(t *testing.T) {
+	db := testDB(t, messageDDL...)
+	ctx := context.Background()
+	appID, userID, chatID := uuid.New().String(), uuid.New().String(), uuid.New().String()
+	if _, err := db.Exec(`INSERT INTO public.chat (id, app_id) VALUES ($1, $2)`, chatID, appID); err != nil {
+		t.Fatal(err)
+	}
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i := 0; i < 3; i++ {
+		if _, err := db.Exec(`INSERT INTO public.message (id, type, chat_id, sender_id, created_at) VALUES ($1, $2, $3, $4, $5)`,
+			uuid.New().String(), models.MsgText, chatID, userID, start.Add(time.Duration(i)*time.Second)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	s := NewChat(db)
+	first, err := s.ListSentMessages(ctx, appID, userID, nil, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(first) != 2 || !first[0].CreatedAt.Equal(start) {
+		t.Fatalf("first page = %d messages, want the 2 oldest", len(first))
+	}
+	last := first[len(first)-1]
+	second, err := s.ListSentMessages(ctx, appID, userID, &models.MessageCursor{CreatedAt: last.CreatedAt, ID: last.ID}, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(second) != 1 || !second[0].CreatedAt.Equal(start.Add(2*time.Second)) {
+		t.Errorf("second page = %d messages, want the newest", len(second))
+	}
+}
@@ -0,0 +1,32 @@
+package store
+
+import (
+	"os"
+	"testing"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// testDB connects to the Postgres database named by HIRE_SDK_TEST_DATABASE_URL
+// and runs ddl in it, skipping the test when the variable is unset. Point it
+// at a disposable database: the tests create the tables they need there in
+// the minimal form they need, and only rely on the rows they insert.
+func testDB(t *testing.T, ddl ...string) *sqlx.DB {
+	t.Helper()
+	url := os.Getenv("HIRE_SDK_TEST_DATABASE_URL")
+	if url == "" {
+		t.Skip("HIRE_SDK_TEST_DATABASE_URL is not set")
+	}
+	db, err := sqlx.Connect("postgres", url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	for _, stmt := range ddl {
+		if _, err := db.Exec(stmt); err != nil {
+			t.Fatalf("%s: %v", stmt, err)
+		}
+	}
+	return db
+}
@@ -2,11 +2,13 @@ package store
 
 import (
 	"context"
+	"time"
 
 	"github.com/A-pen-app/hire-sdk/models"
 	"github.com/A-pen-app/logging"
 	"github.com/google/uuid"
 	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
 )
 
 type mediaStore struct {
@@ -19,10 +21,12 @@ func NewMedia(db *sqlx.DB) Media {
 	}
 }
 
-func (m *mediaStore) Get(ctx context.Context, mediaIDs []string) ([]*models.Media, error) {
+// Get returns the media for mediaIDs in input order with a single query.
+// IDs without a row are returned in missing instead of being dropped.
+func (m *mediaStore) Get(ctx context.Context, mediaIDs []string) ([]*models.Media, []string, error) {
 	medias := []*models.Media{}
 	if len(mediaIDs) == 0 {
-		return medias, nil
+		return medias, nil, nil
 	}
 	query := `
 	SELECT 
@@ -34,21 +38,40 @@ func (m *mediaStore) Get(ctx context.Context, mediaIDs []string) ([]*models.Medi
 		redirect_url, 
 		title, 
 		size, 
-		expired_at 
-	FROM public.media WHERE id=?`
+		expired_at,
+		created_at,
+		storage_key,
+		owner_id,
+		content_type,
+		size_bytes,
+		width,
+		height
+	FROM public.media WHERE id = ANY(?)`
 	query = m.db.Rebind(query)
+
+	rows := []*models.Media{}
+	if err := m.db.SelectContext(ctx, &rows, query, pq.Array(mediaIDs)); err != nil {
+		logging.Errorw(ctx, "db query media failed", "err", err, "media_ids", mediaIDs)
+		return nil, nil, err
+	}
+	byID := make(map[string]*models.Media, len(rows))
+	for _, media := range rows {
+		byID[media.ID] = media
+	}
+
+	var missing []string
 	for _, mediaID := range mediaIDs {
-		media := models.Media{}
-		if err := m.db.QueryRowx(query, mediaID).StructScan(&media); err != nil {
-			logging.Errorw(ctx, "db query media failed", "err", err, "media_id", mediaID)
-			continue
+		if media, ok := byID[mediaID]; ok {
+			medias = append(medias, media)
+		} else {
+			missing = append(missing, mediaID)
 		}
-		medias = append(medias, &media)
-
 	}
-	return medias, nil
+	return medias, missing, nil
 }
 
+// New creates a media row and returns its ID. Media in the blob store is
+// created once per storage key: a retry returns the row already created.
 func (m *mediaStore) New(ctx context.Context, upload *models.MediaUpload) (string, error) {
 	if upload == nil {
 		logging.Errorw(ctx, "upload parameter is nil")
@@ -66,7 +89,14 @@ func (m *mediaStore) New(ctx context.Context, upload *models.MediaUpload) (strin
 		redirect_url,
 		title,
 		size,
-		expired_at
+		expired_at,
+		storage_key,
+		owner_id,
+		content_type,
+		size_bytes,
+		width,
+		height,
+		created_at
 	)
 	VALUES (
 		?,
@@ -77,11 +107,21 @@ func (m *mediaStore) New(ctx context.Context, upload *models.MediaUpload) (strin
 		?,
 		?,
 		?,
-		?
+		?,
+		?,
+		?,
+		?,
+		?,
+		?,
+		?,
+		now()
 	)
+	ON CONFLICT (storage_key) WHERE storage_key IS NOT NULL
+	DO UPDATE SET storage_key=EXCLUDED.storage_key
+	RETURNING id
 	`
 	query = m.db.Rebind(query)
-	if _, err := m.db.Exec(query,
+	if err := m.db.QueryRowxContext(ctx, query,
 		mediaID,
 		upload.URL,
 		upload.Placeholder,
@@ -91,9 +131,130 @@ func (m *mediaStore) New(ctx context.Context, upload *models.MediaUpload) (strin
 		upload.Title,
 		upload.Size,
 		upload.ExpiredAt,
-	); err != nil {
+		upload.StorageKey,
+		upload.OwnerID,
+		upload.ContentType,
+		upload.SizeBytes,
+		upload.Width,
+		upload.Height,
+	).Scan(&mediaID); err != nil {
 		logging.Errorw(ctx, "insert new media failed", "err", err, "url", upload.URL, "preview_url", upload.PreviewURL, "media_type", upload.MediaType, "redirect_url", upload.RedirectURL, "title", upload.Title, "size", upload.Size, "expired_at", upload.ExpiredAt)
 		return "", err
 	}
 	return mediaID, nil
 }
+
+// Expire sets the expiry of mediaIDs to at and returns how many rows were
+// updated.
+func (m *mediaStore) Expire(ctx context.Context, mediaIDs []string, at time.Time) (int, error) {
+	if len(mediaIDs) == 0 {
+		return 0, nil
+	}
+	query := `
+	UPDATE public.media SET expired_at=?
+	WHERE id = ANY(?)
+	`
+	query = m.db.Rebind(query)
+	res, err := m.db.ExecContext(ctx, query, at, pq.Array(mediaIDs))
+	if err != nil {
+		logging.Errorw(ctx, "expire media failed", "err", err, "media_ids", mediaIDs, "at", at)
+		return 0, err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		logging.Errorw(ctx, "get expired media count failed", "err", err)
+		return 0, err
+	}
+	return int(n), nil
+}
+
+// ListExpired returns up to limit media that expired at or before `before`,
+// oldest expiry first, e.g. so the caller can remove the stored objects.
+func (m *mediaStore) ListExpired(ctx context.Context, before time.Time, limit int) ([]*models.Media, error) {
+	query := `
+	SELECT 
+		id, 
+		url, 
+		placeholder, 
+		type, 
+		preview_url, 
+		redirect_url, 
+		title, 
+		size, 
+		expired_at,
+		created_at,
+		storage_key,
+		owner_id,
+		content_type,
+		size_bytes,
+		width,
+		height
+	FROM public.media
+	WHERE expired_at <= ?
+	ORDER BY expired_at
+	LIMIT ?
+	`
+	query = m.db.Rebind(query)
+
+	medias := []*models.Media{}
+	if err := m.db.SelectContext(ctx, &medias, query, before, limit); err != nil {
+		logging.Errorw(ctx, "list expired media failed", "err", err, "before", before)
+		return nil, err
+	}
+	return medias, nil
+}
+
+// DeleteOrphaned deletes up to limit media created before createdBefore
+// that neither a message nor a scheduled message still to be sent references
+// through media_ids, and returns them, so the caller can remove the stored
+// objects of those with a storage key. createdBefore is the grace period
+// for media that was uploaded but whose message hasn't been sent yet; it
+// should be well in the past. The containment checks rely on GIN indexes
+// on both media_ids columns.
+func (m *mediaStore) DeleteOrphaned(ctx context.Context, createdBefore time.Time, limit int) ([]*models.Media, error) {
+	query := `
+	DELETE FROM public.media
+	WHERE id IN (
+		SELECT M.id
+		FROM public.media AS M
+		WHERE M.created_at < ?
+		AND NOT EXISTS (
+			SELECT 1 FROM public.message AS MSG
+			WHERE MSG.media_ids @> ARRAY[M.id]
+		)
+		AND NOT EXISTS (
+			SELECT 1 FROM public.scheduled_message AS SM
+			WHERE SM.media_ids @> ARRAY[M.id] AND SM.status = ANY(?)
+		)
+		LIMIT ?
+		FOR UPDATE SKIP LOCKED
+	)
+	RETURNING
+		id,
+		url,
+		placeholder,
+		type,
+		preview_url,
+		redirect_url,
+		title,
+		size,
+		expired_at,
+		created_at,
+		storage_key,
+		owner_id,
+		content_type,
+		size_bytes,
+		width,
+		height
+	`
+	query = m.db.Rebind(query)
+
+	// failed ones are never sent, sent ones are covered by their message
+	scheduled := []string{string(models.ScheduledPending), string(models.ScheduledSending)}
+	deleted := []*models.Media{}
+	if err := m.db.SelectContext(ctx, &deleted, query, createdBefore, pq.Array(scheduled), limit); err != nil {
+		logging.Errorw(ctx, "delete orphaned media failed", "err", err, "created_before", createdBefore)
+		return nil, err
+	}
+	return deleted, nil
+}
@@ -0,0 +1,115 @@
+package store
+
+import (
+	"context"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/A-pen-app/hire-sdk/models"
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+// mediaDDL creates the media columns the media queries read, on top of
+// whatever other tests created.
+var mediaDDL = []string{
+	`CREATE TABLE IF NOT EXISTS public.media (id uuid PRIMARY KEY, created_at timestamptz NOT NULL DEFAULT now())`,
+	`ALTER TABLE public.media
+		ADD COLUMN IF NOT EXISTS url text,
+		ADD COLUMN IF NOT EXISTS placeholder text,
+		ADD COLUMN IF NOT EXISTS type int,
+		ADD COLUMN IF NOT EXISTS preview_url text,
+		ADD COLUMN IF NOT EXISTS redirect_url text,
+		ADD COLUMN IF NOT EXISTS title text,
+		ADD COLUMN IF NOT EXISTS size text,
+		ADD COLUMN IF NOT EXISTS expired_at timestamptz,
+		ADD COLUMN IF NOT EXISTS storage_key text,
+		ADD COLUMN IF NOT EXISTS owner_id text,
+		ADD COLUMN IF NOT EXISTS content_type text,
+		ADD COLUMN IF NOT EXISTS size_bytes bigint,
+		ADD COLUMN IF NOT EXISTS width int,
+		ADD COLUMN IF NOT EXISTS height int`,
+	`CREATE UNIQUE INDEX IF NOT EXISTS media_storage_key ON public.media (storage_key) WHERE storage_key IS NOT NULL`,
+}
+
+func TestNewMediaOncePerStorageKey(t *testing.T) {
+	db := testDB(t, mediaDDL...)
+	ctx := context.Background()
+	s := NewMedia(db)
+	key := "app/alice/" + uuid.New().String() + ".jpg"
+
+	first, err := s.New(ctx, &models.MediaUpload{MediaType: models.Image, StorageKey: &key})
+	if err != nil {
+		t.Fatal(err)
+	}
+	retried, err := s.New(ctx, &models.MediaUpload{MediaType: models.Image, StorageKey: &key})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if retried != first {
+		t.Errorf("retry created %s, want %s again", retried, first)
+	}
+
+	// media without a key, like a plain URL, is never deduplicated
+	url := "https://example.com/a.jpg"
+	a, err := s.New(ctx, &models.MediaUpload{MediaType: models.Image, URL: url})
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := s.New(ctx, &models.MediaUpload{MediaType: models.Image, URL: url})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a == b {
+		t.Errorf("media without a storage key shared ID %s", a)
+	}
+}
+
+func TestDeleteOrphanedKeepsScheduledMedia(t *testing.T) {
+	db := testDB(t, append(mediaDDL,
+		`CREATE TABLE IF NOT EXISTS public.message (id uuid PRIMARY KEY, media_ids uuid[] NOT NULL DEFAULT '{}')`,
+		`CREATE TABLE IF NOT EXISTS public.scheduled_message (id uuid PRIMARY KEY, media_ids uuid[] NOT NULL DEFAULT '{}', status text NOT NULL)`,
+	)...)
+	ctx := context.Background()
+	// older than anything other tests insert, so only these are candidates
+	createdAt := time.Date(2001, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	media := map[string]string{}
+	for _, name := range []string{"orphan", "sent", "pending", "sending", "canceled"} {
+		media[name] = uuid.New().String()
+		if _, err := db.Exec(`INSERT INTO public.media (id, created_at, storage_key) VALUES ($1, $2, $3)`, media[name], createdAt, "app/alice/"+media[name]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := db.Exec(`INSERT INTO public.message (id, media_ids) VALUES ($1, $2)`, uuid.New().String(), pq.Array([]string{media["sent"]})); err != nil {
+		t.Fatal(err)
+	}
+	for name, status := range map[string]models.ScheduledMessageStatus{
+		"pending":  models.ScheduledPending,
+		"sending":  models.ScheduledSending,
+		"canceled": models.ScheduledCanceled,
+	} {
+		if _, err := db.Exec(`INSERT INTO public.scheduled_message (id, media_ids, status) VALUES ($1, $2, $3)`, uuid.New().String(), pq.Array([]string{media[name]}), status); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	orphans, err := NewMedia(db).DeleteOrphaned(ctx, createdAt.Add(time.Second), 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	deleted := []string{}
+	for _, orphan := range orphans {
+		if orphan.StorageKey == nil || *orphan.StorageKey != "app/alice/"+orphan.ID {
+			t.Errorf("orphan %s has storage key %v, want its object's", orphan.ID, orphan.StorageKey)
+		}
+		deleted = append(deleted, orphan.ID)
+	}
+	want := []string{media["orphan"], media["canceled"]}
+	sort.Strings(deleted)
+	sort.Strings(want)
+	if len(deleted) != len(want) || deleted[0] != want[0] || deleted[1] != want[1] {
+		t.Errorf("deleted = %v, want the orphan and the canceled message's media %v", deleted, want)
+	}
+}
@@ -0,0 +1,193 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/A-pen-app/hire-sdk/models"
+	"github.com/A-pen-app/logging"
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+)
+
+type planStore struct {
+	db *sqlx.DB
+}
+
+// NewPlan returns an implementation of store.Plan
+func NewPlan(db *sqlx.DB) Plan {
+	return &planStore{db: db}
+}
+
+const planColumns = `id, app_id, name, entitlements, product_ids, created_at, updated_at`
+
+func scanPlan(row interface{ Scan(...interface{}) error }) (*models.Plan, error) {
+	plan := models.Plan{}
+	if err := row.Scan(
+		&plan.ID,
+		&plan.AppID,
+		&plan.Name,
+		&plan.Entitlements,
+		pq.Array(&plan.ProductIDs), // workaround for postgres array type
+		&plan.CreatedAt,
+		&plan.UpdatedAt,
+	); err != nil {
+		return nil, err
+	}
+	return &plan, nil
+}
+
+func (s *planStore) Get(ctx context.Context, appID, planID string) (*models.Plan, error) {
+	query := `
+	SELECT ` + planColumns + `
+	FROM public.subscription_plan
+	WHERE app_id=? AND id=?
+	`
+	query = s.db.Rebind(query)
+	plan, err := scanPlan(s.db.QueryRowxContext(ctx, query, appID, planID))
+	if err != nil {
+		if err != sql.ErrNoRows {
+			logging.Errorw(ctx, "get plan failed", "err", err, "app_id", appID, "plan_id", planID)
+		}
+		return nil, err
+	}
+	return plan, nil
+}
+
+func (s *planStore) GetByProductID(ctx context.Context, appID, productID string) (*models.Plan, error) {
+	query := `
+	SELECT ` + planColumns + `
+	FROM public.subscription_plan
+	WHERE app_id=? AND ?=ANY(product_ids)
+	LIMIT 1
+	`
+	query = s.db.Rebind(query)
+	plan, err := scanPlan(s.db.QueryRowxContext(ctx, query, appID, productID))
+	if err != nil {
+		if err != sql.ErrNoRows {
+			logging.Errorw(ctx, "get plan by product id failed", "err", err, "app_id", appID, "product_id", productID)
+		}
+		return nil, err
+	}
+	return plan, nil
+}
+
+func (s *planStore) List(ctx context.Context, appID string) ([]*models.Plan, error) {
+	query := `
+	SELECT ` + planColumns + `
+	FROM public.subscription_plan
+	WHERE app_id=?
+	ORDER BY created_at
+	`
+	query = s.db.Rebind(query)
+	rows, err := s.db.QueryxContext(ctx, query, appID)
+	if err != nil {
+		logging.Errorw(ctx, "list plans failed", "err", err, "app_id", appID)
+		return nil, err
+	}
+	defer rows.Close()
+
+	plans := []*models.Plan{}
+	for rows.Next() {
+		plan, err := scanPlan(rows)
+		if err != nil {
+			logging.Errorw(ctx, "scan plan failed", "err", err, "app_id", appID)
+			return nil, err
+		}
+		plans = append(plans, plan)
+	}
+	return plans, rows.Err()
+}
+
+// Upsert creates the plan, or replaces its name, entitlements and product
+// IDs when plan.ID already exists. An empty plan.ID gets a new one.
+func (s *planStore) Upsert(ctx context.Context, plan *models.Plan) (string, error) {
+	if plan.ID == "" {
+		plan.ID = uuid.New().String()
+	}
+	query := `
+	INSERT INTO public.subscription_plan (id, app_id, name, entitlements, product_ids, created_at, updated_at)
+	VALUES (?, ?, ?, ?, ?, now(), now())
+	ON CONFLICT (id)
+	DO UPDATE SET
+		name = EXCLUDED.name,
+		entitlements = EXCLUDED.entitlements,
+		product_ids = EXCLUDED.product_ids,
+		updated_at = now()
+	`
+	query = s.db.Rebind(query)
+	if _, err := s.db.ExecContext(ctx, query,
+		plan.ID,
+		plan.AppID,
+		plan.Name,
+		plan.Entitlements,
+		pq.Array(plan.ProductIDs),
+	); err != nil {
+		logging.Errorw(ctx, "upsert plan failed", "err", err, "app_id", plan.AppID, "plan_id", plan.ID)
+		return "", err
+	}
+	return plan.ID, nil
+}
+
+func (s *planStore) Usage(ctx context.Context, appID, userID string, e models.Entitlement, period string) (int, error) {
+	query := `
+	SELECT used FROM public.entitlement_usage
+	WHERE app_id=? AND user_id=? AND entitlement=? AND period=?
+	`
+	query = s.db.Rebind(query)
+
+	used := 0
+	if err := s.db.QueryRowxContext(ctx, query, appID, userID, e, period).Scan(&used); err != nil {
+		if err == sql.ErrNoRows {
+			return 0, nil
+		}
+		logging.Errorw(ctx, "get entitlement usage failed", "err", err, "app_id", appID, "user_id", userID, "entitlement", e)
+		return 0, err
+	}
+	return used, nil
+}
+
+// UnlockChat spends one EntitlementMonthlyChatUnlocks of period on chatID
+// and unlocks the chat and its resume relation, like Ticket.UnlockChat does
+// with a ticket. limit is the plan's quota (EntitlementUnlimited for none);
+// ErrorInsufficientQuota is returned once it is used up.
+func (s *planStore) UnlockChat(ctx context.Context, appID, userID, chatID, period string, limit int) (bool, error) {
+	tx, err := s.db.BeginTxx(ctx, nil)
+	if err != nil {
+		logging.Errorw(ctx, "begin tx failed", "err", err)
+		return false, err
+	}
+	defer tx.Rollback()
+
+	consumed, err := unlockChat(ctx, tx, appID, chatID, func() error {
+		query := `
+		INSERT INTO public.entitlement_usage (app_id, user_id, entitlement, period, used, updated_at)
+		VALUES (?, ?, ?, ?, 1, now())
+		ON CONFLICT (app_id, user_id, entitlement, period)
+		DO UPDATE SET
+			used = public.entitlement_usage.used + 1,
+			updated_at = now()
+		RETURNING used
+		`
+		query = tx.Rebind(query)
+		used := 0
+		if err := tx.QueryRowxContext(ctx, query, appID, userID, models.EntitlementMonthlyChatUnlocks, period).Scan(&used); err != nil {
+			logging.Errorw(ctx, "update entitlement usage failed", "err", err, "app_id", appID, "user_id", userID, "period", period)
+			return err
+		}
+		if limit != models.EntitlementUnlimited && used > limit {
+			return models.ErrorInsufficientQuota
+		}
+		return nil
+	})
+	if err != nil {
+		return false, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		logging.Errorw(ctx, "commit tx failed", "err", err)
+		return false, err
+	}
+	return consumed, nil
+}
@@ -0,0 +1,194 @@
+package store
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/A-pen-app/hire-sdk/models"
+)
+
+const (
+	// presenceBuffer is how many events a subscriber may fall behind before
+	// further events are dropped for it.
+	presenceBuffer = 16
+	// presenceRetention is how long a user's last activity is remembered.
+	presenceRetention = 24 * time.Hour
+	// presenceSweepInterval is how often stale state is dropped, on the
+	// next call after it has passed.
+	presenceSweepInterval = time.Minute
+)
+
+// presenceKey scopes a user or chat ID to its app.
+type presenceKey struct {
+	appID string
+	id    string
+}
+
+type presenceSubscriber struct {
+	appID   string
+	userIDs map[string]bool
+	events  chan *models.PresenceEvent
+}
+
+type memoryPresence struct {
+	mu         sync.Mutex
+	now        func() time.Time
+	sweptAt    time.Time
+	lastActive map[presenceKey]time.Time
+	// typing maps chats to the users typing there and until when
+	typing      map[presenceKey]map[string]time.Time
+	subscribers map[*presenceSubscriber]struct{}
+}
+
+// NewMemoryPresence returns a Presence that lives in this process, for a
+// single node.
+func NewMemoryPresence() Presence {
+	return newMemoryPresence()
+}
+
+func newMemoryPresence() *memoryPresence {
+	return &memoryPresence{
+		now:         time.Now,
+		lastActive:  map[presenceKey]time.Time{},
+		typing:      map[presenceKey]map[string]time.Time{},
+		subscribers: map[*presenceSubscriber]struct{}{},
+	}
+}
+
+// validPresenceEvent rejects events without an app or a user, of an unknown
+// type, or typing events without a chat or an expiry.
+func validPresenceEvent(event *models.PresenceEvent) bool {
+	if event.AppID == "" || event.UserID == "" {
+		return false
+	}
+	switch event.Type {
+	case models.PresenceTyping:
+		return event.ChatID != "" && event.ExpiresAt != nil
+	case models.PresenceActive:
+		return true
+	}
+	return false
+}
+
+func (p *memoryPresence) Publish(ctx context.Context, event *models.PresenceEvent) error {
+	if !validPresenceEvent(event) {
+		return models.ErrorWrongParams
+	}
+	p.apply(event)
+	return nil
+}
+
+// apply records the event and passes it on to the subscribers of its user.
+// Subscribers that are behind miss it rather than hold up the publisher.
+func (p *memoryPresence) apply(event *models.PresenceEvent) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.sweep()
+
+	user := presenceKey{appID: event.AppID, id: event.UserID}
+	if event.At.After(p.lastActive[user]) {
+		p.lastActive[user] = event.At
+	}
+	if event.Type == models.PresenceTyping {
+		chat := presenceKey{appID: event.AppID, id: event.ChatID}
+		users, ok := p.typing[chat]
+		if !ok {
+			users = map[string]time.Time{}
+			p.typing[chat] = users
+		}
+		users[event.UserID] = *event.ExpiresAt
+	}
+
+	for sub := range p.subscribers {
+		if sub.appID != event.AppID || !sub.userIDs[event.UserID] {
+			continue
+		}
+		select {
+		case sub.events <- event:
+		default:
+		}
+	}
+}
+
+// sweep drops activity older than presenceRetention and expired typing, at
+// most once per presenceSweepInterval. p.mu must be held.
+func (p *memoryPresence) sweep() {
+	now := p.now()
+	if now.Sub(p.sweptAt) < presenceSweepInterval {
+		return
+	}
+	p.sweptAt = now
+
+	for user, at := range p.lastActive {
+		if now.Sub(at) > presenceRetention {
+			delete(p.lastActive, user)
+		}
+	}
+	for chat, users := range p.typing {
+		for userID, until := range users {
+			if !until.After(now) {
+				delete(users, userID)
+			}
+		}
+		if len(users) == 0 {
+			delete(p.typing, chat)
+		}
+	}
+}
+
+func (p *memoryPresence) LastActive(ctx context.Context, appID string, userIDs []string) (map[string]time.Time, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.sweep()
+
+	lastActive := map[string]time.Time{}
+	for _, userID := range userIDs {
+		if at, ok := p.lastActive[presenceKey{appID: appID, id: userID}]; ok {
+			lastActive[userID] = at
+		}
+	}
+	return lastActive, nil
+}
+
+func (p *memoryPresence) Typing(ctx context.Context, appID string, chatIDs []string, at time.Time) (map[string][]string, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.sweep()
+
+	typing := map[string][]string{}
+	for _, chatID := range chatIDs {
+		for userID, until := range p.typing[presenceKey{appID: appID, id: chatID}] {
+			if until.After(at) {
+				typing[chatID] = append(typing[chatID], userID)
+			}
+		}
+	}
+	return typing, nil
+}
+
+// Subscribe returns the events of the given users of the app until ctx is
+// done, when the channel is closed.
+func (p *memoryPresence) Subscribe(ctx context.Context, appID string, userIDs []string) (<-chan *models.PresenceEvent, error) {
+	sub := &presenceSubscriber{
+		appID:   appID,
+		userIDs: map[string]bool{},
+		events:  make(chan *models.PresenceEvent, presenceBuffer),
+	}
+	for _, userID := range userIDs {
+		sub.userIDs[userID] = true
+	}
+
+	p.mu.Lock()
+	p.subscribers[sub] = struct{}{}
+	p.mu.Unlock()
+
+	go func() {
+		<-ctx.Done()
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		delete(p.subscribers, sub)
+		close(sub.events)
+	}()
+	return sub.events, nil
+}
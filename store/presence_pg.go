@@ -0,0 +1,97 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/A-pen-app/hire-sdk/models"
+	"github.com/A-pen-app/logging"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+)
+
+// presenceChannel is the Postgres NOTIFY channel presence events go through.
+const presenceChannel = "hire_presence"
+
+// pgPresenceEvent is a presence event as broadcast, with the app it belongs
+// to, which clients are never shown.
+type pgPresenceEvent struct {
+	AppID string `json:"app_id"`
+	models.PresenceEvent
+}
+
+type pgPresence struct {
+	*memoryPresence
+	db *sqlx.DB
+}
+
+// NewPgPresence returns a Presence shared by every node connected to the
+// same database. Events are broadcast with NOTIFY on connStr's database and
+// each node keeps its own copy of the state from what it hears, so a node
+// only knows about events since it started listening. It stops listening
+// when ctx is done.
+func NewPgPresence(ctx context.Context, db *sqlx.DB, connStr string) (Presence, error) {
+	listener := pq.NewListener(connStr, time.Second, time.Minute, func(event pq.ListenerEventType, err error) {
+		if err != nil {
+			logging.Errorw(ctx, "presence listener connection failed", "err", err, "event", event)
+		}
+	})
+	if err := listener.Listen(presenceChannel); err != nil {
+		logging.Errorw(ctx, "listen for presence events failed", "err", err)
+		listener.Close()
+		return nil, err
+	}
+
+	p := &pgPresence{
+		memoryPresence: newMemoryPresence(),
+		db:             db,
+	}
+	go func() {
+		<-ctx.Done()
+		listener.Close()
+	}()
+	go p.listen(ctx, listener)
+	return p, nil
+}
+
+// listen applies the events of every node, this one included, until the
+// listener is closed.
+func (p *pgPresence) listen(ctx context.Context, listener *pq.Listener) {
+	for n := range listener.Notify {
+		if n == nil {
+			// reconnected: whatever was sent meanwhile is lost
+			continue
+		}
+		payload := pgPresenceEvent{}
+		if err := json.Unmarshal([]byte(n.Extra), &payload); err != nil {
+			logging.Errorw(ctx, "decode presence event failed", "err", err, "payload", n.Extra)
+			continue
+		}
+		event := payload.PresenceEvent
+		event.AppID = payload.AppID
+		if !validPresenceEvent(&event) {
+			continue
+		}
+		p.apply(&event)
+	}
+}
+
+func (p *pgPresence) Publish(ctx context.Context, event *models.PresenceEvent) error {
+	// validate before broadcasting, so no node has to drop it
+	if !validPresenceEvent(event) {
+		return models.ErrorWrongParams
+	}
+	payload, err := json.Marshal(pgPresenceEvent{AppID: event.AppID, PresenceEvent: *event})
+	if err != nil {
+		return err
+	}
+
+	query := `SELECT pg_notify(?, ?)`
+	query = p.db.Rebind(query)
+	if _, err := p.db.ExecContext(ctx, query, presenceChannel, string(payload)); err != nil {
+		logging.Errorw(ctx, "notify presence event failed", "err", err, "userID", event.UserID)
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,89 @@
+package store
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/A-pen-app/hire-sdk/models"
+)
+
+func TestMemoryPresence(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	p := newMemoryPresence()
+	p.now = func() time.Time { return start }
+
+	events, err := p.Subscribe(ctx, "app", []string{"alice"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	until := start.Add(5 * time.Second)
+	for _, event := range []*models.PresenceEvent{
+		{AppID: "app", Type: models.PresenceTyping, UserID: "alice", ChatID: "chat", At: start, ExpiresAt: &until},
+		{AppID: "app", Type: models.PresenceActive, UserID: "bob", At: start.Add(time.Minute)},
+		{AppID: "app", Type: models.PresenceActive, UserID: "alice", At: start.Add(-time.Minute)},
+		{AppID: "other", Type: models.PresenceActive, UserID: "alice", At: start.Add(time.Hour)},
+	} {
+		if err := p.Publish(ctx, event); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := p.Publish(ctx, &models.PresenceEvent{AppID: "app", Type: models.PresenceTyping, UserID: "alice", At: start}); err != models.ErrorWrongParams {
+		t.Errorf("typing without a chat: err = %v, want %v", err, models.ErrorWrongParams)
+	}
+	if err := p.Publish(ctx, &models.PresenceEvent{Type: models.PresenceActive, UserID: "alice", At: start}); err != models.ErrorWrongParams {
+		t.Errorf("activity without an app: err = %v, want %v", err, models.ErrorWrongParams)
+	}
+
+	// alice's two events in the app, not bob's nor those in the other app
+	for _, want := range []models.PresenceEventType{models.PresenceTyping, models.PresenceActive} {
+		if event := <-events; event.Type != want || event.UserID != "alice" || event.AppID != "app" {
+			t.Errorf("event = %+v, want %s of alice", event, want)
+		}
+	}
+	select {
+	case event := <-events:
+		t.Errorf("unexpected event %+v", event)
+	default:
+	}
+
+	// an older event does not move last activity back
+	lastActive, err := p.LastActive(ctx, "app", []string{"alice", "bob", "carol"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(lastActive) != 2 || !lastActive["alice"].Equal(start) || !lastActive["bob"].Equal(start.Add(time.Minute)) {
+		t.Errorf("last active = %v", lastActive)
+	}
+
+	typing, err := p.Typing(ctx, "app", []string{"chat", "other"}, start.Add(time.Second))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(typing) != 1 || len(typing["chat"]) != 1 || typing["chat"][0] != "alice" {
+		t.Errorf("typing = %v, want alice in chat", typing)
+	}
+	if typing, _ := p.Typing(ctx, "app", []string{"chat"}, until); len(typing) != 0 {
+		t.Errorf("typing after expiry = %v, want none", typing)
+	}
+	if typing, _ := p.Typing(ctx, "other", []string{"chat"}, start.Add(time.Second)); len(typing) != 0 {
+		t.Errorf("typing in the other app = %v, want none", typing)
+	}
+
+	// stale state is dropped on a later call
+	p.now = func() time.Time { return start.Add(presenceRetention + 2*time.Minute) }
+	if lastActive, _ := p.LastActive(ctx, "app", []string{"alice", "bob"}); len(lastActive) != 0 {
+		t.Errorf("last active after retention = %v, want none", lastActive)
+	}
+	if len(p.typing) != 0 || len(p.lastActive) != 1 {
+		t.Errorf("after the sweep: %d chats typing, %d users active; want 0 and 1", len(p.typing), len(p.lastActive))
+	}
+
+	cancel()
+	if _, ok := <-events; ok {
+		t.Error("events still open after ctx is done")
+	}
+}
@@ -0,0 +1,244 @@
+package store
+
+import (
+	"context"
+
+	"github.com/A-pen-app/hire-sdk/models"
+	"github.com/A-pen-app/logging"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+)
+
+type privacyStore struct {
+	db *sqlx.DB
+}
+
+func NewPrivacy(db *sqlx.DB) Privacy {
+	return &privacyStore{db: db}
+}
+
+// Erase removes the user's personal data from the app in one transaction.
+// Rows that other users or aggregate stats rely on are kept and scrubbed
+// instead of deleted:
+//   - the resume and business card are emptied
+//   - their snapshots lose models.ResumePIIFields and
+//     models.BusinessCardPIIFields but keep the rest for the recruiters
+//     holding them
+//   - sent messages become unavailable and lose their body and media, which
+//     are expired for removal from the blob store
+//   - the hire contact of the user's chat threads is cleared
+//
+// Resume relations and message timestamps stay, so CountByPostIDs and the
+// response medians don't change.
+func (s *privacyStore) Erase(ctx context.Context, appID, userID string) (*models.ErasureReport, error) {
+	tx, err := s.db.BeginTxx(ctx, nil)
+	if err != nil {
+		logging.Errorw(ctx, "failed to begin erase tx", "err", err, "appID", appID, "userID", userID)
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	exec := func(query string, args ...interface{}) (int, error) {
+		result, err := tx.ExecContext(ctx, tx.Rebind(query), args...)
+		if err != nil {
+			return 0, err
+		}
+		n, err := result.RowsAffected()
+		return int(n), err
+	}
+
+	report := models.ErasureReport{}
+	steps := []struct {
+		name  string
+		count *int
+		query string
+		args  []interface{}
+	}{
+		{
+			// before the messages lose their media_ids
+			name:  "media",
+			count: &report.Media,
+			query: `
+			UPDATE public.media
+			SET expired_at = now()
+			WHERE expired_at IS NULL AND id::text IN (
+				SELECT unnest(M.media_ids::text[])
+				FROM public.message M
+				JOIN public.chat C ON M.chat_id = C.id
+				WHERE C.app_id = ? AND M.sender_id = ?
+			)`,
+			args: []interface{}{appID, userID},
+		},
+		{
+			name:  "messages",
+			count: &report.Messages,
+			query: `
+			UPDATE public.message M
+			SET status = ?, body = NULL, media_ids = '{}'
+			FROM public.chat C
+			WHERE M.chat_id = C.id AND C.app_id = ? AND M.sender_id = ?`,
+			args: []interface{}{models.Unavailable, appID, userID},
+		},
+		{
+			name:  "reactions",
+			count: &report.Reactions,
+			query: `
+			DELETE FROM public.message_reaction R
+			USING public.message M, public.chat C
+			WHERE R.message_id = M.id AND M.chat_id = C.id AND C.app_id = ? AND R.user_id = ?`,
+			args: []interface{}{appID, userID},
+		},
+		{
+			// sent ones keep a copy of the message body
+			name:  "scheduled messages",
+			count: &report.ScheduledMessages,
+			query: `
+			DELETE FROM public.scheduled_message
+			WHERE app_id = ? AND sender_id = ?`,
+			args: []interface{}{appID, userID},
+		},
+		{
+			// the app's shared templates have no owner and are kept
+			name:  "message templates",
+			count: &report.MessageTemplates,
+			query: `
+			DELETE FROM public.message_template
+			WHERE app_id = ? AND owner_id = ?`,
+			args: []interface{}{appID, userID},
+		},
+		{
+			name:  "chat threads",
+			count: &report.ChatThreads,
+			query: `
+			UPDATE public.chat_thread CT
+			SET hire_contact = NULL
+			FROM public.chat C
+			WHERE CT.chat_id = C.id AND C.app_id = ? AND CT.sender_id = ? AND CT.hire_contact IS NOT NULL`,
+			args: []interface{}{appID, userID},
+		},
+		{
+			name:  "resume snapshots",
+			count: &report.ResumeSnapshots,
+			query: `
+			UPDATE public.resume_snapshot RS
+			SET content = RS.content - ?::text[]
+			FROM public.resume R
+			WHERE RS.resume_id = R.id AND R.app_id = ? AND R.user_id = ?`,
+			args: []interface{}{pq.Array(models.ResumePIIFields), appID, userID},
+		},
+		{
+			// the same snapshots as businessCard.ListUserSnapshots
+			name:  "business card snapshots",
+			count: &report.BusinessCardSnapshots,
+			query: `
+			UPDATE public.business_card_snapshot
+			SET content = content - ?::text[]
+			WHERE business_card_id IN (
+				SELECT id FROM public.business_card WHERE app_id = ? AND user_id = ?
+			) OR id IN (
+				SELECT M.reference_id
+				FROM public.message M
+				JOIN public.chat C ON M.chat_id = C.id
+				WHERE C.app_id = ? AND M.sender_id = ? AND M.type = ?
+			)`,
+			args: []interface{}{pq.Array(models.BusinessCardPIIFields), appID, userID, appID, userID, models.MsgBusinessCard},
+		},
+		{
+			name:  "resume",
+			count: &report.Resumes,
+			query: `
+			UPDATE public.resume
+			SET content = '{}'::jsonb, updated_at = now()
+			WHERE app_id = ? AND user_id = ?`,
+			args: []interface{}{appID, userID},
+		},
+		{
+			name:  "business card",
+			count: &report.BusinessCards,
+			query: `
+			UPDATE public.business_card
+			SET content = '{}'::jsonb, updated_at = now()
+			WHERE app_id = ? AND user_id = ?`,
+			args: []interface{}{appID, userID},
+		},
+	}
+	for _, step := range steps {
+		n, err := exec(step.query, step.args...)
+		if err != nil {
+			logging.Errorw(ctx, "failed to erase user data", "err", err, "step", step.name, "appID", appID, "userID", userID)
+			return nil, err
+		}
+		*step.count = n
+	}
+
+	if err := tx.Commit(); err != nil {
+		logging.Errorw(ctx, "failed to commit erase tx", "err", err, "appID", appID, "userID", userID)
+		return nil, err
+	}
+	return &report, nil
+}
+
+// ListReactions returns the reactions the user left in the app, oldest
+// first.
+func (s *privacyStore) ListReactions(ctx context.Context, appID, userID string) ([]*models.ExportedReaction, error) {
+	query := `
+	SELECT R.message_id, R.emoji, R.created_at
+	FROM public.message_reaction R
+	JOIN public.message M ON R.message_id = M.id
+	JOIN public.chat C ON M.chat_id = C.id
+	WHERE C.app_id = ? AND R.user_id = ?
+	ORDER BY R.created_at, R.message_id, R.emoji
+	`
+	query = s.db.Rebind(query)
+	reactions := []*models.ExportedReaction{}
+	if err := s.db.SelectContext(ctx, &reactions, query, appID, userID); err != nil {
+		logging.Errorw(ctx, "list user reactions failed", "err", err, "appID", appID, "userID", userID)
+		return nil, err
+	}
+	return reactions, nil
+}
+
+// ListScheduledMessages returns every scheduled message of the user in the
+// app, whatever its status, in the order they were scheduled.
+func (s *privacyStore) ListScheduledMessages(ctx context.Context, appID, userID string) ([]*models.ScheduledMessage, error) {
+	query := `SELECT ` + scheduledMessageColumns + `
+	FROM public.scheduled_message
+	WHERE app_id = ? AND sender_id = ?
+	ORDER BY created_at, id
+	`
+	query = s.db.Rebind(query)
+	rows, err := s.db.QueryxContext(ctx, query, appID, userID)
+	if err != nil {
+		logging.Errorw(ctx, "list user scheduled messages failed", "err", err, "appID", appID, "userID", userID)
+		return nil, err
+	}
+	defer rows.Close()
+
+	msgs := []*models.ScheduledMessage{}
+	for rows.Next() {
+		msg, err := scanScheduledMessage(rows)
+		if err != nil {
+			logging.Errorw(ctx, "scan scheduled message failed", "err", err)
+			return nil, err
+		}
+		msgs = append(msgs, msg)
+	}
+	return msgs, rows.Err()
+}
+
+// ListOwnedTemplates returns the user's own message templates, leaving out
+// the ones the app shares.
+func (s *privacyStore) ListOwnedTemplates(ctx context.Context, appID, userID string) ([]*models.MessageTemplate, error) {
+	query := `SELECT ` + messageTemplateColumns + `
+	FROM public.message_template
+	WHERE app_id = ? AND owner_id = ?
+	ORDER BY created_at, id
+	`
+	query = s.db.Rebind(query)
+	templates := []*models.MessageTemplate{}
+	if err := s.db.SelectContext(ctx, &templates, query, appID, userID); err != nil {
+		logging.Errorw(ctx, "list user message templates failed", "err", err, "appID", appID, "userID", userID)
+		return nil, err
+	}
+	return templates, nil
+}
@@ -290,6 +290,10 @@ func (s *resumeStore) GetSnapshot(ctx context.Context, snapshotID string) (*mode
 }
 
 func (s *resumeStore) ListSnapshots(ctx context.Context, snapshotIDs []string) ([]*models.ResumeSnapshot, error) {
+	if len(snapshotIDs) == 0 {
+		return nil, nil
+	}
+
 	query := `
 	SELECT 
 		id,
@@ -302,7 +306,7 @@ func (s *resumeStore) ListSnapshots(ctx context.Context, snapshotIDs []string) (
 	query = s.db.Rebind(query)
 
 	var snapshots []*models.ResumeSnapshot
-	err := s.db.Select(&snapshots, query, pq.Array(snapshotIDs))
+	err := s.db.SelectContext(ctx, &snapshots, query, pq.Array(snapshotIDs))
 	if err != nil {
 		logging.Errorw(ctx, "failed to list resume snapshots", "err", err, "snapshotIDs", snapshotIDs)
 		return nil, err
@@ -350,7 +354,7 @@ func (s *resumeStore) CreateRelation(ctx context.Context, appID, userID string,
 		ID:         relationID,
 		AppID:      appID,
 		UserID:     userID,
-		SnapshotID: snapshotID,
+		SnapshotID: &snapshotID,
 		PostID:     postID,
 		ChatID:     chatID,
 		CreatedAt:  now,
@@ -434,6 +438,30 @@ func (s *resumeStore) GetRelation(ctx context.Context, opts ...models.GetRelatio
 	return &relation, nil
 }
 
+// ListUserSnapshots returns every snapshot of the user's resume, oldest
+// first.
+func (s *resumeStore) ListUserSnapshots(ctx context.Context, appID, userID string) ([]*models.ResumeSnapshot, error) {
+	query := `
+	SELECT
+		rs.id,
+		rs.resume_id,
+		rs.content,
+		rs.created_at
+	FROM public.resume_snapshot rs
+	JOIN public.resume r ON rs.resume_id = r.id
+	WHERE r.app_id = ? AND r.user_id = ?
+	ORDER BY rs.created_at ASC
+	`
+	query = s.db.Rebind(query)
+
+	snapshots := []*models.ResumeSnapshot{}
+	if err := s.db.SelectContext(ctx, &snapshots, query, appID, userID); err != nil {
+		logging.Errorw(ctx, "failed to list user resume snapshots", "err", err, "appID", appID, "userID", userID)
+		return nil, err
+	}
+	return snapshots, nil
+}
+
 func (s *resumeStore) ListRelations(ctx context.Context, appID string, opts ...models.ListRelationOptionFunc) ([]*models.ResumeRelation, error) {
 	opt := models.ListRelationOption{}
 	for _, f := range opts {
@@ -471,6 +499,11 @@ func (s *resumeStore) ListRelations(ctx context.Context, appID string, opts ...m
 		args = append(args, pq.Array(opt.ChatIDs))
 	}
 
+	if opt.UserID != nil {
+		query += ` AND user_id = ?`
+		args = append(args, *opt.UserID)
+	}
+
 	query = s.db.Rebind(query)
 
 	var relations []*models.ResumeRelation
@@ -0,0 +1,212 @@
+package store
+
+import (
+	"context"
+	"time"
+
+	"github.com/A-pen-app/hire-sdk/models"
+	"github.com/A-pen-app/logging"
+	"github.com/jmoiron/sqlx"
+)
+
+type retentionStore struct {
+	db *sqlx.DB
+}
+
+func NewRetention(db *sqlx.DB) Retention {
+	return &retentionStore{db: db}
+}
+
+// Each rule has one FROM/WHERE clause shared by its Count and Purge, so a
+// dry run reports exactly what a purge would remove. A chat is gone once it
+// has no messages left, and users on legal hold are never purged.
+
+// purgeableMessages: messages of chats inactive since the cutoff that no
+// participant on hold takes part in. Args: appID, cutoff.
+const purgeableMessages = `
+	FROM public.message M
+	JOIN public.chat C ON M.chat_id = C.id
+	WHERE C.app_id = ? AND C.updated_at < ?
+	AND NOT EXISTS (
+		SELECT 1
+		FROM public.chat_thread CT
+		JOIN public.legal_hold LH ON LH.app_id = C.app_id::text AND LH.user_id = CT.sender_id::text
+		WHERE CT.chat_id = C.id
+	)`
+
+// purgeableResumeSnapshots: snapshots sent before the cutoff to chats that
+// are gone, by users not on hold. Args: appID, cutoff.
+const purgeableResumeSnapshots = `
+	FROM public.resume_snapshot RS
+	JOIN public.resume_relation R ON R.snapshot_id = RS.id
+	WHERE R.app_id = ? AND R.created_at < ?
+	AND NOT EXISTS (SELECT 1 FROM public.message M WHERE M.chat_id = R.chat_id)
+	AND NOT EXISTS (
+		SELECT 1 FROM public.legal_hold LH
+		WHERE LH.app_id = R.app_id::text AND LH.user_id = R.user_id::text
+	)`
+
+// purgeableBusinessCardSnapshots: snapshots taken before the cutoff that no
+// chat or business card message refers to, of owners not on hold. A chat
+// keeps its snapshot even once emptied, since its owner tells who the job
+// seeker is. Snapshots taken before their owner saved a card can't be tied
+// to an app and are left alone. Args: appID, cutoff, models.MsgBusinessCard.
+const purgeableBusinessCardSnapshots = `
+	FROM public.business_card_snapshot BS
+	JOIN public.business_card B ON BS.business_card_id = B.id
+	WHERE B.app_id = ? AND BS.created_at < ?
+	AND NOT EXISTS (SELECT 1 FROM public.chat C WHERE C.business_card_snapshot_id = BS.id)
+	AND NOT EXISTS (SELECT 1 FROM public.message M WHERE M.reference_id = BS.id AND M.type = ?)
+	AND NOT EXISTS (
+		SELECT 1 FROM public.legal_hold LH
+		WHERE LH.app_id = B.app_id::text AND LH.user_id = B.user_id::text
+	)`
+
+func (s *retentionStore) count(ctx context.Context, rule, from string, args ...interface{}) (int, error) {
+	n := 0
+	query := s.db.Rebind(`SELECT COUNT(*) ` + from)
+	if err := s.db.QueryRowxContext(ctx, query, args...).Scan(&n); err != nil {
+		logging.Errorw(ctx, "count purgeable rows failed", "err", err, "rule", rule)
+		return 0, err
+	}
+	return n, nil
+}
+
+func (s *retentionStore) purge(ctx context.Context, rule, query string, args ...interface{}) (int, error) {
+	n := 0
+	if err := s.db.QueryRowxContext(ctx, s.db.Rebind(query), args...).Scan(&n); err != nil {
+		logging.Errorw(ctx, "purge rows failed", "err", err, "rule", rule)
+		return 0, err
+	}
+	return n, nil
+}
+
+func (s *retentionStore) CountMessages(ctx context.Context, appID string, inactiveBefore time.Time) (int, error) {
+	return s.count(ctx, "messages", purgeableMessages, appID, inactiveBefore)
+}
+
+// PurgeMessages deletes up to limit purgeable messages, clears the last
+// message of their chats and caps the participants' unread counts at the
+// messages left to read. It returns how many were deleted.
+func (s *retentionStore) PurgeMessages(ctx context.Context, appID string, inactiveBefore time.Time, limit int) (int, error) {
+	// every part of the statement sees the messages as they were before it,
+	// so what is left is what there was less what was purged
+	query := `
+	WITH purged AS (
+		DELETE FROM public.message
+		WHERE id IN (SELECT M.id ` + purgeableMessages + ` LIMIT ?)
+		RETURNING chat_id, sender_id
+	), cleared AS (
+		UPDATE public.chat
+		SET last_message_id = NULL
+		WHERE id IN (SELECT chat_id FROM purged)
+	), capped AS (
+		UPDATE public.chat_thread CT
+		SET unread_count = LEAST(CT.unread_count, (
+			SELECT COUNT(*) FROM public.message M
+			WHERE M.chat_id = CT.chat_id AND M.sender_id::text != CT.sender_id::text
+		) - (
+			SELECT COUNT(*) FROM purged P
+			WHERE P.chat_id = CT.chat_id AND P.sender_id::text != CT.sender_id::text
+		))
+		WHERE CT.chat_id IN (SELECT chat_id FROM purged)
+	)
+	SELECT COUNT(*) FROM purged
+	`
+	return s.purge(ctx, "messages", query, appID, inactiveBefore, limit)
+}
+
+func (s *retentionStore) CountResumeSnapshots(ctx context.Context, appID string, before time.Time) (int, error) {
+	return s.count(ctx, "resume snapshots", purgeableResumeSnapshots, appID, before)
+}
+
+// PurgeResumeSnapshots deletes up to limit purgeable resume snapshots. The
+// relations stay, so CountByPostIDs doesn't change, but no longer point to
+// a snapshot.
+func (s *retentionStore) PurgeResumeSnapshots(ctx context.Context, appID string, before time.Time, limit int) (int, error) {
+	query := `
+	WITH purged AS (
+		DELETE FROM public.resume_snapshot
+		WHERE id IN (SELECT RS.id ` + purgeableResumeSnapshots + ` LIMIT ?)
+		RETURNING id
+	), cleared AS (
+		UPDATE public.resume_relation
+		SET snapshot_id = NULL
+		WHERE snapshot_id IN (SELECT id FROM purged)
+	)
+	SELECT COUNT(*) FROM purged
+	`
+	return s.purge(ctx, "resume snapshots", query, appID, before, limit)
+}
+
+func (s *retentionStore) CountBusinessCardSnapshots(ctx context.Context, appID string, before time.Time) (int, error) {
+	return s.count(ctx, "business card snapshots", purgeableBusinessCardSnapshots, appID, before, models.MsgBusinessCard)
+}
+
+// PurgeBusinessCardSnapshots deletes up to limit purgeable business card
+// snapshots.
+func (s *retentionStore) PurgeBusinessCardSnapshots(ctx context.Context, appID string, before time.Time, limit int) (int, error) {
+	query := `
+	WITH purged AS (
+		DELETE FROM public.business_card_snapshot
+		WHERE id IN (SELECT BS.id ` + purgeableBusinessCardSnapshots + ` LIMIT ?)
+		RETURNING id
+	)
+	SELECT COUNT(*) FROM purged
+	`
+	return s.purge(ctx, "business card snapshots", query, appID, before, models.MsgBusinessCard, limit)
+}
+
+// PlaceLegalHold puts the user on legal hold; placing it again updates the
+// reason.
+func (s *retentionStore) PlaceLegalHold(ctx context.Context, appID, userID, reason string) error {
+	query := `
+	INSERT INTO public.legal_hold (app_id, user_id, reason, created_at)
+	VALUES (?, ?, ?, now())
+	ON CONFLICT (app_id, user_id) DO UPDATE SET reason = EXCLUDED.reason
+	`
+	query = s.db.Rebind(query)
+	if _, err := s.db.ExecContext(ctx, query, appID, userID, reason); err != nil {
+		logging.Errorw(ctx, "place legal hold failed", "err", err, "appID", appID, "userID", userID)
+		return err
+	}
+	return nil
+}
+
+// ReleaseLegalHold lifts the user's legal hold. It returns
+// models.ErrorNotFound when the user isn't on hold.
+func (s *retentionStore) ReleaseLegalHold(ctx context.Context, appID, userID string) error {
+	query := `
+	DELETE FROM public.legal_hold WHERE app_id = ? AND user_id = ?
+	`
+	query = s.db.Rebind(query)
+	result, err := s.db.ExecContext(ctx, query, appID, userID)
+	if err != nil {
+		logging.Errorw(ctx, "release legal hold failed", "err", err, "appID", appID, "userID", userID)
+		return err
+	}
+	if n, err := result.RowsAffected(); err != nil {
+		logging.Errorw(ctx, "get affected rows failed", "err", err)
+		return err
+	} else if n == 0 {
+		return models.ErrorNotFound
+	}
+	return nil
+}
+
+func (s *retentionStore) ListLegalHolds(ctx context.Context, appID string) ([]*models.LegalHold, error) {
+	query := `
+	SELECT app_id, user_id, reason, created_at
+	FROM public.legal_hold
+	WHERE app_id = ?
+	ORDER BY created_at ASC
+	`
+	query = s.db.Rebind(query)
+
+	holds := []*models.LegalHold{}
+	if err := s.db.SelectContext(ctx, &holds, query, appID); err != nil {
+		logging.Errorw(ctx, "list legal holds failed", "err", err, "appID", appID)
+		return nil, err
+	}
+	return holds, nil
+}
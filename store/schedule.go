@@ -0,0 +1,293 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"sort"
+	"time"
+
+	"github.com/A-pen-app/hire-sdk/models"
+	"github.com/A-pen-app/logging"
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+)
+
+// scheduleClaimLease is how long a dispatcher has to settle the messages it
+// claimed before another dispatcher may claim them again.
+const scheduleClaimLease = 5 * time.Minute
+
+const scheduledMessageColumns = `
+	id,
+	app_id,
+	chat_id,
+	sender_id,
+	send_at,
+	type,
+	body,
+	media_ids,
+	reply_to_message_id,
+	status,
+	message_id,
+	error,
+	created_at,
+	updated_at
+`
+
+type scheduledMessageStore struct {
+	db *sqlx.DB
+}
+
+func NewScheduledMessage(db *sqlx.DB) ScheduledMessage {
+	return &scheduledMessageStore{db: db}
+}
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanScheduledMessage(row rowScanner) (*models.ScheduledMessage, error) {
+	msg := models.ScheduledMessage{}
+	err := row.Scan(
+		&msg.ID,
+		&msg.AppID,
+		&msg.ChatID,
+		&msg.SenderID,
+		&msg.SendAt,
+		&msg.Type,
+		&msg.Body,
+		pq.Array(&msg.MediaIDs), // workaround for postgres array type
+		&msg.ReplyToMessageID,
+		&msg.Status,
+		&msg.MessageID,
+		&msg.Error,
+		&msg.CreatedAt,
+		&msg.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &msg, nil
+}
+
+func (s *scheduledMessageStore) Create(ctx context.Context, appID, userID, chatID string, sendAt time.Time, params *models.SendOption) (string, error) {
+	id := uuid.New().String()
+	query := `
+	INSERT INTO public.scheduled_message (
+		id,
+		app_id,
+		chat_id,
+		sender_id,
+		send_at,
+		type,
+		body,
+		media_ids,
+		reply_to_message_id,
+		status,
+		created_at,
+		updated_at
+	)
+	VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, now(), now())
+	`
+	query = s.db.Rebind(query)
+	if _, err := s.db.ExecContext(ctx, query,
+		id,
+		appID,
+		chatID,
+		userID,
+		sendAt,
+		params.Type,
+		params.Body,
+		pq.Array(params.MediaIDs),
+		params.ReplyToMessageID,
+		models.ScheduledPending,
+	); err != nil {
+		logging.Errorw(ctx, "insert scheduled message failed", "err", err, "appID", appID, "chatID", chatID, "userID", userID)
+		return "", err
+	}
+	return id, nil
+}
+
+func (s *scheduledMessageStore) Get(ctx context.Context, appID, id string) (*models.ScheduledMessage, error) {
+	query := `SELECT ` + scheduledMessageColumns + `
+	FROM public.scheduled_message
+	WHERE id=? AND app_id=?
+	`
+	query = s.db.Rebind(query)
+	msg, err := scanScheduledMessage(s.db.QueryRowxContext(ctx, query, id, appID))
+	if err == sql.ErrNoRows {
+		return nil, models.ErrorNotFound
+	} else if err != nil {
+		logging.Errorw(ctx, "get scheduled message failed", "err", err, "appID", appID, "id", id)
+		return nil, err
+	}
+	return msg, nil
+}
+
+// List returns the user's scheduled messages in the chat that have not been
+// sent or canceled, the next to be sent first.
+func (s *scheduledMessageStore) List(ctx context.Context, appID, userID, chatID string) ([]*models.ScheduledMessage, error) {
+	query := `SELECT ` + scheduledMessageColumns + `
+	FROM public.scheduled_message
+	WHERE app_id=? AND sender_id=? AND chat_id=? AND status = ANY(?)
+	ORDER BY send_at, id
+	`
+	query = s.db.Rebind(query)
+	statuses := []string{string(models.ScheduledPending), string(models.ScheduledSending), string(models.ScheduledFailed)}
+	rows, err := s.db.QueryxContext(ctx, query, appID, userID, chatID, pq.Array(statuses))
+	if err != nil {
+		logging.Errorw(ctx, "list scheduled messages failed", "err", err, "appID", appID, "chatID", chatID, "userID", userID)
+		return nil, err
+	}
+	defer rows.Close()
+
+	msgs := []*models.ScheduledMessage{}
+	for rows.Next() {
+		msg, err := scanScheduledMessage(rows)
+		if err != nil {
+			logging.Errorw(ctx, "scan scheduled message failed", "err", err)
+			return nil, err
+		}
+		msgs = append(msgs, msg)
+	}
+	return msgs, rows.Err()
+}
+
+// Update replaces the time and content of a pending scheduled message. It
+// returns models.ErrorNotAllowed once the message is no longer pending.
+func (s *scheduledMessageStore) Update(ctx context.Context, appID, id string, sendAt time.Time, params *models.SendOption) error {
+	query := `
+	UPDATE public.scheduled_message
+	SET send_at=?, type=?, body=?, media_ids=?, reply_to_message_id=?, updated_at=now()
+	WHERE id=? AND app_id=? AND status=?
+	`
+	query = s.db.Rebind(query)
+	result, err := s.db.ExecContext(ctx, query,
+		sendAt,
+		params.Type,
+		params.Body,
+		pq.Array(params.MediaIDs),
+		params.ReplyToMessageID,
+		id,
+		appID,
+		models.ScheduledPending,
+	)
+	if err != nil {
+		logging.Errorw(ctx, "update scheduled message failed", "err", err, "appID", appID, "id", id)
+		return err
+	}
+	return requirePending(result)
+}
+
+// Cancel cancels a pending scheduled message. It returns
+// models.ErrorNotAllowed once the message is no longer pending.
+func (s *scheduledMessageStore) Cancel(ctx context.Context, appID, id string) error {
+	query := `
+	UPDATE public.scheduled_message
+	SET status=?, updated_at=now()
+	WHERE id=? AND app_id=? AND status=?
+	`
+	query = s.db.Rebind(query)
+	result, err := s.db.ExecContext(ctx, query, models.ScheduledCanceled, id, appID, models.ScheduledPending)
+	if err != nil {
+		logging.Errorw(ctx, "cancel scheduled message failed", "err", err, "appID", appID, "id", id)
+		return err
+	}
+	return requirePending(result)
+}
+
+func requirePending(result sql.Result) error {
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return models.ErrorNotAllowed
+	}
+	return nil
+}
+
+// ClaimDue marks up to limit of the app's messages due at now as SENDING and
+// returns them, the earliest first. Rows locked by another dispatcher are
+// skipped rather than waited for, and messages whose claim was not settled
+// within scheduleClaimLease are claimed again, so a dispatcher that died
+// mid-run may cause them to be sent twice but never lost.
+func (s *scheduledMessageStore) ClaimDue(ctx context.Context, appID string, now time.Time, limit int) ([]*models.ScheduledMessage, error) {
+	query := `
+	UPDATE public.scheduled_message
+	SET status=?, claimed_at=?, updated_at=now()
+	WHERE id IN (
+		SELECT id
+		FROM public.scheduled_message
+		WHERE app_id=? AND send_at<=? AND (status=? OR (status=? AND claimed_at<?))
+		ORDER BY send_at, id
+		LIMIT ?
+		FOR UPDATE SKIP LOCKED
+	)
+	RETURNING ` + scheduledMessageColumns
+	query = s.db.Rebind(query)
+	rows, err := s.db.QueryxContext(ctx, query,
+		models.ScheduledSending,
+		now,
+		appID,
+		now,
+		models.ScheduledPending,
+		models.ScheduledSending,
+		now.Add(-scheduleClaimLease),
+		limit,
+	)
+	if err != nil {
+		logging.Errorw(ctx, "claim due scheduled messages failed", "err", err, "appID", appID)
+		return nil, err
+	}
+	defer rows.Close()
+
+	msgs := []*models.ScheduledMessage{}
+	for rows.Next() {
+		msg, err := scanScheduledMessage(rows)
+		if err != nil {
+			logging.Errorw(ctx, "scan scheduled message failed", "err", err)
+			return nil, err
+		}
+		msgs = append(msgs, msg)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	// RETURNING follows no ORDER BY
+	sort.Slice(msgs, func(i, j int) bool {
+		if !msgs[i].SendAt.Equal(msgs[j].SendAt) {
+			return msgs[i].SendAt.Before(msgs[j].SendAt)
+		}
+		return msgs[i].ID < msgs[j].ID
+	})
+	return msgs, nil
+}
+
+func (s *scheduledMessageStore) MarkSent(ctx context.Context, id, messageID string) error {
+	query := `
+	UPDATE public.scheduled_message
+	SET status=?, message_id=?, error=NULL, updated_at=now()
+	WHERE id=?
+	`
+	query = s.db.Rebind(query)
+	if _, err := s.db.ExecContext(ctx, query, models.ScheduledSent, messageID, id); err != nil {
+		logging.Errorw(ctx, "mark scheduled message sent failed", "err", err, "id", id, "messageID", messageID)
+		return err
+	}
+	return nil
+}
+
+func (s *scheduledMessageStore) MarkFailed(ctx context.Context, id, reason string) error {
+	query := `
+	UPDATE public.scheduled_message
+	SET status=?, error=?, updated_at=now()
+	WHERE id=?
+	`
+	query = s.db.Rebind(query)
+	if _, err := s.db.ExecContext(ctx, query, models.ScheduledFailed, reason, id); err != nil {
+		logging.Errorw(ctx, "mark scheduled message failed failed", "err", err, "id", id)
+		return err
+	}
+	return nil
+}
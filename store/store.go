@@ -2,6 +2,7 @@ package store
 
 import (
 	"context"
+	"io"
 	"time"
 
 	"github.com/A-pen-app/hire-sdk/models"
@@ -15,6 +16,7 @@ type Resume interface {
 	CreateSnapshot(ctx context.Context, appID, userID string) (*models.ResumeSnapshot, error)
 	GetSnapshot(ctx context.Context, snapshotID string) (*models.ResumeSnapshot, error)
 	ListSnapshots(ctx context.Context, snapshotIDs []string) ([]*models.ResumeSnapshot, error)
+	ListUserSnapshots(ctx context.Context, appID, userID string) ([]*models.ResumeSnapshot, error)
 	CreateRelation(ctx context.Context, appID, userID string, snapshotID string, chatID string, postID string, status models.ResumeStatus) (*models.ResumeRelation, error)
 	GetRelation(ctx context.Context, opts ...models.GetRelationOptionFunc) (*models.ResumeRelation, error)
 	ListRelations(ctx context.Context, appID string, opts ...models.ListRelationOptionFunc) ([]*models.ResumeRelation, error)
@@ -26,16 +28,25 @@ type Resume interface {
 
 type Chat interface {
 	Get(ctx context.Context, appID, chatID, userID string) (*models.ChatRoom, error)
-	GetChats(ctx context.Context, appID, userID string, next string, count int, status models.ChatAnnotation, unreadOnly bool, includeNoMessage bool) ([]*models.ChatRoom, error)
+	GetChats(ctx context.Context, appID, userID string, after *models.ChatCursor, count int, status models.ChatAnnotation, unreadOnly bool, includeNoMessage bool) ([]*models.ChatRoom, error)
+	HasChats(ctx context.Context, appID, userID string) (bool, error)
 	GetChatID(ctx context.Context, appID, senderID, receiverID string, postID *string, opts ...models.GetChatIDOptionFunc) (string, bool, error)
-	Read(ctx context.Context, userID, chatID string) error
+	ListUserThreads(ctx context.Context, appID, userID string) ([]*models.ChatRoom, error)
+	Read(ctx context.Context, userID, chatID string) (time.Time, error)
 	GetMessage(ctx context.Context, messageID string) (*models.Message, error)
-	GetMessages(ctx context.Context, chatID string, next string, count int) ([]*models.Message, error)
+	GetMessagesByIDs(ctx context.Context, messageIDs []string) ([]*models.Message, error)
+	GetMessages(ctx context.Context, chatID string, before *models.MessageCursor, count int) ([]*models.Message, error)
+	GetMessagesAfter(ctx context.Context, chatID string, after *models.MessageCursor, count int) ([]*models.Message, error)
 	GetNewMessages(ctx context.Context, chatID string, after time.Time) ([]*models.Message, error)
 	GetFirstMessages(ctx context.Context, opt []models.FirstMessageOption) (map[string]*models.Message, error)
+	ListSentMessages(ctx context.Context, appID, userID string, after *models.MessageCursor, count int) ([]*models.Message, error)
 	AddMessage(ctx context.Context, userID, chatID, receiverID string, typ models.MessageType, body *string, mediaIDs []string, replyToMessageID *string, referenceID *string) (string, error)
+	AddMessageOnce(ctx context.Context, messageID, userID, chatID, receiverID string, typ models.MessageType, body *string, mediaIDs []string, replyToMessageID *string) (bool, error)
 	AddMessages(ctx context.Context, userID, chatID, receiverID string, msgs []*models.Message) error
 	EditMessage(ctx context.Context, messageID string, newStatus models.MessageStatus) error
+	AddReaction(ctx context.Context, messageID, userID, emoji string) error
+	RemoveReaction(ctx context.Context, messageID, userID, emoji string) error
+	GetReactions(ctx context.Context, messageIDs []string, userID string) (map[string][]*models.Reaction, error)
 	Annotate(ctx context.Context, chatID, userID string, status models.ChatAnnotation) error
 	Pin(ctx context.Context, chatID, userID string, isPinned bool) error
 	UpdateHireContact(ctx context.Context, chatID string, userID string, contact *models.HireContact) error
@@ -52,6 +63,7 @@ type BusinessCard interface {
 	CreateSnapshot(ctx context.Context, appID, userID string, card *models.BusinessCardContent) (*models.BusinessCardSnapshot, error)
 	GetSnapshot(ctx context.Context, snapshotID string) (*models.BusinessCardSnapshot, error)
 	ListSnapshots(ctx context.Context, snapshotIDs []string) ([]*models.BusinessCardSnapshot, error)
+	ListUserSnapshots(ctx context.Context, appID, userID string) ([]*models.BusinessCardSnapshot, error)
 	GetSnapshotOwners(ctx context.Context, snapshotIDs []string) (map[string]string, error)
 }
 
@@ -59,18 +71,117 @@ type App interface {
 	GetByBundleID(ctx context.Context, bundleID string) (*models.App, error)
 }
 
+// AppCache is a store.App that keeps resolved apps in memory.
+type AppCache interface {
+	App
+	Invalidate(bundleID string)
+	InvalidateAll()
+}
+
 type Media interface {
-	Get(ctx context.Context, mediaIDs []string) ([]*models.Media, error)
+	Get(ctx context.Context, mediaIDs []string) ([]*models.Media, []string, error)
 	New(ctx context.Context, upload *models.MediaUpload) (string, error)
+	Expire(ctx context.Context, mediaIDs []string, at time.Time) (int, error)
+	ListExpired(ctx context.Context, before time.Time, limit int) ([]*models.Media, error)
+	DeleteOrphaned(ctx context.Context, createdBefore time.Time, limit int) ([]*models.Media, error)
+}
+
+// Blob stores media objects by key. SignedURL returns a URL that allows
+// method (GET or PUT) on key without credentials until ttl has passed.
+type Blob interface {
+	Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) error
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+	Stat(ctx context.Context, key string) (int64, error)
+	Delete(ctx context.Context, key string) error
+	SignedURL(ctx context.Context, method, key string, ttl time.Duration) (string, error)
+}
+
+// Presence keeps ephemeral typing and activity state per app and tells
+// subscribers about changes. Nothing is persisted: the state starts empty on
+// every node.
+type Presence interface {
+	Publish(ctx context.Context, event *models.PresenceEvent) error
+	LastActive(ctx context.Context, appID string, userIDs []string) (map[string]time.Time, error)
+	Typing(ctx context.Context, appID string, chatIDs []string, at time.Time) (map[string][]string, error)
+	Subscribe(ctx context.Context, appID string, userIDs []string) (<-chan *models.PresenceEvent, error)
+}
+
+type ScheduledMessage interface {
+	Create(ctx context.Context, appID, userID, chatID string, sendAt time.Time, params *models.SendOption) (string, error)
+	Get(ctx context.Context, appID, id string) (*models.ScheduledMessage, error)
+	List(ctx context.Context, appID, userID, chatID string) ([]*models.ScheduledMessage, error)
+	Update(ctx context.Context, appID, id string, sendAt time.Time, params *models.SendOption) error
+	Cancel(ctx context.Context, appID, id string) error
+	ClaimDue(ctx context.Context, appID string, now time.Time, limit int) ([]*models.ScheduledMessage, error)
+	MarkSent(ctx context.Context, id, messageID string) error
+	MarkFailed(ctx context.Context, id, reason string) error
+}
+
+// Template keeps message templates, either shared by an app (no owner) or
+// owned by one of its users.
+type Template interface {
+	Create(ctx context.Context, appID string, ownerID *string, name, body string) (string, error)
+	Get(ctx context.Context, appID, id string) (*models.MessageTemplate, error)
+	List(ctx context.Context, appID, userID string) ([]*models.MessageTemplate, error)
+	Update(ctx context.Context, appID, id, name, body string) error
+	Delete(ctx context.Context, appID, id string) error
 }
 
 type Agreement interface {
-	Agree(ctx context.Context, appID, userID, version string) error
-	Get(ctx context.Context, appID, userID string) (*models.AgreementRecord, error)
+	Agree(ctx context.Context, appID, userID string, docType models.DocumentType, version string, evidence *models.ConsentEvidence) error
+	Revoke(ctx context.Context, appID, userID string, docType models.DocumentType, evidence *models.ConsentEvidence) error
+	History(ctx context.Context, appID, userID string) ([]*models.ConsentEvent, error)
+	Get(ctx context.Context, appID, userID string, docType models.DocumentType) (*models.AgreementRecord, error)
+	ListAgreed(ctx context.Context, appID, userID string) (map[models.DocumentType]*models.AgreementRecord, error)
+	LatestDocuments(ctx context.Context, appID string) ([]*models.AgreementDocument, error)
+	PublishDocument(ctx context.Context, doc *models.AgreementDocument) error
 }
 
 type Subscription interface {
 	Get(ctx context.Context, appID, userID string) (*models.UserSubscription, error)
 	List(ctx context.Context, appID string, userIDs []string) ([]*models.UserSubscription, error)
 	Update(ctx context.Context, appID, userID string, status models.SubscriptionStatus, expiresAt *time.Time) error
+	ListEvents(ctx context.Context, appID, userID string) ([]*models.SubscriptionEvent, error)
+	ExpireDue(ctx context.Context, now time.Time, limit int) (int, error)
+	ApplyTransaction(ctx context.Context, appID, userID string, txn *models.StoreTransaction, planID *string) (bool, error)
+	SetPlan(ctx context.Context, appID, userID string, planID *string) error
+}
+
+type Plan interface {
+	Get(ctx context.Context, appID, planID string) (*models.Plan, error)
+	GetByProductID(ctx context.Context, appID, productID string) (*models.Plan, error)
+	List(ctx context.Context, appID string) ([]*models.Plan, error)
+	Upsert(ctx context.Context, plan *models.Plan) (string, error)
+	Usage(ctx context.Context, appID, userID string, e models.Entitlement, period string) (int, error)
+	UnlockChat(ctx context.Context, appID, userID, chatID, period string, limit int) (bool, error)
+}
+
+type Ticket interface {
+	Balance(ctx context.Context, appID, userID string) (int, error)
+	Adjust(ctx context.Context, appID, userID string, delta int, reason models.TicketReason) error
+	ListLedger(ctx context.Context, appID, userID string) ([]*models.TicketLedgerEntry, error)
+	UnlockChat(ctx context.Context, appID, userID, chatID string) (bool, error)
+}
+
+// Privacy erases a user's data, and lists what of it no other store lists
+// by user for the export.
+type Privacy interface {
+	Erase(ctx context.Context, appID, userID string) (*models.ErasureReport, error)
+	ListReactions(ctx context.Context, appID, userID string) ([]*models.ExportedReaction, error)
+	ListScheduledMessages(ctx context.Context, appID, userID string) ([]*models.ScheduledMessage, error)
+	ListOwnedTemplates(ctx context.Context, appID, userID string) ([]*models.MessageTemplate, error)
+}
+
+// Retention purges chat data past an app's retention policy in batches;
+// every Purge method has a Count counterpart for dry runs.
+type Retention interface {
+	CountMessages(ctx context.Context, appID string, inactiveBefore time.Time) (int, error)
+	PurgeMessages(ctx context.Context, appID string, inactiveBefore time.Time, limit int) (int, error)
+	CountResumeSnapshots(ctx context.Context, appID string, before time.Time) (int, error)
+	PurgeResumeSnapshots(ctx context.Context, appID string, before time.Time, limit int) (int, error)
+	CountBusinessCardSnapshots(ctx context.Context, appID string, before time.Time) (int, error)
+	PurgeBusinessCardSnapshots(ctx context.Context, appID string, before time.Time, limit int) (int, error)
+	PlaceLegalHold(ctx context.Context, appID, userID, reason string) error
+	ReleaseLegalHold(ctx context.Context, appID, userID string) error
+	ListLegalHolds(ctx context.Context, appID string) ([]*models.LegalHold, error)
 }
@@ -7,6 +7,7 @@ import (
 
 	"github.com/A-pen-app/hire-sdk/models"
 	"github.com/A-pen-app/logging"
+	"github.com/google/uuid"
 	"github.com/jmoiron/sqlx"
 	"github.com/lib/pq"
 )
@@ -29,7 +30,8 @@ func (ss *subscriptionStore) Get(ctx context.Context, appID, userID string) (*mo
 		status,
 		expires_at,
 		created_at,
-		updated_at
+		updated_at,
+		plan_id
 	FROM public.user_subscription 
 	WHERE app_id = ? AND user_id = ?
 	`
@@ -49,7 +51,7 @@ func (ss *subscriptionStore) List(ctx context.Context, appID string, userIDs []s
 	subscriptions := []*models.UserSubscription{}
 
 	query := `
-	SELECT app_id, user_id, status, expires_at, created_at, updated_at
+	SELECT app_id, user_id, status, expires_at, created_at, updated_at, plan_id
 	FROM public.user_subscription
 	WHERE app_id = ?`
 	args := []interface{}{appID}
@@ -69,7 +71,57 @@ func (ss *subscriptionStore) List(ctx context.Context, appID string, userIDs []s
 	return subscriptions, nil
 }
 
+// Update upserts the user's current subscription and appends the change to
+// public.subscription_event in the same transaction, so the history keeps
+// every purchase, renewal and cancellation the row itself overwrites.
 func (ss *subscriptionStore) Update(ctx context.Context, appID, userID string, status models.SubscriptionStatus, expiresAt *time.Time) error {
+	tx, err := ss.db.BeginTxx(ctx, nil)
+	if err != nil {
+		logging.Errorw(ctx, "begin tx failed", "err", err)
+		return err
+	}
+	defer tx.Rollback()
+
+	prev, err := lockSubscription(ctx, tx, appID, userID)
+	if err != nil {
+		return err
+	}
+	if err := ss.upsert(ctx, tx, prev, appID, userID, status, expiresAt); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		logging.Errorw(ctx, "commit tx failed", "err", err)
+		return err
+	}
+	return nil
+}
+
+// lockSubscription locks the user's current row, returning nil when there
+// is none yet.
+func lockSubscription(ctx context.Context, tx *sqlx.Tx, appID, userID string) (*models.UserSubscription, error) {
+	query := `
+	SELECT app_id, user_id, status, expires_at, created_at, updated_at, plan_id
+	FROM public.user_subscription
+	WHERE app_id = ? AND user_id = ?
+	FOR UPDATE
+	`
+	query = tx.Rebind(query)
+	current := models.UserSubscription{}
+	if err := tx.QueryRowxContext(ctx, query, appID, userID).StructScan(&current); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		logging.Errorw(ctx, "get user subscription failed", "err", err, "app_id", appID, "user_id", userID)
+		return nil, err
+	}
+	return &current, nil
+}
+
+// upsert replaces prev, the row locked by lockSubscription, and records the
+// change.
+func (ss *subscriptionStore) upsert(ctx context.Context, tx *sqlx.Tx, prev *models.UserSubscription, appID, userID string, status models.SubscriptionStatus, expiresAt *time.Time) error {
+	// step 1: upsert the current row
 	query := `
 	INSERT INTO public.user_subscription (
 		app_id,
@@ -86,18 +138,282 @@ func (ss *subscriptionStore) Update(ctx context.Context, appID, userID string, s
 		expires_at = EXCLUDED.expires_at,
 		updated_at = now()
 	`
-
-	query = ss.db.Rebind(query)
-	_, err := ss.db.ExecContext(ctx, query,
+	query = tx.Rebind(query)
+	if _, err := tx.ExecContext(ctx, query,
 		appID,
 		userID,
 		status,
 		expiresAt,
-	)
-	if err != nil {
+	); err != nil {
 		logging.Errorw(ctx, "upsert user subscription failed", "err", err, "app_id", appID, "user_id", userID, "status", status)
 		return err
 	}
 
+	// step 2: record the change
+	event := &models.SubscriptionEvent{
+		AppID:     appID,
+		UserID:    userID,
+		Type:      models.ClassifySubscriptionEvent(prev, status, expiresAt, time.Now()),
+		Status:    status,
+		ExpiresAt: expiresAt,
+	}
+	if prev != nil {
+		event.PrevStatus = &prev.Status
+		event.PrevExpiresAt = prev.ExpiresAt
+	}
+	return ss.insertEvent(ctx, tx, event)
+}
+
+// SetPlan moves the user's subscription onto planID (nil for no plan). The
+// status and expiry are left to Update.
+func (ss *subscriptionStore) SetPlan(ctx context.Context, appID, userID string, planID *string) error {
+	query := `
+	UPDATE public.user_subscription
+	SET plan_id = ?, updated_at = now()
+	WHERE app_id = ? AND user_id = ?
+	`
+	query = ss.db.Rebind(query)
+	res, err := ss.db.ExecContext(ctx, query, planID, appID, userID)
+	if err != nil {
+		logging.Errorw(ctx, "set subscription plan failed", "err", err, "app_id", appID, "user_id", userID, "plan_id", planID)
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return sql.ErrNoRows
+	}
 	return nil
 }
+
+func (ss *subscriptionStore) insertEvent(ctx context.Context, tx *sqlx.Tx, event *models.SubscriptionEvent) error {
+	query := `
+	INSERT INTO public.subscription_event (
+		id,
+		app_id,
+		user_id,
+		type,
+		status,
+		expires_at,
+		prev_status,
+		prev_expires_at,
+		created_at
+	)
+	VALUES (?, ?, ?, ?, ?, ?, ?, ?, now())
+	`
+	query = tx.Rebind(query)
+	if _, err := tx.ExecContext(ctx, query,
+		uuid.New().String(),
+		event.AppID,
+		event.UserID,
+		event.Type,
+		event.Status,
+		event.ExpiresAt,
+		event.PrevStatus,
+		event.PrevExpiresAt,
+	); err != nil {
+		logging.Errorw(ctx, "insert subscription event failed", "err", err, "app_id", event.AppID, "user_id", event.UserID, "type", event.Type)
+		return err
+	}
+	return nil
+}
+
+func (ss *subscriptionStore) ListEvents(ctx context.Context, appID, userID string) ([]*models.SubscriptionEvent, error) {
+	query := `
+	SELECT id, app_id, user_id, type, status, expires_at, prev_status, prev_expires_at, created_at
+	FROM public.subscription_event
+	WHERE app_id = ? AND user_id = ?
+	ORDER BY created_at DESC
+	`
+	query = ss.db.Rebind(query)
+
+	events := []*models.SubscriptionEvent{}
+	if err := ss.db.SelectContext(ctx, &events, query, appID, userID); err != nil {
+		logging.Errorw(ctx, "list subscription events failed", "err", err, "app_id", appID, "user_id", userID)
+		return nil, err
+	}
+	return events, nil
+}
+
+// ExpireDue moves up to limit subscriptions (across all apps) whose expiry
+// is at or before now from SUBSCRIBED to SubscriptionNone, recording an
+// EXPIRED event for each. Rows locked by a concurrent Update are skipped and
+// picked up by the next run. It returns the number of rows expired.
+func (ss *subscriptionStore) ExpireDue(ctx context.Context, now time.Time, limit int) (int, error) {
+	query := `
+	WITH due AS (
+		SELECT app_id, user_id, status, expires_at
+		FROM public.user_subscription
+		WHERE status & ? != 0 AND expires_at <= ?
+		ORDER BY expires_at
+		LIMIT ?
+		FOR UPDATE SKIP LOCKED
+	), expired AS (
+		UPDATE public.user_subscription AS US
+		SET status = (US.status & ~?::int) | ?,
+			expires_at = NULL,
+			updated_at = now()
+		FROM due
+		WHERE US.app_id = due.app_id AND US.user_id = due.user_id
+		RETURNING US.app_id, US.user_id, US.status, due.status AS prev_status, due.expires_at AS prev_expires_at
+	)
+	INSERT INTO public.subscription_event (
+		id,
+		app_id,
+		user_id,
+		type,
+		status,
+		expires_at,
+		prev_status,
+		prev_expires_at,
+		created_at
+	)
+	SELECT gen_random_uuid(), app_id, user_id, ?, status, NULL, prev_status, prev_expires_at, now()
+	FROM expired
+	`
+	query = ss.db.Rebind(query)
+	res, err := ss.db.ExecContext(ctx, query,
+		models.SubscriptionSubscribed,
+		now,
+		limit,
+		models.SubscriptionSubscribed,
+		models.SubscriptionNone,
+		models.SubscriptionEventExpired,
+	)
+	if err != nil {
+		logging.Errorw(ctx, "expire due subscriptions failed", "err", err, "now", now, "limit", limit)
+		return 0, err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		logging.Errorw(ctx, "get expired subscription count failed", "err", err)
+		return 0, err
+	}
+	return int(n), nil
+}
+
+// ApplyTransaction records a verified store transaction for userID and
+// applies the status and expiry it grants, moving the user onto planID when
+// it isn't nil, all in one transaction: a delivery whose apply fails is not
+// recorded, so the store's retry applies it again. It returns false without
+// error when the same notification was already applied (stores retry
+// deliveries), and ErrorNotAllowed when the transaction's original
+// transaction ID already belongs to another user.
+func (ss *subscriptionStore) ApplyTransaction(ctx context.Context, appID, userID string, txn *models.StoreTransaction, planID *string) (bool, error) {
+	if txn.NotificationID == "" || txn.OriginalTransactionID == "" {
+		return false, models.ErrorWrongParams
+	}
+
+	tx, err := ss.db.BeginTxx(ctx, nil)
+	if err != nil {
+		logging.Errorw(ctx, "begin tx failed", "err", err)
+		return false, err
+	}
+	defer tx.Rollback()
+
+	// step 1: a subscription is bound to whoever first bought it. A
+	// concurrent first purchase blocks on the insert until this one commits,
+	// then reads the binding it made.
+	query := `
+	INSERT INTO public.subscription_binding (
+		platform,
+		original_transaction_id,
+		app_id,
+		user_id,
+		created_at
+	)
+	VALUES (?, ?, ?, ?, now())
+	ON CONFLICT (platform, original_transaction_id) DO NOTHING
+	`
+	query = tx.Rebind(query)
+	if _, err := tx.ExecContext(ctx, query, txn.Platform, txn.OriginalTransactionID, appID, userID); err != nil {
+		logging.Errorw(ctx, "insert subscription binding failed", "err", err, "app_id", appID, "original_transaction_id", txn.OriginalTransactionID)
+		return false, err
+	}
+
+	query = `
+	SELECT app_id, user_id
+	FROM public.subscription_binding
+	WHERE platform = ? AND original_transaction_id = ?
+	`
+	query = tx.Rebind(query)
+	ownerApp, owner := "", ""
+	if err := tx.QueryRowxContext(ctx, query, txn.Platform, txn.OriginalTransactionID).Scan(&ownerApp, &owner); err != nil {
+		logging.Errorw(ctx, "get subscription binding failed", "err", err, "app_id", appID, "original_transaction_id", txn.OriginalTransactionID)
+		return false, err
+	}
+	if ownerApp != appID || owner != userID {
+		return false, models.ErrorNotAllowed
+	}
+
+	// step 2: dedupe on the delivery
+	query = `
+	INSERT INTO public.subscription_receipt (
+		platform,
+		notification_id,
+		app_id,
+		user_id,
+		notification_type,
+		product_id,
+		transaction_id,
+		original_transaction_id,
+		expires_at,
+		revoked_at,
+		created_at
+	)
+	VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, now())
+	ON CONFLICT (platform, notification_id) DO NOTHING
+	`
+	query = tx.Rebind(query)
+	res, err := tx.ExecContext(ctx, query,
+		txn.Platform,
+		txn.NotificationID,
+		appID,
+		userID,
+		txn.NotificationType,
+		txn.ProductID,
+		txn.TransactionID,
+		txn.OriginalTransactionID,
+		txn.ExpiresAt,
+		txn.RevokedAt,
+	)
+	if err != nil {
+		logging.Errorw(ctx, "insert subscription receipt failed", "err", err, "app_id", appID, "user_id", userID, "notification_id", txn.NotificationID)
+		return false, err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		logging.Errorw(ctx, "get inserted subscription receipt count failed", "err", err)
+		return false, err
+	} else if n == 0 {
+		return false, nil
+	}
+
+	// step 3: apply it, unless a delivery that expires later got here first
+	prev, err := lockSubscription(ctx, tx, appID, userID)
+	if err != nil {
+		return false, err
+	}
+	if status, expiresAt, ok := txn.ApplyTo(prev, time.Now()); ok {
+		if err := ss.upsert(ctx, tx, prev, appID, userID, status, expiresAt); err != nil {
+			return false, err
+		}
+		if planID != nil && (prev == nil || prev.PlanID == nil || *prev.PlanID != *planID) {
+			query = `
+			UPDATE public.user_subscription
+			SET plan_id = ?, updated_at = now()
+			WHERE app_id = ? AND user_id = ?
+			`
+			query = tx.Rebind(query)
+			if _, err := tx.ExecContext(ctx, query, planID, appID, userID); err != nil {
+				logging.Errorw(ctx, "set subscription plan failed", "err", err, "app_id", appID, "user_id", userID, "plan_id", planID)
+				return false, err
+			}
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		logging.Errorw(ctx, "commit tx failed", "err", err)
+		return false, err
+	}
+	return true, nil
+}
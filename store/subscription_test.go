@@ -0,0 +1,124 @@
+package store
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/A-pen-app/hire-sdk/models"
+	"github.com/google/uuid"
+)
+
+func TestApplyTransactionRequiresIDs(t *testing.T) {
+	s := NewSubscription(nil)
+	for _, txn := range []*models.StoreTransaction{
+		{Platform: models.StoreAppStore, OriginalTransactionID: "1000"},
+		{Platform: models.StoreAppStore, NotificationID: "n1"},
+	} {
+		if _, err := s.ApplyTransaction(context.Background(), "app", "alice", txn, nil); err != models.ErrorWrongParams {
+			t.Errorf("ApplyTransaction(%+v) err = %v, want %v", txn, err, models.ErrorWrongParams)
+		}
+	}
+}
+
+func TestApplyTransactionBindsOneUser(t *testing.T) {
+	db := testDB(t,
+		`CREATE TABLE IF NOT EXISTS public.subscription_receipt (
+			platform text NOT NULL,
+			notification_id text NOT NULL,
+			app_id text NOT NULL,
+			user_id text NOT NULL,
+			notification_type text NOT NULL,
+			product_id text NOT NULL,
+			transaction_id text NOT NULL,
+			original_transaction_id text NOT NULL,
+			expires_at timestamptz,
+			revoked_at timestamptz,
+			created_at timestamptz NOT NULL DEFAULT now(),
+			PRIMARY KEY (platform, notification_id)
+		)`,
+		`CREATE TABLE IF NOT EXISTS public.subscription_binding (
+			platform text NOT NULL,
+			original_transaction_id text NOT NULL,
+			app_id text NOT NULL,
+			user_id text NOT NULL,
+			created_at timestamptz NOT NULL DEFAULT now(),
+			PRIMARY KEY (platform, original_transaction_id)
+		)`,
+		`CREATE TABLE IF NOT EXISTS public.user_subscription (
+			app_id text NOT NULL,
+			user_id text NOT NULL,
+			status int NOT NULL,
+			expires_at timestamptz,
+			created_at timestamptz NOT NULL DEFAULT now(),
+			updated_at timestamptz NOT NULL DEFAULT now(),
+			plan_id uuid,
+			PRIMARY KEY (app_id, user_id)
+		)`,
+		`CREATE TABLE IF NOT EXISTS public.subscription_event (
+			id uuid PRIMARY KEY,
+			app_id text NOT NULL,
+			user_id text NOT NULL,
+			type text NOT NULL,
+			status int NOT NULL,
+			expires_at timestamptz,
+			prev_status int,
+			prev_expires_at timestamptz,
+			created_at timestamptz NOT NULL DEFAULT now()
+		)`,
+	)
+	ctx := context.Background()
+	s := NewSubscription(db)
+	original := uuid.New().String()
+	users := []string{uuid.New().String(), uuid.New().String()}
+
+	// two first purchases of the same subscription race
+	errs := make([]error, len(users))
+	wg := sync.WaitGroup{}
+	for i, userID := range users {
+		wg.Add(1)
+		go func(i int, userID string) {
+			defer wg.Done()
+			_, errs[i] = s.ApplyTransaction(ctx, "app", userID, &models.StoreTransaction{
+				Platform:              models.StoreAppStore,
+				NotificationID:        uuid.New().String(),
+				OriginalTransactionID: original,
+			}, nil)
+		}(i, userID)
+	}
+	wg.Wait()
+
+	winner := ""
+	for i, err := range errs {
+		switch err {
+		case nil:
+			if winner != "" {
+				t.Fatalf("both %s and %s own %s", winner, users[i], original)
+			}
+			winner = users[i]
+		case models.ErrorNotAllowed:
+		default:
+			t.Fatal(err)
+		}
+	}
+	if winner == "" {
+		t.Fatalf("nobody owns %s", original)
+	}
+
+	expiresAt := time.Now().Add(time.Hour).Truncate(time.Microsecond)
+	renewal := &models.StoreTransaction{Platform: models.StoreAppStore, NotificationID: uuid.New().String(), OriginalTransactionID: original, ExpiresAt: &expiresAt}
+	if applied, err := s.ApplyTransaction(ctx, "app", winner, renewal, nil); err != nil || !applied {
+		t.Errorf("renewal by %s = %v, %v; want applied", winner, applied, err)
+	}
+	if applied, err := s.ApplyTransaction(ctx, "app", winner, renewal, nil); err != nil || applied {
+		t.Errorf("redelivered renewal = %v, %v; want a no-op", applied, err)
+	}
+	sub, err := s.Get(ctx, "app", winner)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !sub.IsSubscribedAt(time.Now()) || !sub.ExpiresAt.Equal(expiresAt) {
+		t.Errorf("subscription after renewal = %b until %v, want subscribed until %v", sub.Status, sub.ExpiresAt, expiresAt)
+	}
+}
@@ -0,0 +1,124 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/A-pen-app/hire-sdk/models"
+	"github.com/A-pen-app/logging"
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+)
+
+const messageTemplateColumns = `
+	id,
+	app_id,
+	owner_id,
+	name,
+	body,
+	created_at,
+	updated_at
+`
+
+type templateStore struct {
+	db *sqlx.DB
+}
+
+func NewTemplate(db *sqlx.DB) Template {
+	return &templateStore{db: db}
+}
+
+func (s *templateStore) Create(ctx context.Context, appID string, ownerID *string, name, body string) (string, error) {
+	id := uuid.New().String()
+	query := `
+	INSERT INTO public.message_template (
+		id,
+		app_id,
+		owner_id,
+		name,
+		body,
+		created_at,
+		updated_at
+	)
+	VALUES (?, ?, ?, ?, ?, now(), now())
+	`
+	query = s.db.Rebind(query)
+	if _, err := s.db.ExecContext(ctx, query, id, appID, ownerID, name, body); err != nil {
+		logging.Errorw(ctx, "insert message template failed", "err", err, "appID", appID, "ownerID", ownerID)
+		return "", err
+	}
+	return id, nil
+}
+
+func (s *templateStore) Get(ctx context.Context, appID, id string) (*models.MessageTemplate, error) {
+	query := `SELECT ` + messageTemplateColumns + `
+	FROM public.message_template
+	WHERE id=? AND app_id=?
+	`
+	query = s.db.Rebind(query)
+	tmpl := models.MessageTemplate{}
+	if err := s.db.QueryRowxContext(ctx, query, id, appID).StructScan(&tmpl); err == sql.ErrNoRows {
+		return nil, models.ErrorNotFound
+	} else if err != nil {
+		logging.Errorw(ctx, "get message template failed", "err", err, "appID", appID, "id", id)
+		return nil, err
+	}
+	return &tmpl, nil
+}
+
+// List returns the templates shared by the app followed by the user's own,
+// each by name.
+func (s *templateStore) List(ctx context.Context, appID, userID string) ([]*models.MessageTemplate, error) {
+	query := `SELECT ` + messageTemplateColumns + `
+	FROM public.message_template
+	WHERE app_id=? AND (owner_id IS NULL OR owner_id=?)
+	ORDER BY owner_id NULLS FIRST, name, id
+	`
+	query = s.db.Rebind(query)
+	templates := []*models.MessageTemplate{}
+	if err := s.db.SelectContext(ctx, &templates, query, appID, userID); err != nil {
+		logging.Errorw(ctx, "list message templates failed", "err", err, "appID", appID, "userID", userID)
+		return nil, err
+	}
+	return templates, nil
+}
+
+func (s *templateStore) Update(ctx context.Context, appID, id, name, body string) error {
+	query := `
+	UPDATE public.message_template
+	SET name=?, body=?, updated_at=now()
+	WHERE id=? AND app_id=?
+	`
+	query = s.db.Rebind(query)
+	result, err := s.db.ExecContext(ctx, query, name, body, id, appID)
+	if err != nil {
+		logging.Errorw(ctx, "update message template failed", "err", err, "appID", appID, "id", id)
+		return err
+	}
+	return requireTemplate(result)
+}
+
+func (s *templateStore) Delete(ctx context.Context, appID, id string) error {
+	query := `
+	DELETE FROM public.message_template
+	WHERE id=? AND app_id=?
+	`
+	query = s.db.Rebind(query)
+	result, err := s.db.ExecContext(ctx, query, id, appID)
+	if err != nil {
+		logging.Errorw(ctx, "delete message template failed", "err", err, "appID", appID, "id", id)
+		return err
+	}
+	return requireTemplate(result)
+}
+
+func requireTemplate(result sql.Result) error {
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return models.ErrorNotFound
+	}
+	return nil
+}
@@ -0,0 +1,154 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/A-pen-app/hire-sdk/models"
+	"github.com/A-pen-app/logging"
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+)
+
+type ticketStore struct {
+	db *sqlx.DB
+}
+
+// NewTicket returns an implementation of store.Ticket
+func NewTicket(db *sqlx.DB) Ticket {
+	return &ticketStore{db: db}
+}
+
+func (s *ticketStore) Balance(ctx context.Context, appID, userID string) (int, error) {
+	query := `
+	SELECT balance FROM public.ticket_balance
+	WHERE app_id=? AND user_id=?
+	`
+	query = s.db.Rebind(query)
+
+	balance := 0
+	if err := s.db.QueryRowxContext(ctx, query, appID, userID).Scan(&balance); err != nil {
+		if err == sql.ErrNoRows {
+			return 0, nil
+		}
+		logging.Errorw(ctx, "get ticket balance failed", "err", err, "app_id", appID, "user_id", userID)
+		return 0, err
+	}
+	return balance, nil
+}
+
+// Adjust adds delta (which may be negative for ADJUST) to the user's
+// balance and records it in the ledger. The balance can never go below zero.
+func (s *ticketStore) Adjust(ctx context.Context, appID, userID string, delta int, reason models.TicketReason) error {
+	if delta == 0 || reason == models.TicketReasonUnlockChat || (delta < 0 && reason != models.TicketReasonAdjust) {
+		return models.ErrorWrongParams
+	}
+
+	tx, err := s.db.BeginTxx(ctx, nil)
+	if err != nil {
+		logging.Errorw(ctx, "begin tx failed", "err", err)
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `
+	INSERT INTO public.ticket_balance (app_id, user_id, balance, updated_at)
+	VALUES (?, ?, ?, now())
+	ON CONFLICT (app_id, user_id)
+	DO UPDATE SET
+		balance = public.ticket_balance.balance + EXCLUDED.balance,
+		updated_at = now()
+	RETURNING balance
+	`
+	query = tx.Rebind(query)
+	balance := 0
+	if err := tx.QueryRowxContext(ctx, query, appID, userID, delta).Scan(&balance); err != nil {
+		logging.Errorw(ctx, "update ticket balance failed", "err", err, "app_id", appID, "user_id", userID, "delta", delta)
+		return err
+	}
+	if balance < 0 {
+		return models.ErrorInsufficientQuota
+	}
+
+	if err := s.insertLedger(ctx, tx, appID, userID, delta, reason, nil); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		logging.Errorw(ctx, "commit tx failed", "err", err)
+		return err
+	}
+	return nil
+}
+
+func (s *ticketStore) ListLedger(ctx context.Context, appID, userID string) ([]*models.TicketLedgerEntry, error) {
+	query := `
+	SELECT id, app_id, user_id, delta, reason, chat_id, created_at
+	FROM public.ticket_ledger
+	WHERE app_id=? AND user_id=?
+	ORDER BY created_at DESC
+	`
+	query = s.db.Rebind(query)
+
+	entries := []*models.TicketLedgerEntry{}
+	if err := s.db.SelectContext(ctx, &entries, query, appID, userID); err != nil {
+		logging.Errorw(ctx, "list ticket ledger failed", "err", err, "app_id", appID, "user_id", userID)
+		return nil, err
+	}
+	return entries, nil
+}
+
+// UnlockChat spends one of the user's tickets on chatID and unlocks the chat
+// and its resume relation, all in one transaction. Concurrent calls for the
+// same chat serialize and only the first one consumes a ticket; later calls
+// find the chat UNLOCKED and return false.
+func (s *ticketStore) UnlockChat(ctx context.Context, appID, userID, chatID string) (bool, error) {
+	tx, err := s.db.BeginTxx(ctx, nil)
+	if err != nil {
+		logging.Errorw(ctx, "begin tx failed", "err", err)
+		return false, err
+	}
+	defer tx.Rollback()
+
+	consumed, err := unlockChat(ctx, tx, appID, chatID, func() error {
+		query := `
+		UPDATE public.ticket_balance
+		SET balance=balance-1, updated_at=now()
+		WHERE app_id=? AND user_id=? AND balance>0
+		`
+		query = tx.Rebind(query)
+		res, err := tx.ExecContext(ctx, query, appID, userID)
+		if err != nil {
+			logging.Errorw(ctx, "consume ticket failed", "err", err, "app_id", appID, "user_id", userID)
+			return err
+		}
+		if n, err := res.RowsAffected(); err != nil {
+			return err
+		} else if n == 0 {
+			return models.ErrorInsufficientQuota
+		}
+		return s.insertLedger(ctx, tx, appID, userID, -1, models.TicketReasonUnlockChat, &chatID)
+	})
+	if err != nil {
+		return false, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		logging.Errorw(ctx, "commit tx failed", "err", err)
+		return false, err
+	}
+	return consumed, nil
+}
+
+func (s *ticketStore) insertLedger(ctx context.Context, tx *sqlx.Tx, appID, userID string, delta int, reason models.TicketReason, chatID *string) error {
+	query := `
+	INSERT INTO public.ticket_ledger (id, app_id, user_id, delta, reason, chat_id, created_at)
+	VALUES (?, ?, ?, ?, ?, ?, now())
+	`
+	query = tx.Rebind(query)
+	if _, err := tx.ExecContext(ctx, query, uuid.New().String(), appID, userID, delta, reason, chatID); err != nil {
+		logging.Errorw(ctx, "insert ticket ledger failed", "err", err, "app_id", appID, "user_id", userID, "reason", reason)
+		return err
+	}
+	return nil
+}